@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/werf/kubedog/pkg/kube"
+	"github.com/werf/lockgate/pkg/lock_controller"
+)
+
+func run() error {
+	namespace := flag.String("namespace", "", "namespace of Lock objects (default namespace of the kube config by default)")
+	kubeConfig := flag.String("kubeconfig", "", "path to the kube config (in-cluster config or ~/.kube/config by default)")
+	kubeContext := flag.String("context", "", "kube config context")
+	syncPeriod := flag.Duration("sync-period", lock_controller.DefaultSyncPeriod, "period of Lock objects sync")
+	flag.Parse()
+
+	if err := kube.Init(kube.InitOptions{KubeConfigOptions: kube.KubeConfigOptions{ConfigPath: *kubeConfig, Context: *kubeContext}}); err != nil {
+		return fmt.Errorf("unable to initialize kube client: %s", err)
+	}
+
+	if *namespace == "" {
+		*namespace = kube.DefaultNamespace
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	controller := lock_controller.NewLockController(kube.DynamicClient, *namespace)
+	controller.Run(ctx, *syncPeriod)
+
+	return nil
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -1,6 +1,13 @@
 package lockgate
 
-import "time"
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
 
 // Locker is an abstract interface to interact with the locker.
 // Locker implementation is always thread safe so it is possible
@@ -17,6 +24,107 @@ type Locker interface {
 type LockHandle struct {
 	UUID     string `json:"uuid"`
 	LockName string `json:"lockName"`
+	// FencingToken increases with each new lease of the lock, so that a resource protected by the lock
+	// can reject writes of a stale holder by comparing tokens. The counter of tokens is kept in the storage of the lock
+	// and starts over only when the storage record of the lock is removed (e.g. by the record TTL of the store).
+	FencingToken int64 `json:"fencingToken,omitempty"`
+}
+
+// LockInfo describes the current state of the lock.
+type LockInfo struct {
+	LockName string    `json:"lockName"`
+	Held     bool      `json:"held"`
+	Shared   bool      `json:"shared,omitempty"`
+	HolderId string    `json:"holderId,omitempty"`
+	ExpireAt time.Time `json:"expireAt,omitempty"`
+	// HoldDeadline is the time after which the lease cannot be renewed anymore, see AcquireOptions.MaxHoldDuration.
+	HoldDeadline time.Time `json:"holdDeadline,omitempty"`
+}
+
+// LockInspector is implemented by lockers which allow anyone to get the current state of the lock.
+// HolderId of the lock is the AcquirerId passed by the holder to the Acquire method.
+type LockInspector interface {
+	GetLockInfo(lockName string) (*LockInfo, error)
+}
+
+// MaxLockPayloadSize is the maximum size in bytes of the payload attached to the lock by the holder.
+const MaxLockPayloadSize = 4096
+
+// PayloadLocker is implemented by lockers which allow the lock holder to publish a payload
+// (progress of the operation, description of the holder, etc.) readable by anyone.
+// The payload is removed when the lock is released.
+type PayloadLocker interface {
+	SetPayload(handle LockHandle, payload []byte) error
+	GetPayload(lockName string) ([]byte, error)
+}
+
+func ValidateLockPayload(payload []byte) error {
+	if len(payload) > MaxLockPayloadSize {
+		return fmt.Errorf("lock payload size %d exceeds the limit of %d bytes", len(payload), MaxLockPayloadSize)
+	}
+	return nil
+}
+
+// HandoffLocker is implemented by lockers which allow passing an acquired lock
+// to another process (and back) without releasing it.
+//
+// Export serializes the lock handle into a token, Detach stops holding the lock
+// in the current process without releasing it, and Adopt resumes holding the lock
+// described by the token, so that it can be released later with the Release method.
+type HandoffLocker interface {
+	Locker
+	Export(lock LockHandle) (string, error)
+	Adopt(token string, opts AcquireOptions) (LockHandle, error)
+	Detach(lock LockHandle) error
+}
+
+const LockHandleTokenVersion = 1
+
+// LockHandleToken is the serializable form of an acquired lock used by HandoffLocker.
+type LockHandleToken struct {
+	Version    int    `json:"version"`
+	Backend    string `json:"backend"`
+	LockName   string `json:"lockName"`
+	UUID       string `json:"uuid"`
+	Shared     bool   `json:"shared,omitempty"`
+	TTLSeconds int64  `json:"ttlSeconds"`
+	// FencingToken of the exported lease, see LockHandle.FencingToken.
+	FencingToken int64 `json:"fencingToken,omitempty"`
+}
+
+func (token LockHandleToken) LockHandle() LockHandle {
+	return LockHandle{UUID: token.UUID, LockName: token.LockName, FencingToken: token.FencingToken}
+}
+
+func EncodeLockHandleToken(token LockHandleToken) (string, error) {
+	token.Version = LockHandleTokenVersion
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal lock handle token: %s", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func DecodeLockHandleToken(token string) (LockHandleToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return LockHandleToken{}, fmt.Errorf("unable to decode lock handle token: %s", err)
+	}
+
+	var res LockHandleToken
+	if err := json.Unmarshal(data, &res); err != nil {
+		return LockHandleToken{}, fmt.Errorf("unable to unmarshal lock handle token: %s", err)
+	}
+
+	if res.Version != LockHandleTokenVersion {
+		return LockHandleToken{}, fmt.Errorf("unsupported lock handle token version %d, expected %d", res.Version, LockHandleTokenVersion)
+	}
+	if res.UUID == "" || res.LockName == "" {
+		return LockHandleToken{}, fmt.Errorf("bad lock handle token: lock name and uuid required")
+	}
+
+	return res, nil
 }
 
 type AcquireOptions struct {
@@ -25,8 +133,29 @@ type AcquireOptions struct {
 	Shared      bool
 	AcquirerId  string
 
+	// Priority of the acquirer: waiters with higher priority are the first in the wait queue of the lock,
+	// and the acquirer with higher priority preempts the holder of the lock acquired with Preemptible flag.
+	Priority int
+	// Preemptible holder is notified by OnPreemptFunc when an acquirer with higher priority arrives,
+	// the lease is revoked if the holder has not released the lock within PreemptGracePeriod.
+	Preemptible        bool
+	PreemptGracePeriod time.Duration
+	// MaxHoldDuration limits the time the lock can be held, the lease is not renewed after this period
+	// and the holder gets OnLostLeaseFunc callback. OnHoldDeadlineWarningFunc is called once
+	// when HoldDeadlineWarningPeriod is left until the deadline.
+	MaxHoldDuration           time.Duration
+	HoldDeadlineWarningPeriod time.Duration
+	// WaitIfDrained makes the acquirer wait until the drain of the lock is lifted instead of failing with ErrLockDrained.
+	WaitIfDrained bool
+	// WaitIfReserved makes the acquirer wait until the reservation of the lock for another owner ends instead of failing with ErrLockReserved.
+	// The owner of the reservation is identified by AcquirerId.
+	WaitIfReserved bool
+
 	OnWaitFunc      func(lockName string, doWait func() error) error
 	OnLostLeaseFunc func(lock LockHandle) error
+	OnPreemptFunc   func(lock LockHandle) error
+
+	OnHoldDeadlineWarningFunc func(lock LockHandle, deadline time.Time) error
 }
 
 func WithAcquire(locker Locker, lockName string, opts AcquireOptions, f func(acquired bool) error) (resErr error) {
@@ -48,3 +177,88 @@ func WithAcquire(locker Locker, lockName string, opts AcquireOptions, f func(acq
 
 	return
 }
+
+// PoolLocker is implemented by lockers which can acquire the first available lock
+// of the pool of interchangeable locks. The name of the acquired lock is available in the returned LockHandle.
+type PoolLocker interface {
+	Locker
+	AcquireAny(lockNames []string, opts AcquireOptions) (bool, LockHandle, error)
+}
+
+var (
+	ErrAcquireCanceled = errors.New("acquire canceled")
+	ErrNotAcquired     = errors.New("lock not acquired")
+	ErrLockDrained     = errors.New("lock drained")
+	ErrLockReserved    = errors.New("lock reserved")
+)
+
+// AsyncLocker is implemented by lockers which can acquire locks in the background,
+// so that the caller may wait for multiple locks using select or do other work meanwhile.
+type AsyncLocker interface {
+	Locker
+	AcquireAsync(lockName string, opts AcquireOptions) *PendingAcquire
+}
+
+// PendingAcquire is an acquire operation running in the background.
+type PendingAcquire struct {
+	doneChan   chan struct{}
+	cancelChan chan struct{}
+	cancelOnce sync.Once
+
+	handle LockHandle
+	err    error
+}
+
+// NewPendingAcquire runs acquireFunc in the background. The acquireFunc should stop waiting
+// as soon as the cancel channel is closed and return ErrAcquireCanceled.
+// The lock acquired concurrently with the Cancel call is released with releaseFunc.
+func NewPendingAcquire(acquireFunc func(cancelChan <-chan struct{}) (bool, LockHandle, error), releaseFunc func(lock LockHandle) error) *PendingAcquire {
+	pending := &PendingAcquire{
+		doneChan:   make(chan struct{}),
+		cancelChan: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(pending.doneChan)
+
+		if acquired, handle, err := acquireFunc(pending.cancelChan); err != nil {
+			pending.err = err
+		} else if !acquired {
+			pending.err = ErrNotAcquired
+		} else {
+			select {
+			case <-pending.cancelChan:
+				if err := releaseFunc(handle); err != nil {
+					pending.err = err
+				} else {
+					pending.err = ErrAcquireCanceled
+				}
+			default:
+				pending.handle = handle
+			}
+		}
+	}()
+
+	return pending
+}
+
+// Done returns a channel which is closed when the acquire operation is completed.
+func (pending *PendingAcquire) Done() <-chan struct{} {
+	return pending.doneChan
+}
+
+// Result waits for the acquire operation and returns the acquired lock handle.
+// ErrNotAcquired is returned when non-blocking acquire did not take the lock.
+func (pending *PendingAcquire) Result() (LockHandle, error) {
+	<-pending.doneChan
+	return pending.handle, pending.err
+}
+
+// Cancel stops waiting for the lock and waits until the acquire operation is completed.
+// Cancel does nothing when the operation has been completed before the call: the acquired lock should be released by the caller.
+func (pending *PendingAcquire) Cancel() {
+	pending.cancelOnce.Do(func() {
+		close(pending.cancelChan)
+	})
+	<-pending.doneChan
+}
@@ -0,0 +1,93 @@
+package distributed_locker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/werf/lockgate"
+)
+
+func TestDistributedLocker_AcquireAsync(t *testing.T) {
+	locker, _ := newInMemoryLocker()
+
+	pending := locker.AcquireAsync("mylock", lockgate.AcquireOptions{})
+	handle, err := pending.Result()
+	if err != nil {
+		t.Fatalf("acquire async: %s", err)
+	}
+
+	// Pending acquire waits in background until the lock is released
+	pending = locker.AcquireAsync("mylock", lockgate.AcquireOptions{AcquirerId: "waiter"})
+	select {
+	case <-pending.Done():
+		t.Fatalf("acquire of the held lock should be pending")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	if err := locker.Release(handle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+
+	select {
+	case <-pending.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("pending acquire should be done after the release")
+	}
+	handle, err = pending.Result()
+	if err != nil {
+		t.Fatalf("acquire async: %s", err)
+	}
+	if handle.LockName != "mylock" {
+		t.Errorf("got handle of lock %q, expected %q", handle.LockName, "mylock")
+	}
+
+	// Non-blocking acquire of the held lock
+	if _, err := locker.AcquireAsync("mylock", lockgate.AcquireOptions{NonBlocking: true}).Result(); err != lockgate.ErrNotAcquired {
+		t.Errorf("expected %q, got %v", lockgate.ErrNotAcquired, err)
+	}
+
+	if err := locker.Release(handle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+}
+
+func TestDistributedLocker_AcquireAsyncCancel(t *testing.T) {
+	locker, backend := newInMemoryLocker()
+
+	handle := acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{})
+
+	pending := locker.AcquireAsync("mylock", lockgate.AcquireOptions{AcquirerId: "waiter"})
+	time.Sleep(500 * time.Millisecond)
+	if lease := getTestLease(t, backend, "mylock"); lease.QueueMembers["waiter"] == nil {
+		t.Fatalf("pending acquire should wait in the queue, got %v", lease.QueueMembers)
+	}
+
+	// Canceled acquire leaves the queue
+	pending.Cancel()
+	if _, err := pending.Result(); err != lockgate.ErrAcquireCanceled {
+		t.Errorf("expected %q, got %v", lockgate.ErrAcquireCanceled, err)
+	}
+	if lease := getTestLease(t, backend, "mylock"); lease.QueueMembers["waiter"] != nil {
+		t.Errorf("canceled acquire should leave the queue, got %v", lease.QueueMembers)
+	}
+
+	// Lock is released right away without waiters
+	if err := locker.Release(handle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+	if lease := getTestLease(t, backend, "mylock"); lease != nil {
+		t.Errorf("lease should be removed on release, got %#v", lease)
+	}
+
+	// Cancel after the acquire is done does nothing, the lock is held by the caller
+	pending = locker.AcquireAsync("mylock", lockgate.AcquireOptions{})
+	<-pending.Done()
+	pending.Cancel()
+	handle, err := pending.Result()
+	if err != nil {
+		t.Fatalf("acquire async: %s", err)
+	}
+	if err := locker.Release(handle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+}
@@ -0,0 +1,82 @@
+package distributed_locker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/werf/lockgate"
+)
+
+type BarrierBackend interface {
+	BarrierArrive(name string, parties int, participantId string) (int64, error)
+	BarrierPoll(name, participantId string, generation int64) (bool, error)
+	BarrierLeave(name, participantId string) error
+}
+
+// Barrier blocks participants until all parties arrive at the barrier. Barrier is reusable:
+// after all parties have arrived the next Wait call waits for the next generation of arrivals.
+type Barrier struct {
+	Backend       BarrierBackend
+	Name          string
+	Parties       int
+	ParticipantId string
+}
+
+func NewBarrier(backend BarrierBackend, name string, parties int) *Barrier {
+	return &Barrier{
+		Backend:       backend,
+		Name:          name,
+		Parties:       parties,
+		ParticipantId: uuid.New().String(),
+	}
+}
+
+// Wait arrives at the barrier and blocks until all parties arrive.
+// The participant leaves the barrier when the wait is timed out or canceled.
+func (barrier *Barrier) Wait(opts WaitOptions) error {
+	debug("(barrier %q) participant %q arrive", barrier.Name, barrier.ParticipantId)
+
+	generation, err := barrier.Backend.BarrierArrive(barrier.Name, barrier.Parties, barrier.ParticipantId)
+	if err != nil {
+		return err
+	}
+
+	target := &acquireTarget{
+		Name: barrier.Name,
+		Acquire: func() (lockgate.LockHandle, error) {
+			if done, err := barrier.Backend.BarrierPoll(barrier.Name, barrier.ParticipantId, generation); err != nil {
+				return lockgate.LockHandle{}, err
+			} else if !done {
+				return lockgate.LockHandle{}, ErrShouldWait
+			}
+			return lockgate.LockHandle{}, nil
+		},
+	}
+
+	if err := opts.wait(target); err != nil {
+		if leaveErr := barrier.Backend.BarrierLeave(barrier.Name, barrier.ParticipantId); leaveErr != nil {
+			return fmt.Errorf("unable to leave barrier %q: %s", barrier.Name, leaveErr)
+		}
+		return err
+	}
+
+	debug("(barrier %q) participant %q done", barrier.Name, barrier.ParticipantId)
+	return nil
+}
+
+// WaitOptions are options of the Wait method of barriers and latches.
+type WaitOptions struct {
+	// Zero timeout means no timeout.
+	Timeout time.Duration
+	// Wait stops with lockgate.ErrAcquireCanceled error when CancelChan is closed.
+	CancelChan <-chan struct{}
+	// OnWaitFunc has the same meaning as in lockgate.AcquireOptions.
+	OnWaitFunc func(name string, doWait func() error) error
+}
+
+func (opts WaitOptions) wait(target *acquireTarget) error {
+	_, _, err := pollTarget(target, lockgate.AcquireOptions{Timeout: opts.Timeout, OnWaitFunc: opts.OnWaitFunc}, true, time.Now(), opts.CancelChan)
+	return err
+}
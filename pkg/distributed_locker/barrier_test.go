@@ -0,0 +1,117 @@
+package distributed_locker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBarrier_SingleParty(t *testing.T) {
+	_, backend := newInMemoryLocker()
+
+	barrier := NewBarrier(backend, "mybarrier", 1)
+	for i := 0; i < 3; i++ {
+		if err := barrier.Wait(WaitOptions{Timeout: 10 * time.Second}); err != nil {
+			t.Fatalf("wait %d: %s", i, err)
+		}
+	}
+
+	// The only party completes each generation on arrival, nothing is left in the store
+	if value, err := backend.Store.GetValue(backend.recordKeyName("barrier", "mybarrier")); err != nil {
+		t.Fatalf("get value: %s", err)
+	} else if value.Data != "" {
+		t.Errorf("got barrier record %s, expected removed", value.Data)
+	}
+}
+
+func TestBarrier_InvalidParties(t *testing.T) {
+	_, backend := newInMemoryLocker()
+
+	for _, parties := range []int{0, -1} {
+		if _, err := backend.BarrierArrive("mybarrier", parties, "participant"); err == nil {
+			t.Errorf("got no error for %d parties, expected error", parties)
+		}
+	}
+}
+
+func TestBarrier_GenerationRollover(t *testing.T) {
+	_, backend := newInMemoryLocker()
+
+	arrive := func(participantId string, expectedGeneration int64) {
+		t.Helper()
+
+		if generation, err := backend.BarrierArrive("mybarrier", 3, participantId); err != nil {
+			t.Fatalf("arrive %q: %s", participantId, err)
+		} else if generation != expectedGeneration {
+			t.Fatalf("got generation %d for %q, expected %d", generation, participantId, expectedGeneration)
+		}
+	}
+	poll := func(participantId string, generation int64, expectedDone bool) {
+		t.Helper()
+
+		if done, err := backend.BarrierPoll("mybarrier", participantId, generation); err != nil {
+			t.Fatalf("poll %q: %s", participantId, err)
+		} else if done != expectedDone {
+			t.Fatalf("got generation %d done=%v for %q, expected %v", generation, done, participantId, expectedDone)
+		}
+	}
+
+	arrive("participant-1", 0)
+	arrive("participant-2", 0)
+	poll("participant-1", 0, false)
+	poll("participant-2", 0, false)
+
+	// The last party completes the generation and arrives at the next one before others observe it done
+	arrive("participant-3", 0)
+	arrive("participant-3", 1)
+	poll("participant-3", 1, false)
+
+	poll("participant-1", 0, true)
+	arrive("participant-1", 1)
+	poll("participant-2", 0, true)
+	arrive("participant-2", 1)
+
+	// The completing participant observes the generation done on the next poll as others
+	poll("participant-1", 1, true)
+	poll("participant-2", 1, true)
+	poll("participant-3", 1, true)
+
+	// All participants observed the last generation, the record is removed
+	if value, err := backend.Store.GetValue(backend.recordKeyName("barrier", "mybarrier")); err != nil {
+		t.Fatalf("get value: %s", err)
+	} else if value.Data != "" {
+		t.Errorf("got barrier record %s, expected removed", value.Data)
+	}
+}
+
+func TestLatch_CountDown(t *testing.T) {
+	_, backend := newInMemoryLocker()
+
+	latch1 := NewLatch(backend, "mylatch", 2)
+	latch2 := NewLatch(backend, "mylatch", 2)
+
+	if err := latch1.Join(); err != nil {
+		t.Fatalf("join: %s", err)
+	}
+	if err := latch1.CountDown(); err != nil {
+		t.Fatalf("count down: %s", err)
+	}
+	// Repeated count down of the same participant is counted once
+	if err := latch1.CountDown(); err != nil {
+		t.Fatalf("count down: %s", err)
+	}
+
+	state, err := backend.LatchWait("mylatch", 2, "waiter")
+	if err != nil {
+		t.Fatalf("latch wait: %s", err)
+	}
+	if state.Remaining != 1 {
+		t.Fatalf("got %d remaining, expected 1", state.Remaining)
+	}
+
+	if err := latch2.CountDown(); err != nil {
+		t.Fatalf("count down: %s", err)
+	}
+	if err := latch1.Wait(WaitOptions{Timeout: 10 * time.Second}); err != nil {
+		t.Fatalf("wait: %s", err)
+	}
+}
@@ -0,0 +1,89 @@
+package distributed_locker
+
+import (
+	"fmt"
+
+	"github.com/werf/lockgate"
+)
+
+type ClaimBackend interface {
+	Claim(queue string, candidates []string, max int) ([]ClaimedItem, error)
+	CompleteClaim(queue, item string, handle lockgate.LockHandle) error
+	ForgetClaim(queue, item string) error
+}
+
+// ClaimedItem is a work item of the queue exclusively leased by the worker.
+type ClaimedItem struct {
+	Queue  string              `json:"queue"`
+	Item   string              `json:"item"`
+	Handle lockgate.LockHandle `json:"handle"`
+}
+
+// ClaimLockName returns the name of the lock guarding the work item of the queue.
+func ClaimLockName(queue, item string) string {
+	return fmt.Sprintf("lockgate.io/claim/%s/%s", queue, item)
+}
+
+// Claim grants exclusive leases on up to max unclaimed items of the candidates list. Items held by other workers
+// and items marked as done are skipped. Leases are renewed until the item is released with Release or completed with Complete.
+func (l *DistributedLocker) Claim(queue string, candidates []string, max int) ([]ClaimedItem, error) {
+	return l.ClaimWithOptions(queue, candidates, max, lockgate.AcquireOptions{})
+}
+
+// ClaimWithOptions is the same as Claim, OnLostLeaseFunc of the options is called for each item which lease has been lost.
+func (l *DistributedLocker) ClaimWithOptions(queue string, candidates []string, max int, opts lockgate.AcquireOptions) ([]ClaimedItem, error) {
+	debug("(claim %q) candidates=%v max=%d", queue, candidates, max)
+
+	backend, ok := l.Backend.(ClaimBackend)
+	if !ok {
+		return nil, fmt.Errorf("backend %T does not support work claiming", l.Backend)
+	}
+
+	if max <= 0 {
+		return nil, nil
+	}
+
+	claimed, err := backend.Claim(queue, candidates, max)
+	for _, item := range claimed {
+		l.runLeaseRenewWorker(item.Handle, lockgate.AcquireOptions{OnLostLeaseFunc: opts.OnLostLeaseFunc})
+	}
+	if err != nil {
+		return claimed, err
+	}
+
+	debug("(claim %q) claimed %d items", queue, len(claimed))
+	return claimed, nil
+}
+
+// Complete marks the claimed item as done, so it will never be claimed again, and releases the lease of the item.
+func (l *DistributedLocker) Complete(item ClaimedItem) error {
+	debug("(complete %q) item %q", item.Queue, item.Item)
+
+	backend, ok := l.Backend.(ClaimBackend)
+	if !ok {
+		return fmt.Errorf("backend %T does not support work claiming", l.Backend)
+	}
+
+	if err := backend.CompleteClaim(item.Queue, item.Item, item.Handle); err != nil {
+		return fmt.Errorf("unable to complete item %q of queue %q: %s", item.Item, item.Queue, err)
+	}
+
+	return l.Release(item.Handle)
+}
+
+// ForgetClaim deletes the record of the item kept in the storage, so that the completed item can be claimed again.
+// Items which are removed from the work list should be forgotten, otherwise their records are kept forever.
+// The worker holding the item at the moment is not able to complete it after that.
+func (l *DistributedLocker) ForgetClaim(queue, item string) error {
+	debug("(forget claim %q) item %q", queue, item)
+
+	backend, ok := l.Backend.(ClaimBackend)
+	if !ok {
+		return fmt.Errorf("backend %T does not support work claiming", l.Backend)
+	}
+
+	if err := backend.ForgetClaim(queue, item); err != nil {
+		return fmt.Errorf("unable to forget item %q of queue %q: %s", item, queue, err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package distributed_locker
+
+import (
+	"testing"
+)
+
+func claimTestItems(t *testing.T, locker *DistributedLocker, candidates []string, max int) []ClaimedItem {
+	t.Helper()
+
+	items, err := locker.Claim("myqueue", candidates, max)
+	if err != nil {
+		t.Fatalf("claim: %s", err)
+	}
+	return items
+}
+
+func TestClaim_CompleteAndForget(t *testing.T) {
+	locker, backend := newInMemoryLocker()
+	candidates := []string{"item-1", "item-2", "item-3"}
+
+	items := claimTestItems(t, locker, candidates, 2)
+	if len(items) != 2 || items[0].Item != "item-1" || items[1].Item != "item-2" {
+		t.Fatalf("got %#v, expected item-1 and item-2 claimed", items)
+	}
+
+	// Held items are skipped
+	if otherItems := claimTestItems(t, locker, candidates, 3); len(otherItems) != 1 || otherItems[0].Item != "item-3" {
+		t.Fatalf("got %#v, expected only item-3 claimed", otherItems)
+	} else if err := locker.Release(otherItems[0].Handle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+
+	if err := locker.Complete(items[0]); err != nil {
+		t.Fatalf("complete: %s", err)
+	}
+	if err := locker.Release(items[1].Handle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+
+	// Completed items are never claimed again
+	items = claimTestItems(t, locker, candidates, 3)
+	if len(items) != 2 || items[0].Item != "item-2" || items[1].Item != "item-3" {
+		t.Fatalf("got %#v, expected item-2 and item-3 claimed", items)
+	}
+	for _, item := range items {
+		if err := locker.Complete(item); err != nil {
+			t.Fatalf("complete: %s", err)
+		}
+	}
+
+	// Forgotten items have no records and can be claimed again
+	for _, item := range candidates {
+		if err := locker.ForgetClaim("myqueue", item); err != nil {
+			t.Fatalf("forget claim: %s", err)
+		}
+		if value, err := backend.Store.GetValue(backend.claimDoneKeyName("myqueue", item)); err != nil {
+			t.Fatalf("get value: %s", err)
+		} else if value.Data != "" {
+			t.Errorf("got record %s of forgotten item %q, expected removed", value.Data, item)
+		}
+	}
+	if items := claimTestItems(t, locker, candidates, 3); len(items) != 3 {
+		t.Errorf("got %d items claimed, expected all forgotten items claimed", len(items))
+	}
+}
+
+func TestClaim_CompleteByLostHolder(t *testing.T) {
+	locker, _ := newInMemoryLocker()
+
+	items := claimTestItems(t, locker, []string{"item"}, 1)
+	if len(items) != 1 {
+		t.Fatalf("got %d items claimed, expected 1", len(items))
+	}
+	lostItem := items[0]
+	if err := locker.Release(lostItem.Handle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+
+	// The item is claimed by another worker, the previous holder is not able to complete it
+	items = claimTestItems(t, locker, []string{"item"}, 1)
+	if len(items) != 1 {
+		t.Fatalf("got %d items claimed, expected 1", len(items))
+	}
+	if err := locker.Backend.(ClaimBackend).CompleteClaim(lostItem.Queue, lostItem.Item, lostItem.Handle); !IsErrLockAlreadyLeased(err) {
+		t.Errorf("got %v, expected %v", err, ErrLockAlreadyLeased)
+	}
+	if err := locker.Complete(items[0]); err != nil {
+		t.Fatalf("complete: %s", err)
+	}
+}
@@ -0,0 +1,115 @@
+package distributed_locker
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/werf/lockgate"
+)
+
+type CondBackend interface {
+	CondRegisterAndRelease(handle lockgate.LockHandle, waiterId string) (int64, error)
+	CondPoll(lockName, waiterId string, generation int64) (bool, error)
+	CondSignal(lockName string) error
+	CondBroadcast(lockName string) error
+	CondLeave(lockName, waiterId string) error
+}
+
+// Cond is a distributed condition variable tied to the lock of the DistributedLocker.
+type Cond struct {
+	Locker   *DistributedLocker
+	Backend  CondBackend
+	LockName string
+
+	// AcquireOptions are used to re-acquire the lock in the Wait method.
+	AcquireOptions lockgate.AcquireOptions
+}
+
+func NewCond(locker *DistributedLocker, lockName string) (*Cond, error) {
+	backend, ok := locker.Backend.(CondBackend)
+	if !ok {
+		return nil, fmt.Errorf("backend %T does not support condition variables", locker.Backend)
+	}
+
+	return &Cond{
+		Locker:   locker,
+		Backend:  backend,
+		LockName: lockName,
+	}, nil
+}
+
+// Wait releases the lock held by the caller, waits for Signal or Broadcast and re-acquires the lock.
+// The waiter is registered and the lock is released in a single write of the lock record,
+// so that no signal sent after the release is missed. The lock is re-acquired as usual after the wake up,
+// so another acquirer may take the lock first: the caller should check the condition again.
+func (cond *Cond) Wait(handle lockgate.LockHandle) (lockgate.LockHandle, error) {
+	return cond.WaitWithOptions(handle, WaitOptions{})
+}
+
+// WaitWithOptions is Wait which stops waiting when the timeout expires or the wait is canceled,
+// the lock is not re-acquired then and the error is returned.
+func (cond *Cond) WaitWithOptions(handle lockgate.LockHandle, opts WaitOptions) (lockgate.LockHandle, error) {
+	if handle.LockName != cond.LockName {
+		return lockgate.LockHandle{}, fmt.Errorf("lock %q does not belong to the condition variable of lock %q", handle.LockName, cond.LockName)
+	}
+
+	leaseOpts, hasLeaseRenewWorker := cond.Locker.getLeaseRenewWorkerOptions(handle)
+	if !hasLeaseRenewWorker {
+		return lockgate.LockHandle{}, fmt.Errorf("unknown id %q for lock %q", handle.UUID, handle.LockName)
+	}
+
+	// The renew worker is stopped before the release, so that the released lease is not reported as lost
+	if err := cond.Locker.stopLeaseRenewWorker(handle); err != nil {
+		return lockgate.LockHandle{}, err
+	}
+
+	waiterId := uuid.New().String()
+	generation, err := cond.Backend.CondRegisterAndRelease(handle, waiterId)
+	if err != nil {
+		if !IsErrLockAlreadyLeased(err) && !IsErrNoExistingLockLeaseFound(err) {
+			// The lock is still held by the caller
+			cond.Locker.runLeaseRenewWorker(handle, leaseOpts)
+		}
+		return lockgate.LockHandle{}, err
+	}
+	debug("(cond %q) waiter %q registered in generation %d", cond.LockName, waiterId, generation)
+
+	target := &acquireTarget{
+		Name: cond.LockName,
+		Acquire: func() (lockgate.LockHandle, error) {
+			if woken, err := cond.Backend.CondPoll(cond.LockName, waiterId, generation); err != nil {
+				return lockgate.LockHandle{}, err
+			} else if !woken {
+				return lockgate.LockHandle{}, ErrShouldWait
+			}
+			return lockgate.LockHandle{}, nil
+		},
+	}
+
+	if err := opts.wait(target); err != nil {
+		if leaveErr := cond.Backend.CondLeave(cond.LockName, waiterId); leaveErr != nil {
+			return lockgate.LockHandle{}, fmt.Errorf("unable to leave condition variable of lock %q: %s", cond.LockName, leaveErr)
+		}
+		return lockgate.LockHandle{}, err
+	}
+	debug("(cond %q) waiter %q woken up", cond.LockName, waiterId)
+
+	acquireOpts := cond.AcquireOptions
+	acquireOpts.NonBlocking = false
+	if _, newHandle, err := cond.Locker.Acquire(cond.LockName, acquireOpts); err != nil {
+		return lockgate.LockHandle{}, err
+	} else {
+		return newHandle, nil
+	}
+}
+
+// Signal wakes one waiter of the condition variable.
+func (cond *Cond) Signal() error {
+	return cond.Backend.CondSignal(cond.LockName)
+}
+
+// Broadcast wakes all waiters of the condition variable.
+func (cond *Cond) Broadcast() error {
+	return cond.Backend.CondBroadcast(cond.LockName)
+}
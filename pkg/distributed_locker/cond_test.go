@@ -0,0 +1,136 @@
+package distributed_locker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/werf/lockgate"
+)
+
+// failingCondBackend fails registrations of waiters without touching the lock.
+type failingCondBackend struct {
+	CondBackend
+}
+
+func (backend failingCondBackend) CondRegisterAndRelease(lockgate.LockHandle, string) (int64, error) {
+	return 0, fmt.Errorf("connection refused")
+}
+
+func getTestCond(t *testing.T, backend *OptimisticLockingStorageBasedBackend, lockName string) *CondRecord {
+	t.Helper()
+
+	value, err := backend.Store.GetValue(backend.keyName(lockName))
+	if err != nil {
+		t.Fatalf("get value: %s", err)
+	}
+	record := &LockLeaseRecord{}
+	if _, err := extractRecordFromStoreValue(value, record); err != nil {
+		t.Fatalf("extract record: %s", err)
+	}
+	return record.Cond
+}
+
+func TestCond_RegisterFailureKeepsLease(t *testing.T) {
+	locker, backend := newInMemoryLocker()
+
+	cond, err := NewCond(locker, "mylock")
+	if err != nil {
+		t.Fatalf("new cond: %s", err)
+	}
+	cond.Backend = failingCondBackend{CondBackend: backend}
+
+	handle := acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{})
+	if _, err := cond.Wait(handle); err == nil {
+		t.Fatalf("got no error, expected registration error")
+	}
+
+	if !locker.isLeaseRenewWorkerActive(handle) {
+		t.Errorf("got lease renew worker stopped, expected the lease of the caller to be renewed after the failure")
+	}
+	if err := locker.Release(handle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+}
+
+func TestCond_WaitTimeout(t *testing.T) {
+	locker, backend := newInMemoryLocker()
+
+	cond, err := NewCond(locker, "mylock")
+	if err != nil {
+		t.Fatalf("new cond: %s", err)
+	}
+
+	handle := acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{})
+	if _, err := cond.WaitWithOptions(handle, WaitOptions{Timeout: time.Second}); err == nil {
+		t.Fatalf("got no error, expected timeout")
+	}
+
+	// The lock is released and the waiter has left, so the state of the condition variable is removed
+	if lease := getTestLease(t, backend, "mylock"); lease != nil {
+		t.Errorf("got lease %#v, expected the lock released", lease)
+	}
+	if condRecord := getTestCond(t, backend, "mylock"); condRecord != nil {
+		t.Errorf("got condition variable state %#v, expected removed", condRecord)
+	}
+}
+
+func TestCond_SignalAndCleanup(t *testing.T) {
+	locker, backend := newInMemoryLocker()
+
+	cond, err := NewCond(locker, "mylock")
+	if err != nil {
+		t.Fatalf("new cond: %s", err)
+	}
+
+	handle := acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{})
+
+	resultChan := make(chan error, 1)
+	go func() {
+		newHandle, err := cond.WaitWithOptions(handle, WaitOptions{Timeout: 20 * time.Second})
+		if err == nil {
+			err = locker.Release(newHandle)
+		}
+		resultChan <- err
+	}()
+
+	for getTestCond(t, backend, "mylock") == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := cond.Signal(); err != nil {
+		t.Fatalf("signal: %s", err)
+	}
+
+	if err := <-resultChan; err != nil {
+		t.Fatalf("wait: %s", err)
+	}
+	if condRecord := getTestCond(t, backend, "mylock"); condRecord != nil {
+		t.Errorf("got condition variable state %#v after the waiter left, expected removed", condRecord)
+	}
+}
+
+func TestCond_LeavePassesSignal(t *testing.T) {
+	_, backend := newInMemoryLocker()
+
+	for _, waiterId := range []string{"waiter-1", "waiter-2"} {
+		if woken, err := backend.CondPoll("mylock", waiterId, 0); err != nil {
+			t.Fatalf("poll %q: %s", waiterId, err)
+		} else if woken {
+			t.Fatalf("got %q woken, expected waiting", waiterId)
+		}
+		time.Sleep(time.Second)
+	}
+
+	if err := backend.CondSignal("mylock"); err != nil {
+		t.Fatalf("signal: %s", err)
+	}
+	if err := backend.CondLeave("mylock", "waiter-1"); err != nil {
+		t.Fatalf("leave: %s", err)
+	}
+
+	if woken, err := backend.CondPoll("mylock", "waiter-2", 0); err != nil {
+		t.Fatalf("poll: %s", err)
+	} else if !woken {
+		t.Errorf("got waiter-2 waiting, expected the signal of the left waiter passed to it")
+	}
+}
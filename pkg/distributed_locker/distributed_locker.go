@@ -3,22 +3,33 @@ package distributed_locker
 import (
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/werf/lockgate"
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
 )
 
 type DistributedLocker struct {
 	mux               sync.Mutex
 	leaseRenewWorkers map[string]*LeaseRenewWorkerDescriptor
 
+	// journalChanges are entries of the handle journal by the lease UUID gathered under mux,
+	// which are written by flushJournal after mux is unlocked
+	journalChanges map[string]*HandleJournalEntry
+	journalMux     sync.Mutex
+
 	Backend DistributedLockerBackend
+	Journal *HandleJournal
 }
 
 type LeaseRenewWorkerDescriptor struct {
 	DoneChan           chan struct{}
 	SharedLeaseCounter int64
+	Shared             bool
+
+	opts lockgate.AcquireOptions
 }
 
 func NewDistributedLocker(backend DistributedLockerBackend) *DistributedLocker {
@@ -28,9 +39,130 @@ func NewDistributedLocker(backend DistributedLockerBackend) *DistributedLocker {
 	}
 }
 
+// NewDistributedLockerWithJournal creates a locker which records outstanding lock handles into the journal.
+// Leases recorded by the previous run of the process are resumed or released depending on the options.
+func NewDistributedLockerWithJournal(backend DistributedLockerBackend, journal *HandleJournal, opts HandleJournalOptions) (*DistributedLocker, *HandleJournalRecoveryReport, error) {
+	l := NewDistributedLocker(backend)
+
+	report, err := l.recoverJournal(journal, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	l.Journal = journal
+
+	return l, report, nil
+}
+
 func (l *DistributedLocker) Acquire(lockName string, opts lockgate.AcquireOptions) (bool, lockgate.LockHandle, error) {
 	debug("(acquire %q) opts=%#v", lockName, opts)
-	return l.acquire(lockName, opts, true, time.Now())
+	return l.acquire(lockName, opts, true, time.Now(), nil)
+}
+
+// AcquireAsync acquires the lock in the background, OnWaitFunc is not called by the pending acquire.
+// Canceled acquire leaves the wait queue of the lock when AcquirerId is specified.
+func (l *DistributedLocker) AcquireAsync(lockName string, opts lockgate.AcquireOptions) *lockgate.PendingAcquire {
+	debug("(acquire async %q) opts=%#v", lockName, opts)
+	return lockgate.NewPendingAcquire(func(cancelChan <-chan struct{}) (bool, lockgate.LockHandle, error) {
+		return l.acquire(lockName, opts, false, time.Now(), cancelChan)
+	}, l.Release)
+}
+
+// AcquireAny acquires the first available lock of the pool of interchangeable locks,
+// the name of the acquired lock is available in the returned lock handle.
+// Acquirers with AcquirerId wait in a single queue of the pool in a FIFO manner.
+func (l *DistributedLocker) AcquireAny(lockNames []string, opts lockgate.AcquireOptions) (bool, lockgate.LockHandle, error) {
+	debug("(acquire any %v) opts=%#v", lockNames, opts)
+
+	if len(lockNames) == 0 {
+		return false, lockgate.LockHandle{}, fmt.Errorf("no lock names specified")
+	}
+
+	target := &acquireTarget{
+		Name: strings.Join(lockNames, ","),
+		Acquire: func() (lockgate.LockHandle, error) {
+			return l.Backend.AcquireAny(lockNames, NewAcquireOptions(opts))
+		},
+		LeaveQueue: func() error {
+			return l.Backend.LeaveQueueAny(lockNames, opts.AcquirerId)
+		},
+		OnAcquired: func(handle lockgate.LockHandle) {
+			l.runLeaseRenewWorker(handle, opts)
+		},
+	}
+	return pollTarget(target, opts, true, time.Now(), nil)
+}
+
+func (l *DistributedLocker) GetLockInfo(lockName string) (*lockgate.LockInfo, error) {
+	return l.Backend.GetLockInfo(lockName)
+}
+
+// SetPayload publishes the payload of the lock held by the handle, the payload is readable by anyone with GetPayload.
+func (l *DistributedLocker) SetPayload(handle lockgate.LockHandle, payload []byte) error {
+	debug("(set payload %q) uuid=%s size=%d", handle.LockName, handle.UUID, len(payload))
+	return l.Backend.SetPayload(handle, payload)
+}
+
+func (l *DistributedLocker) GetPayload(lockName string) ([]byte, error) {
+	return l.Backend.GetPayload(lockName)
+}
+
+// Export serializes an acquired lock handle into a token, which can be passed to another process.
+// Use Detach to stop holding the lock in the current process after the token has been exported.
+func (l *DistributedLocker) Export(handle lockgate.LockHandle) (string, error) {
+	debug("(export %q) uuid=%s", handle.LockName, handle.UUID)
+
+	l.mux.Lock()
+	desc, hasKey := l.leaseRenewWorkers[handle.UUID]
+	l.mux.Unlock()
+
+	if !hasKey {
+		return "", fmt.Errorf("unknown id %q for lock %q", handle.UUID, handle.LockName)
+	}
+
+	return lockgate.EncodeLockHandleToken(l.newLockHandleToken(handle, desc.Shared))
+}
+
+// Adopt resumes holding the lock described by the token, which has been exported by another process.
+// Lock lease will be renewed by the current process until Release or Detach is called.
+func (l *DistributedLocker) Adopt(token string, opts lockgate.AcquireOptions) (lockgate.LockHandle, error) {
+	handleToken, err := lockgate.DecodeLockHandleToken(token)
+	if err != nil {
+		return lockgate.LockHandle{}, err
+	}
+	debug("(adopt %q) token=%#v", handleToken.LockName, handleToken)
+
+	if backendId := GetBackendId(l.Backend); handleToken.Backend != backendId {
+		return lockgate.LockHandle{}, fmt.Errorf("lock handle token for lock %q belongs to the backend %q, expected %q", handleToken.LockName, handleToken.Backend, backendId)
+	}
+
+	handle := handleToken.LockHandle()
+	// Preempted lease is still held, the renew worker notifies about the preemption
+	if err := l.Backend.RenewLease(handle); err != nil && !IsErrLeasePreempted(err) {
+		return lockgate.LockHandle{}, fmt.Errorf("unable to adopt lease %s for lock %q: %s", handle.UUID, handle.LockName, err)
+	}
+
+	opts.Shared = handleToken.Shared
+	l.runLeaseRenewWorker(handle, opts)
+
+	return handle, nil
+}
+
+func (l *DistributedLocker) newLockHandleToken(handle lockgate.LockHandle, shared bool) lockgate.LockHandleToken {
+	return lockgate.LockHandleToken{
+		Version:      lockgate.LockHandleTokenVersion,
+		Backend:      GetBackendId(l.Backend),
+		LockName:     handle.LockName,
+		UUID:         handle.UUID,
+		Shared:       shared,
+		TTLSeconds:   DistributedLockLeaseTTLSeconds,
+		FencingToken: handle.FencingToken,
+	}
+}
+
+// Detach stops renewing the lock lease in the current process without releasing the lock.
+func (l *DistributedLocker) Detach(handle lockgate.LockHandle) error {
+	debug("(detach %q) uuid=%s", handle.LockName, handle.UUID)
+	return l.stopLeaseRenewWorker(handle)
 }
 
 func (l *DistributedLocker) HoldLease(lockName string, uuid string) {
@@ -62,7 +194,46 @@ func (l *DistributedLocker) HoldLease(lockName string, uuid string) {
 	}
 }
 
-func (l *DistributedLocker) acquire(lockName string, opts lockgate.AcquireOptions, shouldCallOnWait bool, startedAcquireAt time.Time) (bool, lockgate.LockHandle, error) {
+// acquireTarget describes a lock (or a pool of locks, a barrier, a latch) to wait for in the acquire polling loop.
+type acquireTarget struct {
+	Name string
+	// Acquire returns ErrShouldWait until the target is acquired
+	Acquire    func() (lockgate.LockHandle, error)
+	LeaveQueue func() error
+	// OnAcquired is optional, it is called with the handle of the acquired target
+	OnAcquired func(handle lockgate.LockHandle)
+	// Watch is optional, the poll is retried early when the returned channel is closed
+	Watch func(stopChan <-chan struct{}) <-chan struct{}
+}
+
+func (l *DistributedLocker) acquire(lockName string, opts lockgate.AcquireOptions, shouldCallOnWait bool, startedAcquireAt time.Time, cancelChan <-chan struct{}) (bool, lockgate.LockHandle, error) {
+	target := &acquireTarget{
+		Name: lockName,
+		Acquire: func() (lockgate.LockHandle, error) {
+			return l.Backend.Acquire(lockName, NewAcquireOptions(opts))
+		},
+		LeaveQueue: func() error {
+			return l.Backend.LeaveQueue(lockName, opts.AcquirerId)
+		},
+		OnAcquired: func(handle lockgate.LockHandle) {
+			l.runLeaseRenewWorker(handle, opts)
+		},
+	}
+	if watcher, ok := l.Backend.(LockWatcherBackend); ok {
+		// The lock is watched since the record read by the last attempt, so that the release right after the attempt is not missed
+		var observedValue *optimistic_locking_store.Value
+		target.Acquire = func() (handle lockgate.LockHandle, err error) {
+			handle, observedValue, err = watcher.AcquireObserved(lockName, NewAcquireOptions(opts))
+			return handle, err
+		}
+		target.Watch = func(stopChan <-chan struct{}) <-chan struct{} {
+			return watcher.WatchLock(lockName, observedValue, stopChan)
+		}
+	}
+	return pollTarget(target, opts, shouldCallOnWait, startedAcquireAt, cancelChan)
+}
+
+func pollTarget(target *acquireTarget, opts lockgate.AcquireOptions, shouldCallOnWait bool, startedAcquireAt time.Time, cancelChan <-chan struct{}) (bool, lockgate.LockHandle, error) {
 RETRY_ACQUIRE:
 	if opts.Timeout != 0 {
 		if time.Now().After(startedAcquireAt.Add(opts.Timeout)) {
@@ -70,23 +241,26 @@ RETRY_ACQUIRE:
 		}
 	}
 
-	if lockHandle, err := l.Backend.Acquire(lockName, AcquireOptions{Shared: opts.Shared, AcquirerId: opts.AcquirerId}); IsErrShouldWait(err) {
+	if lockHandle, err := target.Acquire(); IsErrShouldWait(err) {
 		if opts.NonBlocking {
-			debug("(acquire %q) non blocking acquire done: lock not taken!", lockName)
+			debug("(acquire %q) non blocking acquire done: lock not taken!", target.Name)
 			return false, lockgate.LockHandle{}, nil
 		}
 
-		debug("(acquire %q) poll lock: will retry in %d seconds", lockName, DistributedLockPollRetryPeriodSeconds)
-		debug("(acquire %q) ---", lockName)
+		debug("(acquire %q) poll lock: will retry in %d seconds", target.Name, DistributedLockPollRetryPeriodSeconds)
+		debug("(acquire %q) ---", target.Name)
 
 		if opts.OnWaitFunc != nil && shouldCallOnWait {
 			var acquireLocked bool
 			var acquireHandle lockgate.LockHandle
 			var acquireErr error
 
-			if err := opts.OnWaitFunc(lockName, func() error {
-				time.Sleep(DistributedLockPollRetryPeriodSeconds * time.Second)
-				acquireLocked, acquireHandle, acquireErr = l.acquire(lockName, opts, false, startedAcquireAt)
+			if err := opts.OnWaitFunc(target.Name, func() error {
+				if err := waitPollRetryPeriod(target, opts, cancelChan); err != nil {
+					acquireErr = err
+					return acquireErr
+				}
+				acquireLocked, acquireHandle, acquireErr = pollTarget(target, opts, false, startedAcquireAt, cancelChan)
 				return acquireErr
 			}); err != nil {
 				return acquireLocked, acquireHandle, err
@@ -94,17 +268,51 @@ RETRY_ACQUIRE:
 
 			return acquireLocked, acquireHandle, acquireErr
 		} else {
-			time.Sleep(DistributedLockPollRetryPeriodSeconds * time.Second)
+			if err := waitPollRetryPeriod(target, opts, cancelChan); err != nil {
+				return false, lockgate.LockHandle{}, err
+			}
 			goto RETRY_ACQUIRE
 		}
+	} else if IsErrLockDrained(err) {
+		return false, lockgate.LockHandle{}, lockgate.ErrLockDrained
+	} else if IsErrLockReserved(err) {
+		return false, lockgate.LockHandle{}, lockgate.ErrLockReserved
 	} else if err != nil {
 		return false, lockgate.LockHandle{}, err
 	} else {
-		l.runLeaseRenewWorker(lockHandle, opts)
+		if target.OnAcquired != nil {
+			target.OnAcquired(lockHandle)
+		}
 		return true, lockHandle, nil
 	}
 }
 
+func waitPollRetryPeriod(target *acquireTarget, opts lockgate.AcquireOptions, cancelChan <-chan struct{}) error {
+	var changedChan <-chan struct{}
+	if target.Watch != nil {
+		stopChan := make(chan struct{})
+		defer close(stopChan)
+		changedChan = target.Watch(stopChan)
+	}
+
+	select {
+	case <-time.After(DistributedLockPollRetryPeriodSeconds * time.Second):
+		return nil
+	case <-changedChan:
+		debug("(acquire %q) lock changed: retry now", target.Name)
+		return nil
+	case <-cancelChan:
+		debug("(acquire %q) canceled", target.Name)
+
+		if opts.AcquirerId != "" {
+			if err := target.LeaveQueue(); err != nil {
+				return fmt.Errorf("unable to leave queue of lock %q: %s", target.Name, err)
+			}
+		}
+		return lockgate.ErrAcquireCanceled
+	}
+}
+
 func (l *DistributedLocker) Release(handle lockgate.LockHandle) error {
 	debug("(release lock %q) %#v", handle.LockName, handle)
 	return l.release(handle)
@@ -132,6 +340,7 @@ func (l *DistributedLocker) runLeaseRenewWorker(handle lockgate.LockHandle, opts
 	defer func() {
 		debug("(runLeaseRenewWorker %q %q) unlock", handle.LockName, handle.UUID)
 		l.mux.Unlock()
+		l.flushJournal()
 	}()
 	debug("(runLeaseRenewWorker %q %q) after lock", handle.LockName, handle.UUID)
 
@@ -139,11 +348,15 @@ func (l *DistributedLocker) runLeaseRenewWorker(handle lockgate.LockHandle, opts
 		desc := &LeaseRenewWorkerDescriptor{
 			DoneChan:           make(chan struct{}, 0),
 			SharedLeaseCounter: 1,
+			Shared:             opts.Shared,
+			opts:               opts,
 		}
 		l.leaseRenewWorkers[handle.UUID] = desc
+		l.putJournalEntry(handle, desc)
 		go l.leaseRenewWorker(handle, opts, desc.DoneChan)
 	} else {
 		desc.SharedLeaseCounter++
+		l.putJournalEntry(handle, desc)
 	}
 }
 
@@ -152,12 +365,37 @@ func (l *DistributedLocker) leaseRenewWorker(handle lockgate.LockHandle, opts lo
 	defer ticker.Stop()
 
 	var lastRenewAt time.Time
+	var isPreemptNotified bool
+
+	var holdDeadline time.Time
+	var isHoldDeadlineWarned bool
+	holdDeadlineWarningPeriod := opts.HoldDeadlineWarningPeriod
+	if holdDeadlineWarningPeriod == 0 {
+		holdDeadlineWarningPeriod = DefaultHoldDeadlineWarningPeriodSeconds * time.Second
+	}
+	if opts.OnHoldDeadlineWarningFunc != nil {
+		// Hold deadline could be limited by the server-wide cap, so get the actual deadline of the lease
+		if info, err := l.Backend.GetLockInfo(handle.LockName); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: unable to get hold deadline of lock %q: %s\n", handle.LockName, err)
+		} else {
+			holdDeadline = info.HoldDeadline
+		}
+	}
 
 	for {
 		select {
 		case <-ticker.C:
 			debug("(leaseRenewWorker %q %q) tick!", handle.LockName, handle.UUID)
 
+			if !holdDeadline.IsZero() && !isHoldDeadlineWarned && time.Until(holdDeadline) <= holdDeadlineWarningPeriod {
+				isHoldDeadlineWarned = true
+				go func() {
+					if err := opts.OnHoldDeadlineWarningFunc(handle, holdDeadline); err != nil {
+						fmt.Fprintf(os.Stderr, "ERROR: hold deadline warning handler error: %s\n", err)
+					}
+				}()
+			}
+
 			// Throttle lease renew procedure, do not renew lease more than once in distributedLockLeaseRenewPeriodSeconds seconds period
 			if time.Now().Sub(lastRenewAt) < DistributedLockLeaseRenewPeriodSeconds*time.Second {
 				debug("(leaseRenewWorker %q %q) skip, last lease renew was at %s", handle.LockName, handle.UUID, lastRenewAt.String())
@@ -171,8 +409,38 @@ func (l *DistributedLocker) leaseRenewWorker(handle lockgate.LockHandle, opts lo
 
 			debug("(leaseRenewWorker %q %q) do lease renew", handle.LockName, handle.UUID)
 
-			if err := l.Backend.RenewLease(handle); IsErrLockAlreadyLeased(err) || IsErrNoExistingLockLeaseFound(err) {
-				fmt.Fprintf(os.Stderr, "ERROR: lost lease %s for lock %q\n", handle.UUID, handle.LockName)
+			if err := l.Backend.RenewLease(handle); IsErrLeasePreempted(err) {
+				lastRenewAt = time.Now()
+
+				if !isPreemptNotified {
+					isPreemptNotified = true
+					debug("(leaseRenewWorker %q %q) lease preempted", handle.LockName, handle.UUID)
+					// The handler is expected to release the lock, which waits for this worker to stop
+					if opts.OnPreemptFunc != nil {
+						go func() {
+							if err := opts.OnPreemptFunc(handle); err != nil {
+								fmt.Fprintf(os.Stderr, "ERROR: preempt handler error: %s\n", err)
+							}
+						}()
+					}
+				}
+			} else if IsErrLockAlreadyLeased(err) || IsErrNoExistingLockLeaseFound(err) || IsErrHoldDeadlineExceeded(err) {
+				l.mux.Lock()
+				_, isActive := l.leaseRenewWorkers[handle.UUID]
+				delete(l.leaseRenewWorkers, handle.UUID)
+				if isActive {
+					l.deleteJournalEntry(handle)
+				}
+				l.mux.Unlock()
+
+				if !isActive {
+					// Lease has been released meanwhile, wait for the stop signal
+					<-doneChan
+					return
+				}
+
+				fmt.Fprintf(os.Stderr, "ERROR: lost lease %s for lock %q: %s\n", handle.UUID, handle.LockName, err)
+				l.flushJournal()
 				if opts.OnLostLeaseFunc != nil {
 					if err := opts.OnLostLeaseFunc(handle); err != nil {
 						fmt.Fprintf(os.Stderr, "ERROR: lost lease handler error: %s\n", err)
@@ -205,6 +473,17 @@ func (l *DistributedLocker) isLeaseRenewWorkerActive(handle lockgate.LockHandle)
 	return hasKey
 }
 
+// getLeaseRenewWorkerOptions returns the acquire options of the running lease renew worker, so that the worker can be restarted.
+func (l *DistributedLocker) getLeaseRenewWorkerOptions(handle lockgate.LockHandle) (lockgate.AcquireOptions, bool) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if desc, hasKey := l.leaseRenewWorkers[handle.UUID]; hasKey {
+		return desc.opts, true
+	}
+	return lockgate.AcquireOptions{}, false
+}
+
 func (l *DistributedLocker) stopLeaseRenewWorker(handle lockgate.LockHandle) error {
 	debug("(stopLeaseRenewWorker %q %q) before lock", handle.LockName, handle.UUID)
 	l.mux.Lock()
@@ -214,6 +493,7 @@ func (l *DistributedLocker) stopLeaseRenewWorker(handle lockgate.LockHandle) err
 		if isLocked {
 			l.mux.Unlock()
 			isLocked = false
+			l.flushJournal()
 		}
 	}
 	defer unlockFunc()
@@ -225,6 +505,7 @@ func (l *DistributedLocker) stopLeaseRenewWorker(handle lockgate.LockHandle) err
 		desc.SharedLeaseCounter--
 		if desc.SharedLeaseCounter == 0 {
 			delete(l.leaseRenewWorkers, handle.UUID)
+			l.deleteJournalEntry(handle)
 			unlockFunc()
 
 			debug("(stopLeaseRenewWorker %q %q) before DoneChan signal", handle.LockName, handle.UUID)
@@ -232,8 +513,118 @@ func (l *DistributedLocker) stopLeaseRenewWorker(handle lockgate.LockHandle) err
 			debug("(stopLeaseRenewWorker %q %q) after DoneChan signal, before DoneChan close", handle.LockName, handle.UUID)
 			close(desc.DoneChan)
 			debug("(stopLeaseRenewWorker %q %q) after DoneChan close", handle.LockName, handle.UUID)
+		} else {
+			l.putJournalEntry(handle, desc)
 		}
 	}
 
 	return nil
 }
+
+func (l *DistributedLocker) recoverJournal(journal *HandleJournal, opts HandleJournalOptions) (*HandleJournalRecoveryReport, error) {
+	entries, err := journal.List()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &HandleJournalRecoveryReport{}
+	backendId := GetBackendId(l.Backend)
+
+	for _, entry := range entries {
+		handle := entry.Token.LockHandle()
+		debug("(recoverJournal %q %q) entry=%#v", handle.LockName, handle.UUID, entry)
+
+		if entry.Token.Backend != backendId {
+			return nil, fmt.Errorf("handle journal %s entry for lock %q belongs to the backend %q, expected %q", journal.Path, handle.LockName, entry.Token.Backend, backendId)
+		}
+
+		if opts.Resume {
+			if err := l.Backend.RenewLease(handle); IsErrLockAlreadyLeased(err) || IsErrNoExistingLockLeaseFound(err) || IsErrHoldDeadlineExceeded(err) {
+				report.Lost = append(report.Lost, handle)
+			} else if err != nil && !IsErrLeasePreempted(err) {
+				return nil, err
+			} else {
+				for i := int64(0); i < entry.SharedLeaseCounter; i++ {
+					l.runLeaseRenewWorker(handle, lockgate.AcquireOptions{Shared: entry.Token.Shared, OnLostLeaseFunc: opts.OnLostLeaseFunc})
+				}
+				report.Recovered = append(report.Recovered, handle)
+				continue
+			}
+		} else {
+			for i := int64(0); i < entry.SharedLeaseCounter; i++ {
+				if err := l.Backend.Release(handle); IsErrLockAlreadyLeased(err) || IsErrNoExistingLockLeaseFound(err) {
+					report.Lost = append(report.Lost, handle)
+					break
+				} else if err != nil {
+					return nil, err
+				} else if i == entry.SharedLeaseCounter-1 {
+					report.Released = append(report.Released, handle)
+				}
+			}
+		}
+
+		if err := journal.Delete(handle); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// putJournalEntry records the entry of the handle into the journal, the caller holds mux.
+func (l *DistributedLocker) putJournalEntry(handle lockgate.LockHandle, desc *LeaseRenewWorkerDescriptor) {
+	if l.Journal == nil {
+		return
+	}
+
+	l.setJournalChange(&HandleJournalEntry{
+		Token:              l.newLockHandleToken(handle, desc.Shared),
+		SharedLeaseCounter: desc.SharedLeaseCounter,
+	})
+}
+
+// deleteJournalEntry removes the entry of the handle from the journal, the caller holds mux.
+func (l *DistributedLocker) deleteJournalEntry(handle lockgate.LockHandle) {
+	if l.Journal == nil {
+		return
+	}
+
+	// Entry without leases is removed from the journal
+	l.setJournalChange(&HandleJournalEntry{Token: l.newLockHandleToken(handle, false)})
+}
+
+func (l *DistributedLocker) setJournalChange(entry *HandleJournalEntry) {
+	if l.journalChanges == nil {
+		l.journalChanges = make(map[string]*HandleJournalEntry)
+	}
+	l.journalChanges[entry.Token.UUID] = entry
+}
+
+// flushJournal writes the changes of the journal gathered under mux, the caller should not hold mux,
+// so that acquisitions and releases of other locks never wait for the disk.
+// Changes are taken under journalMux, so that the later change of the handle is never overwritten by the earlier one.
+func (l *DistributedLocker) flushJournal() {
+	if l.Journal == nil {
+		return
+	}
+
+	l.journalMux.Lock()
+	defer l.journalMux.Unlock()
+
+	l.mux.Lock()
+	changes := l.journalChanges
+	l.journalChanges = nil
+	l.mux.Unlock()
+
+	for _, entry := range changes {
+		handle := entry.Token.LockHandle()
+
+		if entry.SharedLeaseCounter == 0 {
+			if err := l.Journal.Delete(handle); err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: unable to remove lease %s for lock %q from the handle journal: %s\n", handle.UUID, handle.LockName, err)
+			}
+		} else if err := l.Journal.Put(entry); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: unable to record lease %s for lock %q into the handle journal: %s\n", handle.UUID, handle.LockName, err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package distributed_locker
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,12 +15,16 @@ const (
 	DistributedLockPollRetryPeriodSeconds          = 2
 	DistributedOptimisticLockingRetryPeriodSeconds = 1
 	DistributedLockLeaseRenewPeriodSeconds         = 3
+	DefaultPreemptGracePeriodSeconds               = 30
+	DefaultHoldDeadlineWarningPeriodSeconds        = 60
 )
 
 var (
 	ErrShouldWait               = errors.New("should wait")
 	ErrLockAlreadyLeased        = errors.New("lock already leased")
 	ErrNoExistingLockLeaseFound = errors.New("no existing lock lease found")
+	ErrLeasePreempted           = errors.New("lease preempted")
+	ErrHoldDeadlineExceeded     = errors.New("lease max hold duration exceeded")
 )
 
 func IsErrShouldWait(err error) bool {
@@ -43,31 +48,203 @@ func IsErrNoExistingLockLeaseFound(err error) bool {
 	return err.Error() == ErrNoExistingLockLeaseFound.Error()
 }
 
+// IsErrLeasePreempted returns true when the lease has been renewed, but an acquirer with higher priority
+// requested the preemptible holder to release the lock within the grace period.
+func IsErrLeasePreempted(err error) bool {
+	if err == nil {
+		return false
+	}
+	return err.Error() == ErrLeasePreempted.Error()
+}
+
+// IsErrLockDrained returns true when new acquisitions of the lock are stopped by the drain, see DrainBackend.
+func IsErrLockDrained(err error) bool {
+	if err == nil {
+		return false
+	}
+	return err.Error() == lockgate.ErrLockDrained.Error()
+}
+
+func IsErrHoldDeadlineExceeded(err error) bool {
+	if err == nil {
+		return false
+	}
+	return err.Error() == ErrHoldDeadlineExceeded.Error()
+}
+
+// IsErrLockReserved returns true when the lock is reserved for another owner at the moment, see ReservationBackend.
+func IsErrLockReserved(err error) bool {
+	if err == nil {
+		return false
+	}
+	return err.Error() == lockgate.ErrLockReserved.Error()
+}
+
 type DistributedLockerBackend interface {
 	Acquire(lockName string, opts AcquireOptions) (lockgate.LockHandle, error)
 	RenewLease(handle lockgate.LockHandle) error
 	Release(handle lockgate.LockHandle) error
+	LeaveQueue(lockName, acquirerId string) error
+	AcquireAny(lockNames []string, opts AcquireOptions) (lockgate.LockHandle, error)
+	LeaveQueueAny(lockNames []string, acquirerId string) error
+	GetLockInfo(lockName string) (*lockgate.LockInfo, error)
+	SetPayload(handle lockgate.LockHandle, payload []byte) error
+	GetPayload(lockName string) ([]byte, error)
+}
+
+// BackendIdentifier is implemented by backends which are able to identify the storage of locks,
+// so that exported lock handles are adopted only by the lockers using the same storage.
+type BackendIdentifier interface {
+	BackendId() string
+}
+
+func GetBackendId(backend DistributedLockerBackend) string {
+	if identifier, ok := backend.(BackendIdentifier); ok {
+		return identifier.BackendId()
+	}
+	return fmt.Sprintf("%T", backend)
 }
 
 type AcquireOptions struct {
-	Shared     bool   `json:"shared"`
-	AcquirerId string `json:"acquirerId"`
+	Shared                    bool   `json:"shared"`
+	AcquirerId                string `json:"acquirerId"`
+	Priority                  int    `json:"priority,omitempty"`
+	Preemptible               bool   `json:"preemptible,omitempty"`
+	PreemptGracePeriodSeconds int64  `json:"preemptGracePeriodSeconds,omitempty"`
+	WaitIfDrained             bool   `json:"waitIfDrained,omitempty"`
+	MaxHoldDurationSeconds    int64  `json:"maxHoldDurationSeconds,omitempty"`
+	WaitIfReserved            bool   `json:"waitIfReserved,omitempty"`
+
+	// inPoolQueue is set by AcquireAny for the acquirer waiting in the queue of the pool,
+	// such acquirer does not take places in the queues of the locks of the pool
+	inPoolQueue bool
+}
+
+// queueMemberId returns the id of the acquirer in the wait queue of the lock, empty when the acquirer does not wait in the queue.
+func (opts AcquireOptions) queueMemberId() string {
+	if opts.inPoolQueue {
+		return ""
+	}
+	return opts.AcquirerId
+}
+
+func NewAcquireOptions(opts lockgate.AcquireOptions) AcquireOptions {
+	res := AcquireOptions{
+		Shared:         opts.Shared,
+		AcquirerId:     opts.AcquirerId,
+		Priority:       opts.Priority,
+		Preemptible:    opts.Preemptible,
+		WaitIfDrained:  opts.WaitIfDrained,
+		WaitIfReserved: opts.WaitIfReserved,
+	}
+	if opts.MaxHoldDuration != 0 {
+		// Round up, so that the lease is never limited to zero seconds
+		res.MaxHoldDurationSeconds = int64((opts.MaxHoldDuration + time.Second - 1) / time.Second)
+	}
+	if opts.Preemptible {
+		res.PreemptGracePeriodSeconds = int64(opts.PreemptGracePeriod.Seconds())
+		if res.PreemptGracePeriodSeconds == 0 {
+			res.PreemptGracePeriodSeconds = DefaultPreemptGracePeriodSeconds
+		}
+	}
+	return res
 }
 
 type LockLeaseRecord struct {
 	lockgate.LockHandle
+	HolderId           string `json:",omitempty"`
+	Payload            []byte `json:",omitempty"`
 	ExpireAtTimestamp  int64
 	SharedHoldersCount int64
 	IsShared           bool
 	QueueMembers       map[string]*QueueMember
+
+	Priority                    int   `json:",omitempty"`
+	Preemptible                 bool  `json:",omitempty"`
+	PreemptGracePeriodSeconds   int64 `json:",omitempty"`
+	PreemptRequestedAtTimestamp int64 `json:",omitempty"`
+	PreemptDeadlineTimestamp    int64 `json:",omitempty"`
+
+	HoldDeadlineTimestamp int64 `json:",omitempty"`
+
+	// Cond is the state of the condition variable of the lock, which outlives the lease
+	// and is removed when no waiters are left.
+	Cond *CondRecord `json:",omitempty"`
 }
 
 type QueueMember struct {
 	AcquirerId          string
 	AcquiredAtTimestamp int64
 	ExpireAtTimestamp   int64
+	Priority            int `json:",omitempty"`
+}
+
+// IsAheadOf returns true if the member should take the lock before the other member:
+// members with higher priority go first, members with the same priority are ordered by the time of arrival.
+func (member *QueueMember) IsAheadOf(other *QueueMember) bool {
+	if member.Priority != other.Priority {
+		return member.Priority > other.Priority
+	}
+	if member.AcquiredAtTimestamp != other.AcquiredAtTimestamp {
+		return member.AcquiredAtTimestamp < other.AcquiredAtTimestamp
+	}
+	return member.AcquirerId < other.AcquirerId
+}
+
+// IsRevoked returns true if the preemptible holder has not released the lock within the grace period,
+// which starts when the holder gets notified about the preemption on the lease renew,
+// or if the lease not renewed in time has been revoked by the lock controller.
+func (lease *LockLeaseRecord) IsRevoked(now time.Time) bool {
+	if lease.PreemptDeadlineTimestamp == 0 {
+		return false
+	}
+	return now.After(time.Unix(lease.PreemptDeadlineTimestamp, 0))
+}
+
+func (lease *LockLeaseRecord) IsHoldDeadlineExceeded(now time.Time) bool {
+	return lease.HoldDeadlineTimestamp != 0 && !now.Before(time.Unix(lease.HoldDeadlineTimestamp, 0))
+}
+
+// IsActive returns true if the lease is neither expired nor revoked.
+func (lease *LockLeaseRecord) IsActive(now time.Time) bool {
+	return !now.After(time.Unix(lease.ExpireAtTimestamp, 0)) && !lease.IsRevoked(now) && !lease.IsHoldDeadlineExceeded(now)
+}
+
+// setHolder resets the lease attributes of the previous holder.
+func (lease *LockLeaseRecord) setHolder(opts AcquireOptions) {
+	lease.HolderId = opts.AcquirerId
+	lease.Payload = nil
+	lease.Priority = opts.Priority
+	lease.Preemptible = opts.Preemptible
+	lease.PreemptGracePeriodSeconds = opts.PreemptGracePeriodSeconds
+	lease.PreemptRequestedAtTimestamp = 0
+	lease.PreemptDeadlineTimestamp = 0
+
+	lease.HoldDeadlineTimestamp = 0
+	if opts.MaxHoldDurationSeconds != 0 {
+		lease.HoldDeadlineTimestamp = time.Now().Unix() + opts.MaxHoldDurationSeconds
+	}
+}
+
+// joinHolder merges the attributes of the shared holder joining the lease conservatively: the lease stays
+// preemptible only if all holders are preemptible, and the earliest hold deadline of the holders applies to the lease.
+func (lease *LockLeaseRecord) joinHolder(opts AcquireOptions) {
+	if !opts.Preemptible {
+		lease.Preemptible = false
+	} else if opts.PreemptGracePeriodSeconds > lease.PreemptGracePeriodSeconds {
+		lease.PreemptGracePeriodSeconds = opts.PreemptGracePeriodSeconds
+	}
+
+	if opts.MaxHoldDurationSeconds != 0 {
+		holdDeadline := time.Now().Unix() + opts.MaxHoldDurationSeconds
+		if lease.HoldDeadlineTimestamp == 0 || holdDeadline < lease.HoldDeadlineTimestamp {
+			lease.HoldDeadlineTimestamp = holdDeadline
+		}
+	}
 }
 
+// NewLockLeaseRecord creates a new lease of the lock, the lease gets the next fencing token of the lock
+// when it is put into the store value by SetLockLeaseIntoStoreValue.
 func NewLockLeaseRecord(lockName string, isShared bool) *LockLeaseRecord {
 	return &LockLeaseRecord{
 		LockHandle:         lockgate.LockHandle{UUID: uuid.New().String(), LockName: lockName},
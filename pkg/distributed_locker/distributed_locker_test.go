@@ -0,0 +1,104 @@
+package distributed_locker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/werf/lockgate"
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+)
+
+func newInMemoryLocker() (*DistributedLocker, *OptimisticLockingStorageBasedBackend) {
+	backend := NewOptimisticLockingStorageBasedBackend(optimistic_locking_store.NewInMemoryStore())
+	return NewDistributedLocker(backend), backend
+}
+
+func getTestLease(t *testing.T, backend *OptimisticLockingStorageBasedBackend, lockName string) *LockLeaseRecord {
+	t.Helper()
+
+	value, err := backend.Store.GetValue(backend.keyName(lockName))
+	if err != nil {
+		t.Fatalf("get value: %s", err)
+	}
+	lease, err := ExtractLockLeaseFromStoreValue(value)
+	if err != nil {
+		t.Fatalf("extract lease: %s", err)
+	}
+	return lease
+}
+
+// changeTestLease changes the current lease of the lock regardless of the holder, e.g. to expire the lease.
+func changeTestLease(t *testing.T, backend *OptimisticLockingStorageBasedBackend, lockName string, changeFunc func(lease *LockLeaseRecord)) {
+	t.Helper()
+
+	if err := backend.changeLockLeaseRecord(lockName, func(value *optimistic_locking_store.Value, currentLease *LockLeaseRecord) (bool, error) {
+		if currentLease == nil {
+			return false, ErrNoExistingLockLeaseFound
+		}
+		changeFunc(currentLease)
+		SetLockLeaseIntoStoreValue(currentLease, value)
+		return true, nil
+	}); err != nil {
+		t.Fatalf("change lease: %s", err)
+	}
+}
+
+func acquireTestLock(t *testing.T, locker lockgate.Locker, lockName string, opts lockgate.AcquireOptions) lockgate.LockHandle {
+	t.Helper()
+
+	acquired, handle, err := locker.Acquire(lockName, opts)
+	if err != nil {
+		t.Fatalf("acquire %q: %s", lockName, err)
+	}
+	if !acquired {
+		t.Fatalf("lock %q is not acquired", lockName)
+	}
+	return handle
+}
+
+func TestDistributedLocker_FencingToken(t *testing.T) {
+	locker, backend := newInMemoryLocker()
+
+	handle := acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{})
+	if handle.FencingToken <= 0 {
+		t.Fatalf("got fencing token %d, expected a positive token", handle.FencingToken)
+	}
+	prevToken := handle.FencingToken
+
+	// Lease record is removed on release, the next lease still gets the greater token
+	if err := locker.Release(handle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+	if lease := getTestLease(t, backend, "mylock"); lease != nil {
+		t.Fatalf("lease should be removed on release, got %#v", lease)
+	}
+
+	handle = acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{})
+	if handle.FencingToken <= prevToken {
+		t.Errorf("got fencing token %d after re-acquire, expected greater than %d", handle.FencingToken, prevToken)
+	}
+	prevToken = handle.FencingToken
+
+	// Expired lease is taken over by another acquirer with the greater token
+	if err := locker.Detach(handle); err != nil {
+		t.Fatalf("detach: %s", err)
+	}
+	changeTestLease(t, backend, "mylock", func(lease *LockLeaseRecord) {
+		lease.ExpireAtTimestamp = time.Now().Unix() - 1
+	})
+
+	handle = acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{AcquirerId: "next"})
+	if handle.FencingToken <= prevToken {
+		t.Errorf("got fencing token %d after take over, expected greater than %d", handle.FencingToken, prevToken)
+	}
+	if err := locker.Release(handle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+
+	// Shared holders of the same lease share the token
+	firstHandle := acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{Shared: true})
+	secondHandle := acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{Shared: true})
+	if firstHandle.FencingToken != secondHandle.FencingToken || firstHandle.FencingToken <= handle.FencingToken {
+		t.Errorf("got fencing tokens %d and %d of the shared lease, expected the same token greater than %d", firstHandle.FencingToken, secondHandle.FencingToken, handle.FencingToken)
+	}
+}
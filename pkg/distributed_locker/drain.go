@@ -0,0 +1,47 @@
+package distributed_locker
+
+import (
+	"strings"
+	"time"
+)
+
+// DrainBackend is implemented by backends which allow stopping new acquisitions of locks before maintenance.
+// Current holders of drained locks keep their leases until release.
+type DrainBackend interface {
+	SetDrain(drain *Drain) error
+	LiftDrain(pattern string) error
+	ListDrains() ([]*Drain, error)
+}
+
+// Drain stops new acquisitions of the locks matching the pattern: either the exact lock name
+// or the prefix of lock names ending with "*" (for example "deploy/*").
+type Drain struct {
+	Pattern            string `json:"pattern"`
+	Reason             string `json:"reason,omitempty"`
+	CreatedAtTimestamp int64  `json:"createdAtTimestamp"`
+	// Drain is lifted automatically at the specified time, zero means the drain never expires.
+	ExpireAtTimestamp int64 `json:"expireAtTimestamp,omitempty"`
+}
+
+func NewDrain(pattern, reason string, expireAt time.Time) *Drain {
+	drain := &Drain{
+		Pattern:            pattern,
+		Reason:             reason,
+		CreatedAtTimestamp: time.Now().Unix(),
+	}
+	if !expireAt.IsZero() {
+		drain.ExpireAtTimestamp = expireAt.Unix()
+	}
+	return drain
+}
+
+func (drain *Drain) Matches(lockName string) bool {
+	if prefix, isPrefix := strings.CutSuffix(drain.Pattern, "*"); isPrefix {
+		return strings.HasPrefix(lockName, prefix)
+	}
+	return lockName == drain.Pattern
+}
+
+func (drain *Drain) IsExpired(now time.Time) bool {
+	return drain.ExpireAtTimestamp != 0 && now.After(time.Unix(drain.ExpireAtTimestamp, 0))
+}
@@ -0,0 +1,129 @@
+package distributed_locker
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/werf/lockgate"
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+)
+
+// recordingStore records the keys read from the store, the store does not implement ValuesGetter.
+type recordingStore struct {
+	*optimistic_locking_store.InMemoryStore
+
+	mux      sync.Mutex
+	readKeys map[string]int
+}
+
+func newRecordingStore() *recordingStore {
+	return &recordingStore{InMemoryStore: optimistic_locking_store.NewInMemoryStore(), readKeys: make(map[string]int)}
+}
+
+func (store *recordingStore) GetValue(key string) (*optimistic_locking_store.Value, error) {
+	store.mux.Lock()
+	store.readKeys[key]++
+	store.mux.Unlock()
+
+	return store.InMemoryStore.GetValue(key)
+}
+
+func (store *recordingStore) reset() map[string]int {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	readKeys := store.readKeys
+	store.readKeys = make(map[string]int)
+	return readKeys
+}
+
+// valuesGetterStore reads all records in one call like the stores keeping records together.
+type valuesGetterStore struct {
+	*optimistic_locking_store.InMemoryStore
+}
+
+func (store valuesGetterStore) GetValues(keys []string) ([]*optimistic_locking_store.Value, error) {
+	var values []*optimistic_locking_store.Value
+	for _, key := range keys {
+		value, err := store.GetValue(key)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func TestAcquire_DrainedAndReservedLocks(t *testing.T) {
+	for _, store := range []optimistic_locking_store.OptimisticLockingStore{
+		optimistic_locking_store.NewInMemoryStore(),
+		valuesGetterStore{InMemoryStore: optimistic_locking_store.NewInMemoryStore()},
+	} {
+		t.Run(fmt.Sprintf("%T", store), func(t *testing.T) {
+			backend := NewOptimisticLockingStorageBasedBackend(store)
+			locker := NewDistributedLocker(backend)
+
+			if err := backend.SetDrain(NewDrain("drained", "maintenance", time.Time{})); err != nil {
+				t.Fatalf("set drain: %s", err)
+			}
+			if _, err := backend.Reserve("reserved", time.Now().Add(-time.Minute), time.Now().Add(time.Hour), "owner"); err != nil {
+				t.Fatalf("reserve: %s", err)
+			}
+
+			if _, _, err := locker.Acquire("drained", lockgate.AcquireOptions{}); err != lockgate.ErrLockDrained {
+				t.Errorf("got %v, expected %v", err, lockgate.ErrLockDrained)
+			}
+			if acquired, _, err := locker.Acquire("drained", lockgate.AcquireOptions{WaitIfDrained: true, NonBlocking: true}); err != nil || acquired {
+				t.Errorf("got acquired=%v err=%v, expected the drained lock not acquired", acquired, err)
+			}
+
+			if _, _, err := locker.Acquire("reserved", lockgate.AcquireOptions{AcquirerId: "other"}); err != lockgate.ErrLockReserved {
+				t.Errorf("got %v, expected %v", err, lockgate.ErrLockReserved)
+			}
+			handle := acquireTestLock(t, locker, "reserved", lockgate.AcquireOptions{AcquirerId: "owner"})
+			if err := locker.Release(handle); err != nil {
+				t.Fatalf("release: %s", err)
+			}
+
+			handle = acquireTestLock(t, locker, "free", lockgate.AcquireOptions{})
+			if err := locker.Release(handle); err != nil {
+				t.Fatalf("release: %s", err)
+			}
+		})
+	}
+}
+
+func TestAcquire_HeldLockReadsOnlyLease(t *testing.T) {
+	store := newRecordingStore()
+	backend := NewOptimisticLockingStorageBasedBackend(store)
+	locker := NewDistributedLocker(backend)
+
+	handle := acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{})
+	if readKeys := store.reset(); readKeys[backend.drainsKeyName()] == 0 || readKeys[backend.reservationsKeyName("mylock")] == 0 {
+		t.Errorf("got keys %v read to take the lock, expected drains and reservations checked", readKeys)
+	}
+
+	// Waiters polling the held lock read the lease only
+	for i := 0; i < 3; i++ {
+		if acquired, _, err := locker.Acquire("mylock", lockgate.AcquireOptions{NonBlocking: true}); err != nil || acquired {
+			t.Fatalf("got acquired=%v err=%v, expected the held lock not acquired", acquired, err)
+		}
+	}
+	readKeys := store.reset()
+	if readKeys[backend.drainsKeyName()] != 0 || readKeys[backend.reservationsKeyName("mylock")] != 0 {
+		t.Errorf("got keys %v read by waiters, expected only the lease read", readKeys)
+	}
+
+	// The drain is reported once the lock could be taken
+	if err := backend.SetDrain(NewDrain("mylock", "maintenance", time.Time{})); err != nil {
+		t.Fatalf("set drain: %s", err)
+	}
+	if err := locker.Release(handle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+	if _, _, err := locker.Acquire("mylock", lockgate.AcquireOptions{NonBlocking: true}); err != lockgate.ErrLockDrained {
+		t.Errorf("got %v, expected %v", err, lockgate.ErrLockDrained)
+	}
+}
@@ -0,0 +1,151 @@
+package distributed_locker
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+
+	"github.com/werf/lockgate"
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+)
+
+// newEmbeddedEtcdClient starts the single member etcd server in the temporary dir and returns the client connected to it.
+func newEmbeddedEtcdClient(t *testing.T) *clientv3.Client {
+	t.Helper()
+
+	localURL, _ := url.Parse("http://127.0.0.1:0")
+
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	cfg.ListenClientUrls = []url.URL{*localURL}
+	cfg.AdvertiseClientUrls = []url.URL{*localURL}
+	cfg.ListenPeerUrls = []url.URL{*localURL}
+	cfg.AdvertisePeerUrls = []url.URL{*localURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	server, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("start etcd: %s", err)
+	}
+	t.Cleanup(server.Close)
+
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		t.Fatalf("etcd server is not ready")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{server.Clients[0].Addr().String()},
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("connect to etcd: %s", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+func TestEtcdLocker_WaitersWatchRelease(t *testing.T) {
+	client := newEmbeddedEtcdClient(t)
+
+	getRevision := func() int64 {
+		t.Helper()
+
+		resp, err := client.Get(context.Background(), "/test/")
+		if err != nil {
+			t.Fatalf("get etcd revision: %s", err)
+		}
+		return resp.Header.Revision
+	}
+
+	holderLocker := NewEtcdLocker(client, "/test/")
+	_, holderHandle, err := holderLocker.Acquire("mylock", lockgate.AcquireOptions{AcquirerId: "holder"})
+	if err != nil {
+		t.Fatalf("acquire: %s", err)
+	}
+
+	type acquireResult struct {
+		locker *DistributedLocker
+		handle lockgate.LockHandle
+		err    error
+	}
+	acquiredChan := make(chan acquireResult)
+	for i := 0; i < 2; i++ {
+		locker := NewEtcdLocker(client, "/test/")
+		acquirerId := fmt.Sprintf("waiter-%d", i)
+		go func() {
+			_, handle, err := locker.Acquire("mylock", lockgate.AcquireOptions{AcquirerId: acquirerId, Timeout: time.Minute})
+			acquiredChan <- acquireResult{locker, handle, err}
+		}()
+	}
+
+	// Waiters rewrite the record on each poll, which should not wake up other waiters
+	time.Sleep(time.Second)
+	startRevision := getRevision()
+	time.Sleep(2 * DistributedLockPollRetryPeriodSeconds * time.Second)
+	if writes := getRevision() - startRevision; writes > 10 {
+		t.Errorf("expected a few writes by polls of waiters, got %d writes", writes)
+	}
+
+	releasedAt := time.Now()
+	if err := holderLocker.Release(holderHandle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+
+	// Waiters take the lock one after another
+	for i := 0; i < 2; i++ {
+		select {
+		case res := <-acquiredChan:
+			if res.err != nil {
+				t.Fatalf("acquire by waiter: %s", res.err)
+			}
+			if elapsed := time.Since(releasedAt); elapsed >= DistributedLockPollRetryPeriodSeconds*time.Second {
+				t.Errorf("waiter should acquire the lock right after the release, acquired in %s", elapsed)
+			}
+
+			releasedAt = time.Now()
+			if err := res.locker.Release(res.handle); err != nil {
+				t.Fatalf("release: %s", err)
+			}
+		case <-time.After(time.Minute):
+			t.Fatalf("waiter has not acquired the lock")
+		}
+	}
+}
+
+func TestEtcdLocker_WatchReportsReleaseOfObservedLease(t *testing.T) {
+	client := newEmbeddedEtcdClient(t)
+	backend := NewOptimisticLockingStorageBasedBackend(optimistic_locking_store.NewEtcdStore(client, "/test/"))
+
+	handle, _, err := backend.AcquireObserved("mylock", AcquireOptions{AcquirerId: "holder"})
+	if err != nil {
+		t.Fatalf("acquire: %s", err)
+	}
+	_, observedValue, err := backend.AcquireObserved("mylock", AcquireOptions{AcquirerId: "waiter"})
+	if !IsErrShouldWait(err) {
+		t.Fatalf("got %v, expected the waiter to wait", err)
+	}
+
+	stopChan := make(chan struct{})
+	defer close(stopChan)
+	changedChan := backend.WatchLock("mylock", observedValue, stopChan)
+
+	// The lease keeps the UUID when released with the waiter in the queue
+	if err := backend.Release(handle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+
+	select {
+	case <-changedChan:
+	case <-time.After(DistributedLockPollRetryPeriodSeconds * time.Second):
+		t.Fatalf("release of the observed lease is not reported")
+	}
+}
@@ -1,6 +1,10 @@
 package distributed_locker
 
 import (
+	"database/sql"
+
+	"github.com/redis/go-redis/v9"
+	clientv3 "go.etcd.io/etcd/client/v3"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 
@@ -29,3 +33,104 @@ func NewHttpBackendHandlerWithKubernetesStore(kubernetesInterface dynamic.Interf
 	backend := NewOptimisticLockingStorageBasedBackend(store)
 	return NewHttpBackendHandler(backend)
 }
+
+// NewKubernetesLeaseLocker creates a locker which stores each lock in its own Lease object in the namespace.
+func NewKubernetesLeaseLocker(kubernetesInterface dynamic.Interface, namespace string) *DistributedLocker {
+	store := optimistic_locking_store.NewKubernetesLeaseStore(kubernetesInterface, namespace)
+	backend := NewOptimisticLockingStorageBasedBackend(store)
+	return NewDistributedLocker(backend)
+}
+
+func NewHttpBackendHandlerWithKubernetesLeaseStore(kubernetesInterface dynamic.Interface, namespace string) *HttpBackendHandler {
+	store := optimistic_locking_store.NewKubernetesLeaseStore(kubernetesInterface, namespace)
+	backend := NewOptimisticLockingStorageBasedBackend(store)
+	return NewHttpBackendHandler(backend)
+}
+
+// NewKubernetesShardedLocker creates a locker which spreads locks over the annotations of the specified number of ConfigMaps
+// named <resourceNamePrefix>-<N>, missing ConfigMaps are created automatically.
+func NewKubernetesShardedLocker(kubernetesInterface dynamic.Interface, resourceNamePrefix, namespace string, shards int) *DistributedLocker {
+	store := optimistic_locking_store.NewKubernetesShardedAnnotationsStore(kubernetesInterface, resourceNamePrefix, namespace, shards)
+	backend := NewOptimisticLockingStorageBasedBackend(store)
+	return NewDistributedLocker(backend)
+}
+
+func NewHttpBackendHandlerWithKubernetesShardedStore(kubernetesInterface dynamic.Interface, resourceNamePrefix, namespace string, shards int) *HttpBackendHandler {
+	store := optimistic_locking_store.NewKubernetesShardedAnnotationsStore(kubernetesInterface, resourceNamePrefix, namespace, shards)
+	backend := NewOptimisticLockingStorageBasedBackend(store)
+	return NewHttpBackendHandler(backend)
+}
+
+// NewKubernetesConfigMapDataLocker creates a locker which stores locks in the data of the ConfigMap instead of annotations.
+func NewKubernetesConfigMapDataLocker(kubernetesInterface dynamic.Interface, resourceName, namespace string) *DistributedLocker {
+	store := optimistic_locking_store.NewKubernetesConfigMapDataStore(kubernetesInterface, resourceName, namespace)
+	backend := NewOptimisticLockingStorageBasedBackend(store)
+	return NewDistributedLocker(backend)
+}
+
+// NewKubernetesSecretDataLocker creates a locker which stores locks in the data of the Secret.
+func NewKubernetesSecretDataLocker(kubernetesInterface dynamic.Interface, resourceName, namespace string) *DistributedLocker {
+	store := optimistic_locking_store.NewKubernetesSecretDataStore(kubernetesInterface, resourceName, namespace)
+	backend := NewOptimisticLockingStorageBasedBackend(store)
+	return NewDistributedLocker(backend)
+}
+
+// NewKubernetesLockCRDLocker creates a locker which stores each lock in its own Lock custom resource in the namespace.
+func NewKubernetesLockCRDLocker(kubernetesInterface dynamic.Interface, namespace string) *DistributedLocker {
+	store := optimistic_locking_store.NewKubernetesLockStore(kubernetesInterface, namespace)
+	backend := NewOptimisticLockingStorageBasedBackend(store)
+	return NewDistributedLocker(backend)
+}
+
+func NewHttpBackendHandlerWithKubernetesLockCRDStore(kubernetesInterface dynamic.Interface, namespace string) *HttpBackendHandler {
+	store := optimistic_locking_store.NewKubernetesLockStore(kubernetesInterface, namespace)
+	backend := NewOptimisticLockingStorageBasedBackend(store)
+	return NewHttpBackendHandler(backend)
+}
+
+// NewEtcdLocker creates a locker which stores each lock in its own etcd key under the prefix,
+// waiters are notified about releases by etcd watches.
+func NewEtcdLocker(client *clientv3.Client, prefix string) *DistributedLocker {
+	store := optimistic_locking_store.NewEtcdStore(client, prefix)
+	backend := NewOptimisticLockingStorageBasedBackend(store)
+	return NewDistributedLocker(backend)
+}
+
+func NewHttpBackendHandlerWithEtcdStore(client *clientv3.Client, prefix string) *HttpBackendHandler {
+	store := optimistic_locking_store.NewEtcdStore(client, prefix)
+	backend := NewOptimisticLockingStorageBasedBackend(store)
+	return NewHttpBackendHandler(backend)
+}
+
+// NewRedisLocker creates a locker which stores each lock in its own Redis hash under the key prefix.
+func NewRedisLocker(client redis.UniversalClient, prefix string) *DistributedLocker {
+	store := optimistic_locking_store.NewRedisStore(client, prefix)
+	backend := NewOptimisticLockingStorageBasedBackend(store)
+	return NewDistributedLocker(backend)
+}
+
+func NewHttpBackendHandlerWithRedisStore(client redis.UniversalClient, prefix string) *HttpBackendHandler {
+	store := optimistic_locking_store.NewRedisStore(client, prefix)
+	backend := NewOptimisticLockingStorageBasedBackend(store)
+	return NewHttpBackendHandler(backend)
+}
+
+// NewSQLLocker creates a locker which stores each lock in its own row of the "locks" table,
+// the table is created or migrated to the current schema.
+func NewSQLLocker(db *sql.DB, dialect optimistic_locking_store.SQLDialect) (*DistributedLocker, error) {
+	store := optimistic_locking_store.NewSQLStore(db, dialect)
+	if err := store.Migrate(); err != nil {
+		return nil, err
+	}
+	backend := NewOptimisticLockingStorageBasedBackend(store)
+	return NewDistributedLocker(backend), nil
+}
+
+func NewHttpBackendHandlerWithSQLStore(db *sql.DB, dialect optimistic_locking_store.SQLDialect) (*HttpBackendHandler, error) {
+	store := optimistic_locking_store.NewSQLStore(db, dialect)
+	if err := store.Migrate(); err != nil {
+		return nil, err
+	}
+	backend := NewOptimisticLockingStorageBasedBackend(store)
+	return NewHttpBackendHandler(backend), nil
+}
@@ -0,0 +1,129 @@
+package distributed_locker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/werf/lockgate"
+)
+
+// HandleJournal is a file recording outstanding lock handles of the DistributedLocker,
+// which allows a restarted process to resume or release its own leases.
+type HandleJournal struct {
+	Path string
+
+	mux sync.Mutex
+}
+
+type HandleJournalEntry struct {
+	Token              lockgate.LockHandleToken `json:"token"`
+	SharedLeaseCounter int64                    `json:"sharedLeaseCounter"`
+}
+
+type HandleJournalOptions struct {
+	// Resume renews the leases recorded in the journal which still exist, otherwise these leases are released.
+	Resume          bool
+	OnLostLeaseFunc func(lock lockgate.LockHandle) error
+}
+
+type HandleJournalRecoveryReport struct {
+	Recovered []lockgate.LockHandle
+	Released  []lockgate.LockHandle
+	Lost      []lockgate.LockHandle
+}
+
+func NewHandleJournal(path string) *HandleJournal {
+	return &HandleJournal{Path: path}
+}
+
+func (journal *HandleJournal) List() ([]*HandleJournalEntry, error) {
+	journal.mux.Lock()
+	defer journal.mux.Unlock()
+
+	entries, err := journal.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*HandleJournalEntry
+	for _, entry := range entries {
+		res = append(res, entry)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Token.UUID < res[j].Token.UUID
+	})
+
+	return res, nil
+}
+
+func (journal *HandleJournal) Put(entry *HandleJournalEntry) error {
+	journal.mux.Lock()
+	defer journal.mux.Unlock()
+
+	entries, err := journal.read()
+	if err != nil {
+		return err
+	}
+	entries[entry.Token.UUID] = entry
+
+	return journal.write(entries)
+}
+
+func (journal *HandleJournal) Delete(handle lockgate.LockHandle) error {
+	journal.mux.Lock()
+	defer journal.mux.Unlock()
+
+	entries, err := journal.read()
+	if err != nil {
+		return err
+	}
+	if _, hasKey := entries[handle.UUID]; !hasKey {
+		return nil
+	}
+	delete(entries, handle.UUID)
+
+	return journal.write(entries)
+}
+
+func (journal *HandleJournal) read() (map[string]*HandleJournalEntry, error) {
+	entries := make(map[string]*HandleJournalEntry)
+
+	data, err := os.ReadFile(journal.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read handle journal %s: %s", journal.Path, err)
+	}
+
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal handle journal %s: %s", journal.Path, err)
+	}
+	return entries, nil
+}
+
+func (journal *HandleJournal) write(entries map[string]*HandleJournalEntry) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("unable to marshal handle journal: %s", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(journal.Path), 0o755); err != nil {
+		return fmt.Errorf("unable to create dir %s: %s", filepath.Dir(journal.Path), err)
+	}
+
+	// Write into a temporary file and rename to keep the journal consistent in the case of crash
+	tmpPath := fmt.Sprintf("%s.tmp", journal.Path)
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("unable to write handle journal %s: %s", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, journal.Path); err != nil {
+		return fmt.Errorf("unable to rename %s to %s: %s", tmpPath, journal.Path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package distributed_locker
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/werf/lockgate"
+)
+
+// crashTestLocker stops renewing the leases of the locker as if the process has crashed, the journal is kept as is.
+func crashTestLocker(t *testing.T, locker *DistributedLocker, handles ...lockgate.LockHandle) {
+	t.Helper()
+
+	locker.Journal = nil
+	for _, handle := range handles {
+		if err := locker.Detach(handle); err != nil {
+			t.Fatalf("detach: %s", err)
+		}
+	}
+}
+
+func TestHandleJournal_Resume(t *testing.T) {
+	_, backend := newInMemoryLocker()
+	journalPath := filepath.Join(t.TempDir(), "journal.json")
+
+	locker, report, err := NewDistributedLockerWithJournal(backend, NewHandleJournal(journalPath), HandleJournalOptions{Resume: true})
+	if err != nil {
+		t.Fatalf("new locker: %s", err)
+	}
+	if len(report.Recovered)+len(report.Released)+len(report.Lost) != 0 {
+		t.Fatalf("empty journal should recover nothing, got %#v", report)
+	}
+
+	sharedHandle := acquireTestLock(t, locker, "shared", lockgate.AcquireOptions{Shared: true})
+	acquireTestLock(t, locker, "shared", lockgate.AcquireOptions{Shared: true})
+	lostHandle := acquireTestLock(t, locker, "lost", lockgate.AcquireOptions{})
+	releasedHandle := acquireTestLock(t, locker, "released", lockgate.AcquireOptions{})
+	if err := locker.Release(releasedHandle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+
+	entries, err := NewHandleJournal(journalPath).List()
+	if err != nil {
+		t.Fatalf("list journal: %s", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d journal entries, expected entries of the held leases only: %#v", len(entries), entries)
+	}
+
+	crashTestLocker(t, locker, sharedHandle, sharedHandle, lostHandle)
+
+	// Lease has been taken by someone else while the process was down
+	if err := backend.Release(lostHandle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+	acquireTestLock(t, NewDistributedLocker(backend), "lost", lockgate.AcquireOptions{})
+
+	restartedLocker, report, err := NewDistributedLockerWithJournal(backend, NewHandleJournal(journalPath), HandleJournalOptions{Resume: true})
+	if err != nil {
+		t.Fatalf("new locker: %s", err)
+	}
+	if len(report.Recovered) != 1 || report.Recovered[0].UUID != sharedHandle.UUID {
+		t.Errorf("got recovered %v, expected the shared lease", report.Recovered)
+	}
+	if len(report.Lost) != 1 || report.Lost[0].UUID != lostHandle.UUID {
+		t.Errorf("got lost %v, expected the taken lease", report.Lost)
+	}
+
+	// Recovered lease is held twice as before the restart
+	for i := 0; i < 2; i++ {
+		if err := restartedLocker.Release(sharedHandle); err != nil {
+			t.Fatalf("release %d of the recovered lease: %s", i, err)
+		}
+	}
+	if info, err := restartedLocker.GetLockInfo("shared"); err != nil {
+		t.Fatalf("get lock info: %s", err)
+	} else if info.Held {
+		t.Errorf("recovered lease should be released")
+	}
+
+	if entries, err := NewHandleJournal(journalPath).List(); err != nil {
+		t.Fatalf("list journal: %s", err)
+	} else if len(entries) != 0 {
+		t.Errorf("journal should be empty, got %#v", entries)
+	}
+}
+
+func TestHandleJournal_Release(t *testing.T) {
+	_, backend := newInMemoryLocker()
+	journalPath := filepath.Join(t.TempDir(), "journal.json")
+
+	locker, _, err := NewDistributedLockerWithJournal(backend, NewHandleJournal(journalPath), HandleJournalOptions{})
+	if err != nil {
+		t.Fatalf("new locker: %s", err)
+	}
+	handle := acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{})
+	crashTestLocker(t, locker, handle)
+
+	_, report, err := NewDistributedLockerWithJournal(backend, NewHandleJournal(journalPath), HandleJournalOptions{})
+	if err != nil {
+		t.Fatalf("new locker: %s", err)
+	}
+	if len(report.Released) != 1 || report.Released[0].UUID != handle.UUID {
+		t.Errorf("got released %v, expected the lease of the previous run", report.Released)
+	}
+
+	if info, err := locker.GetLockInfo("mylock"); err != nil {
+		t.Fatalf("get lock info: %s", err)
+	} else if info.Held {
+		t.Errorf("lease of the previous run should be released")
+	}
+	if entries, err := NewHandleJournal(journalPath).List(); err != nil {
+		t.Fatalf("list journal: %s", err)
+	} else if len(entries) != 0 {
+		t.Errorf("journal should be empty, got %#v", entries)
+	}
+}
+
+func TestHandleJournal_ResumeHoldDeadlineExceeded(t *testing.T) {
+	_, backend := newInMemoryLocker()
+	journalPath := filepath.Join(t.TempDir(), "journal.json")
+
+	locker, _, err := NewDistributedLockerWithJournal(backend, NewHandleJournal(journalPath), HandleJournalOptions{Resume: true})
+	if err != nil {
+		t.Fatalf("new locker: %s", err)
+	}
+	handle := acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{MaxHoldDuration: time.Hour})
+	crashTestLocker(t, locker, handle)
+
+	// The hold deadline has passed while the process was down
+	changeTestLease(t, backend, "mylock", func(lease *LockLeaseRecord) {
+		lease.HoldDeadlineTimestamp = time.Now().Unix() - 1
+	})
+
+	_, report, err := NewDistributedLockerWithJournal(backend, NewHandleJournal(journalPath), HandleJournalOptions{Resume: true})
+	if err != nil {
+		t.Fatalf("new locker: %s", err)
+	}
+	if len(report.Lost) != 1 || report.Lost[0].UUID != handle.UUID {
+		t.Errorf("got lost %v, expected the lease past the hold deadline", report.Lost)
+	}
+	if len(report.Recovered) != 0 {
+		t.Errorf("got recovered %v, expected nothing recovered", report.Recovered)
+	}
+}
@@ -0,0 +1,72 @@
+package distributed_locker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/werf/lockgate"
+)
+
+func TestRenewLease_HoldDeadline(t *testing.T) {
+	locker, backend := newInMemoryLocker()
+
+	handle := acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{MaxHoldDuration: time.Hour})
+	if expected := time.Now().Add(time.Hour).Unix(); getTestLease(t, backend, "mylock").HoldDeadlineTimestamp > expected {
+		t.Fatalf("got hold deadline later than %d", expected)
+	}
+
+	// The lease is not renewed past the hold deadline
+	holdDeadline := time.Now().Unix() + 5
+	changeTestLease(t, backend, "mylock", func(lease *LockLeaseRecord) {
+		lease.HoldDeadlineTimestamp = holdDeadline
+	})
+	if err := backend.RenewLease(handle); err != nil {
+		t.Fatalf("renew lease: %s", err)
+	}
+	if lease := getTestLease(t, backend, "mylock"); lease.ExpireAtTimestamp != holdDeadline {
+		t.Errorf("got lease expiration %d, expected the hold deadline %d", lease.ExpireAtTimestamp, holdDeadline)
+	}
+
+	changeTestLease(t, backend, "mylock", func(lease *LockLeaseRecord) {
+		lease.HoldDeadlineTimestamp = time.Now().Unix() - 1
+	})
+	if err := backend.RenewLease(handle); !IsErrHoldDeadlineExceeded(err) {
+		t.Errorf("got %v, expected %v", err, ErrHoldDeadlineExceeded)
+	}
+	if info, err := locker.GetLockInfo("mylock"); err != nil {
+		t.Fatalf("get lock info: %s", err)
+	} else if info.Held {
+		t.Errorf("got the lock held past the hold deadline, expected not held")
+	}
+
+	// The lock is free for other acquirers after the deadline
+	if acquired, _, err := NewDistributedLocker(backend).Acquire("mylock", lockgate.AcquireOptions{AcquirerId: "other", NonBlocking: true}); err != nil {
+		t.Fatalf("acquire: %s", err)
+	} else if !acquired {
+		t.Errorf("got lock not acquired, expected to take the lock past the hold deadline")
+	}
+}
+
+func TestAcquire_ServerMaxHoldDuration(t *testing.T) {
+	locker, backend := newInMemoryLocker()
+	backend.MaxHoldDuration = time.Minute
+
+	// The server-wide cap applies to the acquirer without a hold limit and to the longer limit
+	for _, maxHoldDuration := range []time.Duration{0, time.Hour} {
+		acquireTestLock(t, locker, "capped", lockgate.AcquireOptions{MaxHoldDuration: maxHoldDuration, Shared: true})
+
+		info, err := locker.GetLockInfo("capped")
+		if err != nil {
+			t.Fatalf("get lock info: %s", err)
+		}
+		if info.HoldDeadline.IsZero() || info.HoldDeadline.After(time.Now().Add(time.Minute)) {
+			t.Errorf("got hold deadline %s for max hold duration %s, expected the server-wide cap of %s", info.HoldDeadline, maxHoldDuration, backend.MaxHoldDuration)
+		}
+	}
+
+	// The shorter limit of the acquirer is kept
+	acquireTestLock(t, locker, "limited", lockgate.AcquireOptions{MaxHoldDuration: 10 * time.Second})
+	if expected := time.Now().Add(10 * time.Second).Unix(); getTestLease(t, backend, "limited").HoldDeadlineTimestamp > expected {
+		t.Errorf("got hold deadline later than %d, expected the limit of the acquirer", expected)
+	}
+}
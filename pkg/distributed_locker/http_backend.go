@@ -3,8 +3,10 @@ package distributed_locker
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/werf/lockgate"
+	"github.com/werf/lockgate/pkg/ratelimit"
 	"github.com/werf/lockgate/pkg/util"
 )
 
@@ -20,6 +22,10 @@ func NewHttpBackend(urlEndpoint string) *HttpBackend {
 	}
 }
 
+func (backend *HttpBackend) BackendId() string {
+	return fmt.Sprintf("http:%s", backend.URLEndpoint)
+}
+
 func (backend *HttpBackend) Acquire(lockName string, opts AcquireOptions) (lockgate.LockHandle, error) {
 	request := AcquireRequest{
 		LockName: lockName,
@@ -52,3 +58,326 @@ func (backend *HttpBackend) Release(handle lockgate.LockHandle) error {
 	}
 	return response.Err.Error
 }
+
+func (backend *HttpBackend) LeaveQueue(lockName, acquirerId string) error {
+	request := LeaveQueueRequest{LockName: lockName, AcquirerId: acquirerId}
+	var response LeaveQueueResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "leave-queue"), request, &response); err != nil {
+		return err
+	}
+	return response.Err.Error
+}
+
+func (backend *HttpBackend) AcquireAny(lockNames []string, opts AcquireOptions) (lockgate.LockHandle, error) {
+	request := AcquireAnyRequest{
+		LockNames: lockNames,
+		Opts:      opts,
+	}
+	var response AcquireAnyResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "acquire-any"), request, &response); err != nil {
+		return lockgate.LockHandle{}, err
+	}
+	return response.LockHandle, response.Err.Error
+}
+
+func (backend *HttpBackend) LeaveQueueAny(lockNames []string, acquirerId string) error {
+	request := LeaveQueueAnyRequest{LockNames: lockNames, AcquirerId: acquirerId}
+	var response LeaveQueueAnyResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "leave-queue-any"), request, &response); err != nil {
+		return err
+	}
+	return response.Err.Error
+}
+
+func (backend *HttpBackend) GetLockInfo(lockName string) (*lockgate.LockInfo, error) {
+	request := GetLockInfoRequest{LockName: lockName}
+	var response GetLockInfoResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "get-lock-info"), request, &response); err != nil {
+		return nil, err
+	}
+	return response.LockInfo, response.Err.Error
+}
+
+func (backend *HttpBackend) SetPayload(handle lockgate.LockHandle, payload []byte) error {
+	request := SetPayloadRequest{LockHandle: handle, Payload: payload}
+	var response SetPayloadResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "set-payload"), request, &response); err != nil {
+		return err
+	}
+	return response.Err.Error
+}
+
+func (backend *HttpBackend) GetPayload(lockName string) ([]byte, error) {
+	request := GetPayloadRequest{LockName: lockName}
+	var response GetPayloadResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "get-payload"), request, &response); err != nil {
+		return nil, err
+	}
+	return response.Payload, response.Err.Error
+}
+
+func (backend *HttpBackend) BarrierArrive(name string, parties int, participantId string) (int64, error) {
+	request := BarrierArriveRequest{Name: name, Parties: parties, ParticipantId: participantId}
+	var response BarrierArriveResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "barrier-arrive"), request, &response); err != nil {
+		return 0, err
+	}
+	return response.Generation, response.Err.Error
+}
+
+func (backend *HttpBackend) BarrierPoll(name, participantId string, generation int64) (bool, error) {
+	request := BarrierPollRequest{Name: name, ParticipantId: participantId, Generation: generation}
+	var response BarrierPollResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "barrier-poll"), request, &response); err != nil {
+		return false, err
+	}
+	return response.Done, response.Err.Error
+}
+
+func (backend *HttpBackend) BarrierLeave(name, participantId string) error {
+	request := BarrierLeaveRequest{Name: name, ParticipantId: participantId}
+	var response BarrierLeaveResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "barrier-leave"), request, &response); err != nil {
+		return err
+	}
+	return response.Err.Error
+}
+
+func (backend *HttpBackend) LatchJoin(name string, count int, participantId string) error {
+	request := LatchJoinRequest{Name: name, Count: count, ParticipantId: participantId}
+	var response LatchJoinResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "latch-join"), request, &response); err != nil {
+		return err
+	}
+	return response.Err.Error
+}
+
+func (backend *HttpBackend) LatchCountDown(name string, count int, participantId string) error {
+	request := LatchCountDownRequest{Name: name, Count: count, ParticipantId: participantId}
+	var response LatchCountDownResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "latch-count-down"), request, &response); err != nil {
+		return err
+	}
+	return response.Err.Error
+}
+
+func (backend *HttpBackend) GetLatchState(name string, count int) (*LatchState, error) {
+	request := GetLatchStateRequest{Name: name, Count: count}
+	var response GetLatchStateResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "get-latch-state"), request, &response); err != nil {
+		return nil, err
+	}
+	return response.LatchState, response.Err.Error
+}
+
+func (backend *HttpBackend) LatchWait(name string, count int, waiterId string) (*LatchState, error) {
+	request := LatchWaitRequest{Name: name, Count: count, WaiterId: waiterId}
+	var response LatchWaitResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "latch-wait"), request, &response); err != nil {
+		return nil, err
+	}
+	return response.LatchState, response.Err.Error
+}
+
+func (backend *HttpBackend) CondRegisterAndRelease(handle lockgate.LockHandle, waiterId string) (int64, error) {
+	request := CondRegisterAndReleaseRequest{LockHandle: handle, WaiterId: waiterId}
+	var response CondRegisterAndReleaseResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "cond-register-and-release"), request, &response); err != nil {
+		return 0, err
+	}
+	return response.Generation, response.Err.Error
+}
+
+func (backend *HttpBackend) CondPoll(lockName, waiterId string, generation int64) (bool, error) {
+	request := CondPollRequest{LockName: lockName, WaiterId: waiterId, Generation: generation}
+	var response CondPollResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "cond-poll"), request, &response); err != nil {
+		return false, err
+	}
+	return response.Woken, response.Err.Error
+}
+
+func (backend *HttpBackend) CondSignal(lockName string) error {
+	request := CondSignalRequest{LockName: lockName}
+	var response CondSignalResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "cond-signal"), request, &response); err != nil {
+		return err
+	}
+	return response.Err.Error
+}
+
+func (backend *HttpBackend) CondBroadcast(lockName string) error {
+	request := CondSignalRequest{LockName: lockName, Broadcast: true}
+	var response CondSignalResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "cond-signal"), request, &response); err != nil {
+		return err
+	}
+	return response.Err.Error
+}
+
+func (backend *HttpBackend) CondLeave(lockName, waiterId string) error {
+	request := CondLeaveRequest{LockName: lockName, WaiterId: waiterId}
+	var response CondLeaveResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "cond-leave"), request, &response); err != nil {
+		return err
+	}
+	return response.Err.Error
+}
+
+func (backend *HttpBackend) GetRunOnceResult(key string) (*RunOnceResult, error) {
+	request := GetRunOnceResultRequest{Key: key}
+	var response GetRunOnceResultResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "get-run-once-result"), request, &response); err != nil {
+		return nil, err
+	}
+	return response.Result, response.Err.Error
+}
+
+func (backend *HttpBackend) ClaimRunOnce(key string, handle lockgate.LockHandle) (*RunOnceResult, error) {
+	request := ClaimRunOnceRequest{Key: key, LockHandle: handle}
+	var response ClaimRunOnceResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "claim-run-once"), request, &response); err != nil {
+		return nil, err
+	}
+	return response.Result, response.Err.Error
+}
+
+func (backend *HttpBackend) PutRunOnceResult(key string, handle lockgate.LockHandle, result *RunOnceResult) error {
+	request := PutRunOnceResultRequest{Key: key, LockHandle: handle, Result: result}
+	var response PutRunOnceResultResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "put-run-once-result"), request, &response); err != nil {
+		return err
+	}
+	return response.Err.Error
+}
+
+func (backend *HttpBackend) RateLimitTake(key string, min, max int, limit ratelimit.Limit) (*ratelimit.TakeResult, error) {
+	request := RateLimitTakeRequest{Key: key, Min: min, Max: max, Limit: limit}
+	var response RateLimitTakeResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "rate-limit-take"), request, &response); err != nil {
+		return nil, err
+	}
+	return response.Result, response.Err.Error
+}
+
+func (backend *HttpBackend) Claim(queue string, candidates []string, max int) ([]ClaimedItem, error) {
+	request := ClaimRequest{Queue: queue, Candidates: candidates, Max: max}
+	var response ClaimResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "claim"), request, &response); err != nil {
+		return nil, err
+	}
+	return response.Claimed, response.Err.Error
+}
+
+func (backend *HttpBackend) CompleteClaim(queue, item string, handle lockgate.LockHandle) error {
+	request := CompleteClaimRequest{Queue: queue, Item: item, LockHandle: handle}
+	var response CompleteClaimResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "complete-claim"), request, &response); err != nil {
+		return err
+	}
+	return response.Err.Error
+}
+
+func (backend *HttpBackend) ForgetClaim(queue, item string) error {
+	request := ForgetClaimRequest{Queue: queue, Item: item}
+	var response ForgetClaimResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "forget-claim"), request, &response); err != nil {
+		return err
+	}
+	return response.Err.Error
+}
+
+func (backend *HttpBackend) SetDrain(drain *Drain) error {
+	request := SetDrainRequest{Drain: drain}
+	var response SetDrainResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "set-drain"), request, &response); err != nil {
+		return err
+	}
+	return response.Err.Error
+}
+
+func (backend *HttpBackend) LiftDrain(pattern string) error {
+	request := LiftDrainRequest{Pattern: pattern}
+	var response LiftDrainResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "lift-drain"), request, &response); err != nil {
+		return err
+	}
+	return response.Err.Error
+}
+
+func (backend *HttpBackend) ListDrains() ([]*Drain, error) {
+	request := ListDrainsRequest{}
+	var response ListDrainsResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "list-drains"), request, &response); err != nil {
+		return nil, err
+	}
+	return response.Drains, response.Err.Error
+}
+
+func (backend *HttpBackend) Reserve(lockName string, from, to time.Time, owner string) (*Reservation, error) {
+	request := ReserveRequest{LockName: lockName, FromTimestamp: from.Unix(), ToTimestamp: to.Unix(), Owner: owner}
+	var response ReserveResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "reserve"), request, &response); err != nil {
+		return nil, err
+	}
+	return response.Reservation, response.Err.Error
+}
+
+func (backend *HttpBackend) ListReservations(lockName string) ([]*Reservation, error) {
+	request := ListReservationsRequest{LockName: lockName}
+	var response ListReservationsResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "list-reservations"), request, &response); err != nil {
+		return nil, err
+	}
+	return response.Reservations, response.Err.Error
+}
+
+func (backend *HttpBackend) CancelReservation(lockName, reservationId string) error {
+	request := CancelReservationRequest{LockName: lockName, ReservationId: reservationId}
+	var response CancelReservationResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "cancel-reservation"), request, &response); err != nil {
+		return err
+	}
+	return response.Err.Error
+}
+
+func (backend *HttpBackend) SweepExpiredLeases(olderThan time.Duration) (int, error) {
+	request := SweepExpiredLeasesRequest{OlderThanSeconds: int64(olderThan / time.Second)}
+	var response SweepExpiredLeasesResponse
+
+	if err := util.PerformHttpPost(backend.HttpClient, fmt.Sprintf("%s/%s", backend.URLEndpoint, "sweep-expired-leases"), request, &response); err != nil {
+		return 0, err
+	}
+	return response.Swept, response.Err.Error
+}
@@ -3,11 +3,21 @@ package distributed_locker
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/werf/lockgate"
+	"github.com/werf/lockgate/pkg/ratelimit"
 	"github.com/werf/lockgate/pkg/util"
 )
 
+// SyncPrimitivesBackend is implemented by backends supporting barriers, latches and condition variables,
+// HttpBackendHandler serves these primitives when the backend implements this interface.
+type SyncPrimitivesBackend interface {
+	BarrierBackend
+	LatchBackend
+	CondBackend
+}
+
 func RunHttpBackendServer(ip, port string, backend DistributedLockerBackend) error {
 	handler := NewHttpBackendHandler(backend)
 	return http.ListenAndServe(fmt.Sprintf("%s:%s", ip, port), handler)
@@ -27,6 +37,58 @@ func NewHttpBackendHandler(backend DistributedLockerBackend) *HttpBackendHandler
 	handler.HandleFunc("/acquire", handler.handleAcquire)
 	handler.HandleFunc("/renew-lease", handler.handleRenewLease)
 	handler.HandleFunc("/release", handler.handleRelease)
+	handler.HandleFunc("/leave-queue", handler.handleLeaveQueue)
+	handler.HandleFunc("/acquire-any", handler.handleAcquireAny)
+	handler.HandleFunc("/leave-queue-any", handler.handleLeaveQueueAny)
+	handler.HandleFunc("/get-lock-info", handler.handleGetLockInfo)
+	handler.HandleFunc("/set-payload", handler.handleSetPayload)
+	handler.HandleFunc("/get-payload", handler.handleGetPayload)
+
+	if _, ok := backend.(SyncPrimitivesBackend); ok {
+		handler.HandleFunc("/barrier-arrive", handler.handleBarrierArrive)
+		handler.HandleFunc("/barrier-poll", handler.handleBarrierPoll)
+		handler.HandleFunc("/barrier-leave", handler.handleBarrierLeave)
+		handler.HandleFunc("/latch-join", handler.handleLatchJoin)
+		handler.HandleFunc("/latch-count-down", handler.handleLatchCountDown)
+		handler.HandleFunc("/get-latch-state", handler.handleGetLatchState)
+		handler.HandleFunc("/latch-wait", handler.handleLatchWait)
+		handler.HandleFunc("/cond-register-and-release", handler.handleCondRegisterAndRelease)
+		handler.HandleFunc("/cond-poll", handler.handleCondPoll)
+		handler.HandleFunc("/cond-signal", handler.handleCondSignal)
+		handler.HandleFunc("/cond-leave", handler.handleCondLeave)
+	}
+
+	if _, ok := backend.(RunOnceBackend); ok {
+		handler.HandleFunc("/get-run-once-result", handler.handleGetRunOnceResult)
+		handler.HandleFunc("/claim-run-once", handler.handleClaimRunOnce)
+		handler.HandleFunc("/put-run-once-result", handler.handlePutRunOnceResult)
+	}
+
+	if _, ok := backend.(ratelimit.Backend); ok {
+		handler.HandleFunc("/rate-limit-take", handler.handleRateLimitTake)
+	}
+
+	if _, ok := backend.(ClaimBackend); ok {
+		handler.HandleFunc("/claim", handler.handleClaim)
+		handler.HandleFunc("/complete-claim", handler.handleCompleteClaim)
+		handler.HandleFunc("/forget-claim", handler.handleForgetClaim)
+	}
+
+	if _, ok := backend.(DrainBackend); ok {
+		handler.HandleFunc("/set-drain", handler.handleSetDrain)
+		handler.HandleFunc("/lift-drain", handler.handleLiftDrain)
+		handler.HandleFunc("/list-drains", handler.handleListDrains)
+	}
+
+	if _, ok := backend.(ReservationBackend); ok {
+		handler.HandleFunc("/reserve", handler.handleReserve)
+		handler.HandleFunc("/list-reservations", handler.handleListReservations)
+		handler.HandleFunc("/cancel-reservation", handler.handleCancelReservation)
+	}
+
+	if _, ok := backend.(SweepBackend); ok {
+		handler.HandleFunc("/sweep-expired-leases", handler.handleSweepExpiredLeases)
+	}
 
 	return handler
 }
@@ -61,6 +123,324 @@ func (handler *HttpBackendHandler) handleRelease(w http.ResponseWriter, r *http.
 	})
 }
 
+func (handler *HttpBackendHandler) handleLeaveQueue(w http.ResponseWriter, r *http.Request) {
+	var request LeaveQueueRequest
+	var response LeaveQueueResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.LeaveQueue -- request %#v", request)
+		response.Err.Error = handler.Backend.LeaveQueue(request.LockName, request.AcquirerId)
+		debug("HttpBackendHandler.LeaveQueue -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleAcquireAny(w http.ResponseWriter, r *http.Request) {
+	var request AcquireAnyRequest
+	var response AcquireAnyResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.AcquireAny -- request %#v", request)
+		response.LockHandle, response.Err.Error = handler.Backend.AcquireAny(request.LockNames, request.Opts)
+		debug("HttpBackendHandler.AcquireAny -- response %#v, err %q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleLeaveQueueAny(w http.ResponseWriter, r *http.Request) {
+	var request LeaveQueueAnyRequest
+	var response LeaveQueueAnyResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.LeaveQueueAny -- request %#v", request)
+		response.Err.Error = handler.Backend.LeaveQueueAny(request.LockNames, request.AcquirerId)
+		debug("HttpBackendHandler.LeaveQueueAny -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleGetLockInfo(w http.ResponseWriter, r *http.Request) {
+	var request GetLockInfoRequest
+	var response GetLockInfoResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.GetLockInfo -- request %#v", request)
+		response.LockInfo, response.Err.Error = handler.Backend.GetLockInfo(request.LockName)
+		debug("HttpBackendHandler.GetLockInfo -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleSetPayload(w http.ResponseWriter, r *http.Request) {
+	var request SetPayloadRequest
+	var response SetPayloadResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.SetPayload -- request %#v", request)
+		response.Err.Error = handler.Backend.SetPayload(request.LockHandle, request.Payload)
+		debug("HttpBackendHandler.SetPayload -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleGetPayload(w http.ResponseWriter, r *http.Request) {
+	var request GetPayloadRequest
+	var response GetPayloadResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.GetPayload -- request %#v", request)
+		response.Payload, response.Err.Error = handler.Backend.GetPayload(request.LockName)
+		debug("HttpBackendHandler.GetPayload -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleBarrierArrive(w http.ResponseWriter, r *http.Request) {
+	var request BarrierArriveRequest
+	var response BarrierArriveResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.BarrierArrive -- request %#v", request)
+		response.Generation, response.Err.Error = handler.Backend.(SyncPrimitivesBackend).BarrierArrive(request.Name, request.Parties, request.ParticipantId)
+		debug("HttpBackendHandler.BarrierArrive -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleBarrierPoll(w http.ResponseWriter, r *http.Request) {
+	var request BarrierPollRequest
+	var response BarrierPollResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.BarrierPoll -- request %#v", request)
+		response.Done, response.Err.Error = handler.Backend.(SyncPrimitivesBackend).BarrierPoll(request.Name, request.ParticipantId, request.Generation)
+		debug("HttpBackendHandler.BarrierPoll -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleBarrierLeave(w http.ResponseWriter, r *http.Request) {
+	var request BarrierLeaveRequest
+	var response BarrierLeaveResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.BarrierLeave -- request %#v", request)
+		response.Err.Error = handler.Backend.(SyncPrimitivesBackend).BarrierLeave(request.Name, request.ParticipantId)
+		debug("HttpBackendHandler.BarrierLeave -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleLatchJoin(w http.ResponseWriter, r *http.Request) {
+	var request LatchJoinRequest
+	var response LatchJoinResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.LatchJoin -- request %#v", request)
+		response.Err.Error = handler.Backend.(SyncPrimitivesBackend).LatchJoin(request.Name, request.Count, request.ParticipantId)
+		debug("HttpBackendHandler.LatchJoin -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleLatchCountDown(w http.ResponseWriter, r *http.Request) {
+	var request LatchCountDownRequest
+	var response LatchCountDownResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.LatchCountDown -- request %#v", request)
+		response.Err.Error = handler.Backend.(SyncPrimitivesBackend).LatchCountDown(request.Name, request.Count, request.ParticipantId)
+		debug("HttpBackendHandler.LatchCountDown -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleGetLatchState(w http.ResponseWriter, r *http.Request) {
+	var request GetLatchStateRequest
+	var response GetLatchStateResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.GetLatchState -- request %#v", request)
+		response.LatchState, response.Err.Error = handler.Backend.(SyncPrimitivesBackend).GetLatchState(request.Name, request.Count)
+		debug("HttpBackendHandler.GetLatchState -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleLatchWait(w http.ResponseWriter, r *http.Request) {
+	var request LatchWaitRequest
+	var response LatchWaitResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.LatchWait -- request %#v", request)
+		response.LatchState, response.Err.Error = handler.Backend.(SyncPrimitivesBackend).LatchWait(request.Name, request.Count, request.WaiterId)
+		debug("HttpBackendHandler.LatchWait -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleCondRegisterAndRelease(w http.ResponseWriter, r *http.Request) {
+	var request CondRegisterAndReleaseRequest
+	var response CondRegisterAndReleaseResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.CondRegisterAndRelease -- request %#v", request)
+		response.Generation, response.Err.Error = handler.Backend.(SyncPrimitivesBackend).CondRegisterAndRelease(request.LockHandle, request.WaiterId)
+		debug("HttpBackendHandler.CondRegisterAndRelease -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleCondPoll(w http.ResponseWriter, r *http.Request) {
+	var request CondPollRequest
+	var response CondPollResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.CondPoll -- request %#v", request)
+		response.Woken, response.Err.Error = handler.Backend.(SyncPrimitivesBackend).CondPoll(request.LockName, request.WaiterId, request.Generation)
+		debug("HttpBackendHandler.CondPoll -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleCondSignal(w http.ResponseWriter, r *http.Request) {
+	var request CondSignalRequest
+	var response CondSignalResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.CondSignal -- request %#v", request)
+		if request.Broadcast {
+			response.Err.Error = handler.Backend.(SyncPrimitivesBackend).CondBroadcast(request.LockName)
+		} else {
+			response.Err.Error = handler.Backend.(SyncPrimitivesBackend).CondSignal(request.LockName)
+		}
+		debug("HttpBackendHandler.CondSignal -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleCondLeave(w http.ResponseWriter, r *http.Request) {
+	var request CondLeaveRequest
+	var response CondLeaveResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.CondLeave -- request %#v", request)
+		response.Err.Error = handler.Backend.(SyncPrimitivesBackend).CondLeave(request.LockName, request.WaiterId)
+		debug("HttpBackendHandler.CondLeave -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleGetRunOnceResult(w http.ResponseWriter, r *http.Request) {
+	var request GetRunOnceResultRequest
+	var response GetRunOnceResultResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.GetRunOnceResult -- request %#v", request)
+		response.Result, response.Err.Error = handler.Backend.(RunOnceBackend).GetRunOnceResult(request.Key)
+		debug("HttpBackendHandler.GetRunOnceResult -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleClaimRunOnce(w http.ResponseWriter, r *http.Request) {
+	var request ClaimRunOnceRequest
+	var response ClaimRunOnceResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.ClaimRunOnce -- request %#v", request)
+		response.Result, response.Err.Error = handler.Backend.(RunOnceBackend).ClaimRunOnce(request.Key, request.LockHandle)
+		debug("HttpBackendHandler.ClaimRunOnce -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handlePutRunOnceResult(w http.ResponseWriter, r *http.Request) {
+	var request PutRunOnceResultRequest
+	var response PutRunOnceResultResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.PutRunOnceResult -- request %#v", request)
+		response.Err.Error = handler.Backend.(RunOnceBackend).PutRunOnceResult(request.Key, request.LockHandle, request.Result)
+		debug("HttpBackendHandler.PutRunOnceResult -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleRateLimitTake(w http.ResponseWriter, r *http.Request) {
+	var request RateLimitTakeRequest
+	var response RateLimitTakeResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.RateLimitTake -- request %#v", request)
+		response.Result, response.Err.Error = handler.Backend.(ratelimit.Backend).RateLimitTake(request.Key, request.Min, request.Max, request.Limit)
+		debug("HttpBackendHandler.RateLimitTake -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleClaim(w http.ResponseWriter, r *http.Request) {
+	var request ClaimRequest
+	var response ClaimResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.Claim -- request %#v", request)
+		response.Claimed, response.Err.Error = handler.Backend.(ClaimBackend).Claim(request.Queue, request.Candidates, request.Max)
+		debug("HttpBackendHandler.Claim -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleCompleteClaim(w http.ResponseWriter, r *http.Request) {
+	var request CompleteClaimRequest
+	var response CompleteClaimResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.CompleteClaim -- request %#v", request)
+		response.Err.Error = handler.Backend.(ClaimBackend).CompleteClaim(request.Queue, request.Item, request.LockHandle)
+		debug("HttpBackendHandler.CompleteClaim -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleForgetClaim(w http.ResponseWriter, r *http.Request) {
+	var request ForgetClaimRequest
+	var response ForgetClaimResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.ForgetClaim -- request %#v", request)
+		response.Err.Error = handler.Backend.(ClaimBackend).ForgetClaim(request.Queue, request.Item)
+		debug("HttpBackendHandler.ForgetClaim -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleSetDrain(w http.ResponseWriter, r *http.Request) {
+	var request SetDrainRequest
+	var response SetDrainResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.SetDrain -- request %#v", request)
+		if request.Drain == nil {
+			response.Err.Error = fmt.Errorf("drain should be specified")
+		} else {
+			response.Err.Error = handler.Backend.(DrainBackend).SetDrain(request.Drain)
+		}
+		debug("HttpBackendHandler.SetDrain -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleLiftDrain(w http.ResponseWriter, r *http.Request) {
+	var request LiftDrainRequest
+	var response LiftDrainResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.LiftDrain -- request %#v", request)
+		response.Err.Error = handler.Backend.(DrainBackend).LiftDrain(request.Pattern)
+		debug("HttpBackendHandler.LiftDrain -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleListDrains(w http.ResponseWriter, r *http.Request) {
+	var request ListDrainsRequest
+	var response ListDrainsResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.ListDrains -- request %#v", request)
+		response.Drains, response.Err.Error = handler.Backend.(DrainBackend).ListDrains()
+		debug("HttpBackendHandler.ListDrains -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleReserve(w http.ResponseWriter, r *http.Request) {
+	var request ReserveRequest
+	var response ReserveResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.Reserve -- request %#v", request)
+		response.Reservation, response.Err.Error = handler.Backend.(ReservationBackend).Reserve(request.LockName, time.Unix(request.FromTimestamp, 0), time.Unix(request.ToTimestamp, 0), request.Owner)
+		debug("HttpBackendHandler.Reserve -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleListReservations(w http.ResponseWriter, r *http.Request) {
+	var request ListReservationsRequest
+	var response ListReservationsResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.ListReservations -- request %#v", request)
+		response.Reservations, response.Err.Error = handler.Backend.(ReservationBackend).ListReservations(request.LockName)
+		debug("HttpBackendHandler.ListReservations -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleCancelReservation(w http.ResponseWriter, r *http.Request) {
+	var request CancelReservationRequest
+	var response CancelReservationResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.CancelReservation -- request %#v", request)
+		response.Err.Error = handler.Backend.(ReservationBackend).CancelReservation(request.LockName, request.ReservationId)
+		debug("HttpBackendHandler.CancelReservation -- response %#v err=%q", response, response.Err)
+	})
+}
+
+func (handler *HttpBackendHandler) handleSweepExpiredLeases(w http.ResponseWriter, r *http.Request) {
+	var request SweepExpiredLeasesRequest
+	var response SweepExpiredLeasesResponse
+	util.HandleHttpRequest(w, r, &request, &response, func() {
+		debug("HttpBackendHandler.SweepExpiredLeases -- request %#v", request)
+		response.Swept, response.Err.Error = handler.Backend.(SweepBackend).SweepExpiredLeases(time.Duration(request.OlderThanSeconds) * time.Second)
+		debug("HttpBackendHandler.SweepExpiredLeases -- response %#v err=%q", response, response.Err)
+	})
+}
+
 type AcquireRequest struct {
 	LockName string         `json:"lockName"`
 	Opts     AcquireOptions `json:"opts"`
@@ -86,3 +466,302 @@ type ReleaseRequest struct {
 type ReleaseResponse struct {
 	Err util.SerializableError `json:"err"`
 }
+
+type LeaveQueueRequest struct {
+	LockName   string `json:"lockName"`
+	AcquirerId string `json:"acquirerId"`
+}
+
+type LeaveQueueResponse struct {
+	Err util.SerializableError `json:"err"`
+}
+
+type AcquireAnyRequest struct {
+	LockNames []string       `json:"lockNames"`
+	Opts      AcquireOptions `json:"opts"`
+}
+
+type AcquireAnyResponse struct {
+	LockHandle lockgate.LockHandle    `json:"lockHandle"`
+	Err        util.SerializableError `json:"err"`
+}
+
+type LeaveQueueAnyRequest struct {
+	LockNames  []string `json:"lockNames"`
+	AcquirerId string   `json:"acquirerId"`
+}
+
+type LeaveQueueAnyResponse struct {
+	Err util.SerializableError `json:"err"`
+}
+
+type GetLockInfoRequest struct {
+	LockName string `json:"lockName"`
+}
+
+type GetLockInfoResponse struct {
+	LockInfo *lockgate.LockInfo     `json:"lockInfo"`
+	Err      util.SerializableError `json:"err"`
+}
+
+type SetPayloadRequest struct {
+	LockHandle lockgate.LockHandle `json:"lockHandle"`
+	Payload    []byte              `json:"payload"`
+}
+
+type SetPayloadResponse struct {
+	Err util.SerializableError `json:"err"`
+}
+
+type GetPayloadRequest struct {
+	LockName string `json:"lockName"`
+}
+
+type GetPayloadResponse struct {
+	Payload []byte                 `json:"payload"`
+	Err     util.SerializableError `json:"err"`
+}
+
+type BarrierArriveRequest struct {
+	Name          string `json:"name"`
+	Parties       int    `json:"parties"`
+	ParticipantId string `json:"participantId"`
+}
+
+type BarrierArriveResponse struct {
+	Generation int64                  `json:"generation"`
+	Err        util.SerializableError `json:"err"`
+}
+
+type BarrierPollRequest struct {
+	Name          string `json:"name"`
+	ParticipantId string `json:"participantId"`
+	Generation    int64  `json:"generation"`
+}
+
+type BarrierPollResponse struct {
+	Done bool                   `json:"done"`
+	Err  util.SerializableError `json:"err"`
+}
+
+type BarrierLeaveRequest struct {
+	Name          string `json:"name"`
+	ParticipantId string `json:"participantId"`
+}
+
+type BarrierLeaveResponse struct {
+	Err util.SerializableError `json:"err"`
+}
+
+type LatchJoinRequest struct {
+	Name          string `json:"name"`
+	Count         int    `json:"count"`
+	ParticipantId string `json:"participantId"`
+}
+
+type LatchJoinResponse struct {
+	Err util.SerializableError `json:"err"`
+}
+
+type LatchCountDownRequest struct {
+	Name          string `json:"name"`
+	Count         int    `json:"count"`
+	ParticipantId string `json:"participantId"`
+}
+
+type LatchCountDownResponse struct {
+	Err util.SerializableError `json:"err"`
+}
+
+type GetLatchStateRequest struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type GetLatchStateResponse struct {
+	LatchState *LatchState            `json:"latchState"`
+	Err        util.SerializableError `json:"err"`
+}
+
+type LatchWaitRequest struct {
+	Name     string `json:"name"`
+	Count    int    `json:"count"`
+	WaiterId string `json:"waiterId"`
+}
+
+type LatchWaitResponse struct {
+	LatchState *LatchState            `json:"latchState"`
+	Err        util.SerializableError `json:"err"`
+}
+
+type CondRegisterAndReleaseRequest struct {
+	LockHandle lockgate.LockHandle `json:"lockHandle"`
+	WaiterId   string              `json:"waiterId"`
+}
+
+type CondRegisterAndReleaseResponse struct {
+	Generation int64                  `json:"generation"`
+	Err        util.SerializableError `json:"err"`
+}
+
+type CondPollRequest struct {
+	LockName   string `json:"lockName"`
+	WaiterId   string `json:"waiterId"`
+	Generation int64  `json:"generation"`
+}
+
+type CondPollResponse struct {
+	Woken bool                   `json:"woken"`
+	Err   util.SerializableError `json:"err"`
+}
+
+type CondSignalRequest struct {
+	LockName  string `json:"lockName"`
+	Broadcast bool   `json:"broadcast"`
+}
+
+type CondSignalResponse struct {
+	Err util.SerializableError `json:"err"`
+}
+
+type CondLeaveRequest struct {
+	LockName string `json:"lockName"`
+	WaiterId string `json:"waiterId"`
+}
+
+type CondLeaveResponse struct {
+	Err util.SerializableError `json:"err"`
+}
+
+type GetRunOnceResultRequest struct {
+	Key string `json:"key"`
+}
+
+type GetRunOnceResultResponse struct {
+	Result *RunOnceResult         `json:"result"`
+	Err    util.SerializableError `json:"err"`
+}
+
+type ClaimRunOnceRequest struct {
+	Key        string              `json:"key"`
+	LockHandle lockgate.LockHandle `json:"lockHandle"`
+}
+
+type ClaimRunOnceResponse struct {
+	Result *RunOnceResult         `json:"result"`
+	Err    util.SerializableError `json:"err"`
+}
+
+type PutRunOnceResultRequest struct {
+	Key        string              `json:"key"`
+	LockHandle lockgate.LockHandle `json:"lockHandle"`
+	Result     *RunOnceResult      `json:"result"`
+}
+
+type PutRunOnceResultResponse struct {
+	Err util.SerializableError `json:"err"`
+}
+
+type RateLimitTakeRequest struct {
+	Key   string          `json:"key"`
+	Min   int             `json:"min"`
+	Max   int             `json:"max"`
+	Limit ratelimit.Limit `json:"limit"`
+}
+
+type RateLimitTakeResponse struct {
+	Result *ratelimit.TakeResult  `json:"result"`
+	Err    util.SerializableError `json:"err"`
+}
+
+type ClaimRequest struct {
+	Queue      string   `json:"queue"`
+	Candidates []string `json:"candidates"`
+	Max        int      `json:"max"`
+}
+
+type ClaimResponse struct {
+	Claimed []ClaimedItem          `json:"claimed"`
+	Err     util.SerializableError `json:"err"`
+}
+
+type CompleteClaimRequest struct {
+	Queue      string              `json:"queue"`
+	Item       string              `json:"item"`
+	LockHandle lockgate.LockHandle `json:"lockHandle"`
+}
+
+type CompleteClaimResponse struct {
+	Err util.SerializableError `json:"err"`
+}
+
+type ForgetClaimRequest struct {
+	Queue string `json:"queue"`
+	Item  string `json:"item"`
+}
+
+type ForgetClaimResponse struct {
+	Err util.SerializableError `json:"err"`
+}
+
+type SetDrainRequest struct {
+	Drain *Drain `json:"drain"`
+}
+
+type SetDrainResponse struct {
+	Err util.SerializableError `json:"err"`
+}
+
+type LiftDrainRequest struct {
+	Pattern string `json:"pattern"`
+}
+
+type LiftDrainResponse struct {
+	Err util.SerializableError `json:"err"`
+}
+
+type ListDrainsRequest struct{}
+
+type ListDrainsResponse struct {
+	Drains []*Drain               `json:"drains"`
+	Err    util.SerializableError `json:"err"`
+}
+
+type ReserveRequest struct {
+	LockName      string `json:"lockName"`
+	FromTimestamp int64  `json:"fromTimestamp"`
+	ToTimestamp   int64  `json:"toTimestamp"`
+	Owner         string `json:"owner"`
+}
+
+type ReserveResponse struct {
+	Reservation *Reservation           `json:"reservation"`
+	Err         util.SerializableError `json:"err"`
+}
+
+type ListReservationsRequest struct {
+	LockName string `json:"lockName"`
+}
+
+type ListReservationsResponse struct {
+	Reservations []*Reservation         `json:"reservations"`
+	Err          util.SerializableError `json:"err"`
+}
+
+type CancelReservationRequest struct {
+	LockName      string `json:"lockName"`
+	ReservationId string `json:"reservationId"`
+}
+
+type CancelReservationResponse struct {
+	Err util.SerializableError `json:"err"`
+}
+
+type SweepExpiredLeasesRequest struct {
+	OlderThanSeconds int64 `json:"olderThanSeconds"`
+}
+
+type SweepExpiredLeasesResponse struct {
+	Swept int                    `json:"swept"`
+	Err   util.SerializableError `json:"err"`
+}
@@ -0,0 +1,118 @@
+package distributed_locker
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/werf/lockgate"
+)
+
+type LatchBackend interface {
+	LatchJoin(name string, count int, participantId string) error
+	LatchCountDown(name string, count int, participantId string) error
+	GetLatchState(name string, count int) (*LatchState, error)
+	// LatchWait registers or renews the waiter of the latch and returns the state of the latch.
+	// The waiter is unregistered when the latch is counted down to zero, the record of the latch
+	// is deleted when there are no more waiters to observe it.
+	LatchWait(name string, count int, waiterId string) (*LatchState, error)
+}
+
+type LatchState struct {
+	Count            int      `json:"count"`
+	Remaining        int      `json:"remaining"`
+	LostParticipants []string `json:"lostParticipants,omitempty"`
+}
+
+// Latch blocks waiters until count participants count down the latch.
+// Participant may Join the latch before doing its work, then waiters are notified
+// when the participant crashes without counting down.
+type Latch struct {
+	Backend       LatchBackend
+	Name          string
+	Count         int
+	ParticipantId string
+
+	mux      sync.Mutex
+	doneChan chan struct{}
+}
+
+func NewLatch(backend LatchBackend, name string, count int) *Latch {
+	return &Latch{
+		Backend:       backend,
+		Name:          name,
+		Count:         count,
+		ParticipantId: uuid.New().String(),
+	}
+}
+
+// Join registers the participant of the latch and renews its lease in the background until CountDown is called.
+func (latch *Latch) Join() error {
+	latch.mux.Lock()
+	defer latch.mux.Unlock()
+
+	if latch.doneChan != nil {
+		return nil
+	}
+
+	if err := latch.Backend.LatchJoin(latch.Name, latch.Count, latch.ParticipantId); err != nil {
+		return err
+	}
+
+	latch.doneChan = make(chan struct{})
+	go latch.participantRenewWorker(latch.doneChan)
+
+	return nil
+}
+
+func (latch *Latch) CountDown() error {
+	latch.mux.Lock()
+	if latch.doneChan != nil {
+		close(latch.doneChan)
+		latch.doneChan = nil
+	}
+	latch.mux.Unlock()
+
+	debug("(latch %q) participant %q count down", latch.Name, latch.ParticipantId)
+	return latch.Backend.LatchCountDown(latch.Name, latch.Count, latch.ParticipantId)
+}
+
+// Wait blocks until the latch is counted down to zero. The record of the latch is deleted when all
+// registered waiters have observed the latch counted down, a waiter which starts waiting after that
+// waits for the next count down of the latch.
+func (latch *Latch) Wait(opts WaitOptions) error {
+	target := &acquireTarget{
+		Name: latch.Name,
+		Acquire: func() (lockgate.LockHandle, error) {
+			if state, err := latch.Backend.LatchWait(latch.Name, latch.Count, latch.ParticipantId); err != nil {
+				return lockgate.LockHandle{}, err
+			} else if state.Remaining == 0 {
+				return lockgate.LockHandle{}, nil
+			} else if len(state.LostParticipants) > 0 {
+				return lockgate.LockHandle{}, fmt.Errorf("latch %q participants lost: %s", latch.Name, strings.Join(state.LostParticipants, ", "))
+			}
+			return lockgate.LockHandle{}, ErrShouldWait
+		},
+	}
+	return opts.wait(target)
+}
+
+func (latch *Latch) participantRenewWorker(doneChan chan struct{}) {
+	ticker := time.NewTicker(DistributedLockLeaseRenewPeriodSeconds * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := latch.Backend.LatchJoin(latch.Name, latch.Count, latch.ParticipantId); err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: unable to renew latch %q participant %q lease: %s\n", latch.Name, latch.ParticipantId, err)
+			}
+		case <-doneChan:
+			return
+		}
+	}
+}
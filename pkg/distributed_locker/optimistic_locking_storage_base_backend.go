@@ -13,6 +13,9 @@ import (
 
 type OptimisticLockingStorageBasedBackend struct {
 	Store optimistic_locking_store.OptimisticLockingStore
+
+	// MaxHoldDuration is the server-wide cap of the time any lock can be held, zero means no cap.
+	MaxHoldDuration time.Duration
 }
 
 func NewOptimisticLockingStorageBasedBackend(store optimistic_locking_store.OptimisticLockingStore) *OptimisticLockingStorageBasedBackend {
@@ -21,91 +24,305 @@ func NewOptimisticLockingStorageBasedBackend(store optimistic_locking_store.Opti
 	}
 }
 
+func (backend *OptimisticLockingStorageBasedBackend) BackendId() string {
+	if identifier, ok := backend.Store.(optimistic_locking_store.StoreIdentifier); ok {
+		return fmt.Sprintf("optimistic-locking-store:%s", identifier.StoreId())
+	}
+	return fmt.Sprintf("optimistic-locking-store:%T", backend.Store)
+}
+
 func (handler *OptimisticLockingStorageBasedBackend) keyName(lockName string) string {
-	return fmt.Sprintf("lockgate.io/%s", util.Sha3_224Hash(lockName))
+	return optimistic_locking_store.LockLeaseKey(lockName)
+}
+
+// getMaxHoldDurationSeconds applies the server-wide cap to the max hold duration requested by the acquirer.
+func (backend *OptimisticLockingStorageBasedBackend) getMaxHoldDurationSeconds(opts AcquireOptions) int64 {
+	maxHoldDurationSeconds := int64(backend.MaxHoldDuration / time.Second)
+	if maxHoldDurationSeconds == 0 || (opts.MaxHoldDurationSeconds != 0 && opts.MaxHoldDurationSeconds < maxHoldDurationSeconds) {
+		return opts.MaxHoldDurationSeconds
+	}
+	return maxHoldDurationSeconds
+}
+
+// recordKeyName returns the store key for the auxiliary record of the specified kind (pool queue, etc.),
+// so that auxiliary records never clash with lock lease records.
+func (backend *OptimisticLockingStorageBasedBackend) recordKeyName(kind, name string) string {
+	return fmt.Sprintf("%s.lockgate.io/%s", kind, util.Sha3_224Hash(name))
 }
 
 func (backend *OptimisticLockingStorageBasedBackend) Acquire(lockName string, opts AcquireOptions) (lockgate.LockHandle, error) {
+	handle, _, err := backend.AcquireObserved(lockName, opts)
+	return handle, err
+}
+
+// AcquireObserved returns the lock lease record read by the attempt along with ErrShouldWait,
+// nil record is returned when the caller waits for something else than the lease (drain, reservation).
+func (backend *OptimisticLockingStorageBasedBackend) AcquireObserved(lockName string, opts AcquireOptions) (lockgate.LockHandle, *optimistic_locking_store.Value, error) {
 	storeKeyName := backend.keyName(lockName)
+	opts.MaxHoldDurationSeconds = backend.getMaxHoldDurationSeconds(opts)
+
+	var value *optimistic_locking_store.Value
+	// checkDrainAndReservation is set when drains and reservations have not been checked yet
+	var checkDrainAndReservation func() error
+
+	if _, ok := backend.Store.(optimistic_locking_store.ValuesGetter); ok {
+		// Drains, reservations and the lease are read at once, which is a single request
+		// for stores keeping the records of the lock together
+		drainsKeyName, reservationsKeyName := backend.drainsKeyName(), backend.reservationsKeyName(lockName)
+		values, err := optimistic_locking_store.GetValues(backend.Store, []string{drainsKeyName, reservationsKeyName, storeKeyName})
+		if err != nil {
+			return lockgate.LockHandle{}, nil, fmt.Errorf("unable to get store values by names %s, %s and %s: %s", drainsKeyName, reservationsKeyName, storeKeyName, err)
+		}
+		if err := backend.checkLockDrainAndReservation(lockName, opts, values[0], values[1]); err != nil {
+			return lockgate.LockHandle{}, nil, err
+		}
+		value = values[2]
+	} else {
+		// Every record is a separate request otherwise, so drains and reservations are read only when the lock
+		// could be taken: the waiter polling the held lock makes a single request per attempt,
+		// and gets to know that the lock is drained or reserved after the release
+		var err error
+		if value, err = backend.Store.GetValue(storeKeyName); err != nil {
+			return lockgate.LockHandle{}, nil, fmt.Errorf("unable to get store value by name %s: %s", storeKeyName, err)
+		}
+
+		checkDrainAndReservation = func() error {
+			checkDrainAndReservation = nil
+
+			drainsKeyName, reservationsKeyName := backend.drainsKeyName(), backend.reservationsKeyName(lockName)
+			values, err := optimistic_locking_store.GetValues(backend.Store, []string{drainsKeyName, reservationsKeyName})
+			if err != nil {
+				return fmt.Errorf("unable to get store values by names %s and %s: %s", drainsKeyName, reservationsKeyName, err)
+			}
+			return backend.checkLockDrainAndReservation(lockName, opts, values[0], values[1])
+		}
+	}
 
 RETRY_ACQUIRE:
-	if value, err := backend.Store.GetValue(storeKeyName); err != nil {
-		return lockgate.LockHandle{}, fmt.Errorf("unable to get store value by name %s: %s", storeKeyName, err)
-	} else {
-		debug("(acquire lock %q) got record by key %s: %#v", lockName, storeKeyName, value)
-
-		if oldLease, err := extractLockLeaseFromStoreValue(value); err != nil {
-			return lockgate.LockHandle{}, fmt.Errorf("unable to extract lock lease record from data record by key %s: %s", storeKeyName, err)
-		} else if oldLease != nil {
-			debug("(acquire lock %q) oldLease -> %#v", lockName, oldLease)
-
-			// If the lease is expired, create a new lease for the caller if
-			// nobody else is waiting for they're first in line
-			if time.Now().After(time.Unix(oldLease.ExpireAtTimestamp, 0)) {
-				debug("(acquire lock %q) old lease expired, try to take over!", lockName)
-
-				if newLease, err := backend.TakeIfOldest(oldLease.LockHandle, opts.AcquirerId); err != nil {
-					debug("(acquire lock %q) failed %s", lockName, err.Error())
-					return lockgate.LockHandle{}, err
-				} else {
-					debug("(acquire lock %q) new lease: %#v", lockName, newLease)
-					return newLease.LockHandle, nil
+	debug("(acquire lock %q) got record by key %s: %#v", lockName, storeKeyName, value)
+
+	if oldLease, err := ExtractLockLeaseFromStoreValue(value); err != nil {
+		return lockgate.LockHandle{}, nil, fmt.Errorf("unable to extract lock lease record from data record by key %s: %s", storeKeyName, err)
+	} else if oldLease != nil {
+		debug("(acquire lock %q) oldLease -> %#v", lockName, oldLease)
+
+		// If the lease is expired (or revoked from the preemptible holder), create a new lease for the caller if
+		// nobody else is waiting for they're first in line
+		if !oldLease.IsActive(time.Now()) {
+			debug("(acquire lock %q) old lease expired, try to take over!", lockName)
+
+			if checkDrainAndReservation != nil {
+				if err := checkDrainAndReservation(); err != nil {
+					return lockgate.LockHandle{}, nil, err
 				}
 			}
 
-			// If caller wants a shared lease, and the existing lease is shared, give it to them
-			if opts.Shared && oldLease.IsShared {
-				oldLease.SharedHoldersCount++
-				oldLease.ExpireAtTimestamp = time.Now().Unix() + DistributedLockLeaseTTLSeconds
-				debug("(acquire lock %q) incremented shared holders counter for existing lease: %#v", lockName, oldLease)
-
-				setLockLeaseIntoStoreValue(oldLease, value)
-				if err := backend.Store.PutValue(storeKeyName, value); optimistic_locking_store.IsErrRecordVersionChanged(err) {
-					debug("(acquire lock %q) update key %s optimistic locking error! Will retry acquire ...", lockName, storeKeyName)
-					time.Sleep(DistributedOptimisticLockingRetryPeriodSeconds * time.Second)
-					goto RETRY_ACQUIRE
-				} else if err != nil {
-					return lockgate.LockHandle{}, fmt.Errorf("unable to put store value by key %s: %s", storeKeyName, err)
+			if newLease, err := backend.TakeIfOldest(oldLease.LockHandle, opts); IsErrLockAlreadyLeased(err) || IsErrNoExistingLockLeaseFound(err) {
+				debug("(acquire lock %q) lease changed since the read! Will retry acquire ...", lockName)
+				if value, err = backend.Store.GetValue(storeKeyName); err != nil {
+					return lockgate.LockHandle{}, nil, fmt.Errorf("unable to get store value by name %s: %s", storeKeyName, err)
 				}
+				goto RETRY_ACQUIRE
+			} else if err != nil {
+				debug("(acquire lock %q) failed %s", lockName, err.Error())
+				return lockgate.LockHandle{}, value, err
+			} else {
+				debug("(acquire lock %q) new lease: %#v", lockName, newLease)
+				return newLease.LockHandle, nil, nil
+			}
+		}
 
-				return oldLease.LockHandle, nil
+		// If caller wants a shared lease, and the existing lease is shared, give it to them
+		// unless the lease is being preempted
+		if opts.Shared && oldLease.IsShared && oldLease.PreemptRequestedAtTimestamp == 0 {
+			if checkDrainAndReservation != nil {
+				if err := checkDrainAndReservation(); err != nil {
+					return lockgate.LockHandle{}, nil, err
+				}
 			}
-			// Keep acquirer's place in line by updating the expiration date
-			if err := backend.UpdateQueue(oldLease.LockHandle, opts.AcquirerId); err != nil {
-				return lockgate.LockHandle{}, err
+
+			oldLease.SharedHoldersCount++
+			oldLease.ExpireAtTimestamp = time.Now().Unix() + DistributedLockLeaseTTLSeconds
+			oldLease.joinHolder(opts)
+			debug("(acquire lock %q) incremented shared holders counter for existing lease: %#v", lockName, oldLease)
+
+			SetLockLeaseIntoStoreValue(oldLease, value)
+			if err := backend.Store.PutValue(storeKeyName, value); optimistic_locking_store.IsErrRecordVersionChanged(err) {
+				debug("(acquire lock %q) update key %s optimistic locking error! Will retry acquire ...", lockName, storeKeyName)
+				time.Sleep(DistributedOptimisticLockingRetryPeriodSeconds * time.Second)
+				if value, err = backend.Store.GetValue(storeKeyName); err != nil {
+					return lockgate.LockHandle{}, nil, fmt.Errorf("unable to get store value by name %s: %s", storeKeyName, err)
+				}
+				goto RETRY_ACQUIRE
+			} else if err != nil {
+				return lockgate.LockHandle{}, nil, fmt.Errorf("unable to put store value by key %s: %s", storeKeyName, err)
 			}
 
-			return lockgate.LockHandle{}, ErrShouldWait
+			return oldLease.LockHandle, nil, nil
 		}
-
-		// No existing lease; create a new one
-		newLease := NewLockLeaseRecord(lockName, opts.Shared)
-		debug("(acquire lock %q) new lease: %#v", lockName, newLease)
-
-		setLockLeaseIntoStoreValue(newLease, value)
-		if err := backend.Store.PutValue(storeKeyName, value); optimistic_locking_store.IsErrRecordVersionChanged(err) {
-			debug("(acquire lock %q update key %s optimistic locking error! Will retry acquire ...", lockName, storeKeyName)
-			time.Sleep(DistributedOptimisticLockingRetryPeriodSeconds * time.Second)
+		// Keep acquirer's place in line by updating the expiration date
+		if err := backend.UpdateQueue(oldLease.LockHandle, opts); IsErrLockAlreadyLeased(err) || IsErrNoExistingLockLeaseFound(err) {
+			debug("(acquire lock %q) lease changed since the read! Will retry acquire ...", lockName)
+			if value, err = backend.Store.GetValue(storeKeyName); err != nil {
+				return lockgate.LockHandle{}, nil, fmt.Errorf("unable to get store value by name %s: %s", storeKeyName, err)
+			}
 			goto RETRY_ACQUIRE
 		} else if err != nil {
-			return lockgate.LockHandle{}, fmt.Errorf("unable to put store value by key %s: %s", storeKeyName, err)
+			return lockgate.LockHandle{}, nil, err
 		}
 
-		return newLease.LockHandle, nil
+		return lockgate.LockHandle{}, value, ErrShouldWait
+	}
+
+	// No existing lease; create a new one
+	if checkDrainAndReservation != nil {
+		if err := checkDrainAndReservation(); err != nil {
+			return lockgate.LockHandle{}, nil, err
+		}
 	}
+
+	newLease := NewLockLeaseRecord(lockName, opts.Shared)
+	newLease.setHolder(opts)
+	debug("(acquire lock %q) new lease: %#v", lockName, newLease)
+
+	SetLockLeaseIntoStoreValue(newLease, value)
+	if err := backend.Store.PutValue(storeKeyName, value); optimistic_locking_store.IsErrRecordVersionChanged(err) {
+		debug("(acquire lock %q update key %s optimistic locking error! Will retry acquire ...", lockName, storeKeyName)
+		time.Sleep(DistributedOptimisticLockingRetryPeriodSeconds * time.Second)
+		if value, err = backend.Store.GetValue(storeKeyName); err != nil {
+			return lockgate.LockHandle{}, nil, fmt.Errorf("unable to get store value by name %s: %s", storeKeyName, err)
+		}
+		goto RETRY_ACQUIRE
+	} else if err != nil {
+		return lockgate.LockHandle{}, nil, fmt.Errorf("unable to put store value by key %s: %s", storeKeyName, err)
+	}
+
+	return newLease.LockHandle, nil, nil
 }
 
-func (backend *OptimisticLockingStorageBasedBackend) RenewLease(handle lockgate.LockHandle) error {
+// checkLockDrainAndReservation returns ErrShouldWait, lockgate.ErrLockDrained or lockgate.ErrLockReserved
+// when the lock cannot be taken by the acquirer because of the drain or the reservation of the lock.
+func (backend *OptimisticLockingStorageBasedBackend) checkLockDrainAndReservation(lockName string, opts AcquireOptions, drainsValue, reservationsValue *optimistic_locking_store.Value) error {
+	if drain, err := backend.extractLockDrain(drainsValue, lockName); err != nil {
+		return err
+	} else if drain != nil {
+		debug("(acquire lock %q) lock is drained by %q", lockName, drain.Pattern)
+		if opts.WaitIfDrained {
+			return ErrShouldWait
+		}
+		return lockgate.ErrLockDrained
+	}
+
+	if reservation, err := backend.extractActiveReservation(reservationsValue, lockName, time.Now()); err != nil {
+		return err
+	} else if reservation != nil && reservation.Owner != opts.AcquirerId {
+		debug("(acquire lock %q) lock is reserved by %q until %s", lockName, reservation.Owner, time.Unix(reservation.ToTimestamp, 0))
+		if opts.WaitIfReserved {
+			return ErrShouldWait
+		}
+		return lockgate.ErrLockReserved
+	}
+
+	return nil
+}
+
+func (backend *OptimisticLockingStorageBasedBackend) GetLockInfo(lockName string) (*lockgate.LockInfo, error) {
+	storeKeyName := backend.keyName(lockName)
+
+	value, err := backend.Store.GetValue(storeKeyName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get store value by name %s: %s", storeKeyName, err)
+	}
+
+	lease, err := ExtractLockLeaseFromStoreValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract lock lease record from data record by key %s: %s", storeKeyName, err)
+	}
+
+	info := &lockgate.LockInfo{LockName: lockName}
+	if lease != nil && lease.IsActive(time.Now()) {
+		info.Held = true
+		info.Shared = lease.IsShared
+		info.HolderId = lease.HolderId
+		info.ExpireAt = time.Unix(lease.ExpireAtTimestamp, 0)
+		if lease.HoldDeadlineTimestamp != 0 {
+			info.HoldDeadline = time.Unix(lease.HoldDeadlineTimestamp, 0)
+		}
+	}
+
+	return info, nil
+}
+
+// SetPayload attaches the payload to the lock lease, only the current holder of the lease can change the payload.
+func (backend *OptimisticLockingStorageBasedBackend) SetPayload(handle lockgate.LockHandle, payload []byte) error {
+	if err := lockgate.ValidateLockPayload(payload); err != nil {
+		return err
+	}
+
 	return backend.changeLease(handle, func(value *optimistic_locking_store.Value, lease *LockLeaseRecord) error {
-		lease.ExpireAtTimestamp = time.Now().Unix() + DistributedLockLeaseTTLSeconds
-		setLockLeaseIntoStoreValue(lease, value)
+		lease.Payload = payload
+		SetLockLeaseIntoStoreValue(lease, value)
 		return nil
 	})
 }
 
+func (backend *OptimisticLockingStorageBasedBackend) GetPayload(lockName string) ([]byte, error) {
+	storeKeyName := backend.keyName(lockName)
+
+	value, err := backend.Store.GetValue(storeKeyName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get store value by name %s: %s", storeKeyName, err)
+	}
+
+	lease, err := ExtractLockLeaseFromStoreValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract lock lease record from data record by key %s: %s", storeKeyName, err)
+	}
+
+	if lease == nil || !lease.IsActive(time.Now()) {
+		return nil, nil
+	}
+	return lease.Payload, nil
+}
+
+// RenewLease returns ErrLeasePreempted after the lease has been renewed if the preemptible holder should release the lock.
+// The lease is not renewed past the hold deadline, ErrHoldDeadlineExceeded is returned after the deadline.
+// The revoked lease of the preemptible holder is not renewed, ErrLockAlreadyLeased is returned.
+func (backend *OptimisticLockingStorageBasedBackend) RenewLease(handle lockgate.LockHandle) error {
+	var preempted bool
+	if err := backend.changeLease(handle, func(value *optimistic_locking_store.Value, lease *LockLeaseRecord) error {
+		if lease.IsRevoked(time.Now()) {
+			return ErrLockAlreadyLeased
+		}
+		if lease.IsHoldDeadlineExceeded(time.Now()) {
+			return ErrHoldDeadlineExceeded
+		}
+
+		lease.ExpireAtTimestamp = time.Now().Unix() + DistributedLockLeaseTTLSeconds
+		if lease.HoldDeadlineTimestamp != 0 && lease.ExpireAtTimestamp > lease.HoldDeadlineTimestamp {
+			lease.ExpireAtTimestamp = lease.HoldDeadlineTimestamp
+		}
+		preempted = lease.PreemptRequestedAtTimestamp != 0
+		if preempted && lease.PreemptDeadlineTimestamp == 0 {
+			lease.PreemptDeadlineTimestamp = time.Now().Unix() + lease.PreemptGracePeriodSeconds
+		}
+		SetLockLeaseIntoStoreValue(lease, value)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if preempted {
+		return ErrLeasePreempted
+	}
+	return nil
+}
+
 // If the acquirer is first in line or nobody else is waiting, update the lease with a new UUID.
 // If the acquirer is not first in line, they need to wait.
-func (backend *OptimisticLockingStorageBasedBackend) TakeIfOldest(handle lockgate.LockHandle, acquirerId string) (*LockLeaseRecord, error) {
+func (backend *OptimisticLockingStorageBasedBackend) TakeIfOldest(handle lockgate.LockHandle, opts AcquireOptions) (*LockLeaseRecord, error) {
+	acquirerId := opts.queueMemberId()
+
 	var newLease *LockLeaseRecord
 	err := backend.changeLease(handle, func(value *optimistic_locking_store.Value, currentLease *LockLeaseRecord) error {
 		nextUp := &QueueMember{}
@@ -119,8 +336,9 @@ func (backend *OptimisticLockingStorageBasedBackend) TakeIfOldest(handle lockgat
 			if k == acquirerId {
 				// Update expiration to hold acquirer's place in line
 				l.ExpireAtTimestamp = time.Now().Unix() + DistributedLockLeaseTTLSeconds
+				l.Priority = opts.Priority
 			}
-			if nextUp.AcquiredAtTimestamp == 0 || l.AcquiredAtTimestamp < nextUp.AcquiredAtTimestamp {
+			if nextUp.AcquiredAtTimestamp == 0 || l.IsAheadOf(nextUp) {
 				nextUp = l
 			}
 		}
@@ -136,6 +354,7 @@ func (backend *OptimisticLockingStorageBasedBackend) TakeIfOldest(handle lockgat
 					AcquirerId:          acquirerId,
 					AcquiredAtTimestamp: time.Now().Unix(),
 					ExpireAtTimestamp:   time.Now().Unix() + DistributedLockLeaseTTLSeconds,
+					Priority:            opts.Priority,
 				}
 			}
 		}
@@ -143,12 +362,13 @@ func (backend *OptimisticLockingStorageBasedBackend) TakeIfOldest(handle lockgat
 		if nextUp.AcquirerId == "" || nextUp.AcquirerId == acquirerId {
 			// Generate a new UUID for the new acquirer
 			currentLease.UUID = uuid.New().String()
+			currentLease.setHolder(opts)
 			currentLease.ExpireAtTimestamp = time.Now().Unix() + DistributedLockLeaseTTLSeconds
 			currentLease.SharedHoldersCount = 1
 			delete(currentLease.QueueMembers, acquirerId)
 			newLease = currentLease
 		}
-		setLockLeaseIntoStoreValue(currentLease, value)
+		SetLockLeaseIntoStoreValue(currentLease, value)
 
 		return nil
 	})
@@ -161,56 +381,112 @@ func (backend *OptimisticLockingStorageBasedBackend) TakeIfOldest(handle lockgat
 	return newLease, ErrShouldWait
 }
 
-// Renew queue member's expiration
-func (backend *OptimisticLockingStorageBasedBackend) UpdateQueue(handle lockgate.LockHandle, acquirerId string) error {
-	if acquirerId == "" {
-		return nil
-	}
-	return backend.changeLease(handle, func(value *optimistic_locking_store.Value, currentLease *LockLeaseRecord) error {
-		if _, ok := currentLease.QueueMembers[acquirerId]; ok {
-			currentLease.QueueMembers[acquirerId].ExpireAtTimestamp = time.Now().Unix() + DistributedLockLeaseTTLSeconds
-		} else {
-			currentLease.QueueMembers[acquirerId] = &QueueMember{
-				AcquirerId:          acquirerId,
-				AcquiredAtTimestamp: time.Now().Unix(),
-				ExpireAtTimestamp:   time.Now().Unix() + DistributedLockLeaseTTLSeconds,
-			}
+// Renew queue member's expiration, the acquirer with higher priority also requests the preemptible holder to release the lock
+func (backend *OptimisticLockingStorageBasedBackend) UpdateQueue(handle lockgate.LockHandle, opts AcquireOptions) error {
+	acquirerId := opts.queueMemberId()
+	return backend.changeLockLeaseRecord(handle.LockName, func(value *optimistic_locking_store.Value, currentLease *LockLeaseRecord) (bool, error) {
+		if currentLease == nil {
+			return false, ErrNoExistingLockLeaseFound
+		} else if currentLease.UUID != handle.UUID {
+			return false, ErrLockAlreadyLeased
 		}
 
-		setLockLeaseIntoStoreValue(currentLease, value)
+		var changed bool
 
-		return nil
+		if currentLease.Preemptible && opts.Priority > currentLease.Priority && currentLease.PreemptRequestedAtTimestamp == 0 {
+			debug("(update queue %q) acquirer %q with priority %d preempts the holder with priority %d", handle.LockName, acquirerId, opts.Priority, currentLease.Priority)
+			currentLease.PreemptRequestedAtTimestamp = time.Now().Unix()
+			changed = true
+		}
+
+		if acquirerId != "" {
+			if member, ok := currentLease.QueueMembers[acquirerId]; ok {
+				member.ExpireAtTimestamp = time.Now().Unix() + DistributedLockLeaseTTLSeconds
+				member.Priority = opts.Priority
+			} else {
+				currentLease.QueueMembers[acquirerId] = &QueueMember{
+					AcquirerId:          acquirerId,
+					AcquiredAtTimestamp: time.Now().Unix(),
+					ExpireAtTimestamp:   time.Now().Unix() + DistributedLockLeaseTTLSeconds,
+					Priority:            opts.Priority,
+				}
+			}
+			changed = true
+		}
+
+		if changed {
+			SetLockLeaseIntoStoreValue(currentLease, value)
+		}
+		return changed, nil
 	})
 }
 
 func (backend *OptimisticLockingStorageBasedBackend) Release(handle lockgate.LockHandle) error {
 	return backend.changeLease(handle, func(value *optimistic_locking_store.Value, currentLease *LockLeaseRecord) error {
-		currentLease.SharedHoldersCount--
-		now := time.Now().Unix()
-		var expired []string
-		for _, l := range currentLease.QueueMembers {
-			if l.ExpireAtTimestamp < now {
-				expired = append(expired, l.AcquirerId)
-			}
+		releaseLease(currentLease, value)
+		return nil
+	})
+}
+
+func releaseLease(currentLease *LockLeaseRecord, value *optimistic_locking_store.Value) {
+	currentLease.SharedHoldersCount--
+	now := time.Now().Unix()
+	var expired []string
+	for _, l := range currentLease.QueueMembers {
+		if l.ExpireAtTimestamp < now {
+			expired = append(expired, l.AcquirerId)
 		}
-		for _, key := range expired {
-			delete(currentLease.QueueMembers, key)
+	}
+	for _, key := range expired {
+		delete(currentLease.QueueMembers, key)
+	}
+
+	if currentLease.SharedHoldersCount == 0 {
+		if len(currentLease.QueueMembers) == 0 {
+			UnsetLockLeaseFromStoreValue(currentLease, value)
+			return
 		}
+		// Expire the lease so the waiting QueueMembers can acquire it
+		currentLease.ExpireAtTimestamp = time.Now().Add(-1 * time.Second).Unix()
+	}
+	SetLockLeaseIntoStoreValue(currentLease, value)
+}
 
-		if currentLease.SharedHoldersCount == 0 {
-			if len(currentLease.QueueMembers) == 0 {
-				unsetLockLeaseFromStoreValue(value)
-				return nil
-			}
-			// Expire the lease so the waiting QueueMembers can acquire it
-			currentLease.ExpireAtTimestamp = time.Now().Add(-1 * time.Second).Unix()
+// LeaveQueue removes the acquirer from the wait queue of the lock.
+func (backend *OptimisticLockingStorageBasedBackend) LeaveQueue(lockName, acquirerId string) error {
+	return backend.changeLockLeaseRecord(lockName, func(value *optimistic_locking_store.Value, currentLease *LockLeaseRecord) (bool, error) {
+		if currentLease == nil {
+			return false, nil
+		}
+		if _, ok := currentLease.QueueMembers[acquirerId]; !ok {
+			return false, nil
 		}
-		setLockLeaseIntoStoreValue(currentLease, value)
 
-		return nil
+		delete(currentLease.QueueMembers, acquirerId)
+		SetLockLeaseIntoStoreValue(currentLease, value)
+
+		return true, nil
+	})
+}
+
+// changeLockLeaseRecord calls changeFunc with the current lease of the lock regardless of the lease owner,
+// currentLease is nil when there is no lease. Store value is updated only when changeFunc returns true.
+func (backend *OptimisticLockingStorageBasedBackend) changeLockLeaseRecord(lockName string, changeFunc func(value *optimistic_locking_store.Value, currentLease *LockLeaseRecord) (bool, error)) error {
+	return backend.changeStoreValue(backend.keyName(lockName), func(value *optimistic_locking_store.Value) (bool, error) {
+		currentLease, err := ExtractLockLeaseFromStoreValue(value)
+		if err != nil {
+			return false, err
+		}
+		return changeFunc(value, currentLease)
 	})
 }
 
+// changeStoreValue calls changeFunc with the current store value by the key and puts the value back into the store
+// when changeFunc returns true. The whole procedure is retried when the value has been changed by someone else meanwhile.
+func (backend *OptimisticLockingStorageBasedBackend) changeStoreValue(storeKeyName string, changeFunc func(value *optimistic_locking_store.Value) (bool, error)) error {
+	return optimistic_locking_store.ChangeValue(backend.Store, storeKeyName, DistributedOptimisticLockingRetryPeriodSeconds*time.Second, changeFunc)
+}
+
 func (backend *OptimisticLockingStorageBasedBackend) changeLease(lockHandle lockgate.LockHandle, changeFunc func(value *optimistic_locking_store.Value, currentLease *LockLeaseRecord) error) error {
 	storeKeyName := backend.keyName(lockHandle.LockName)
 
@@ -220,7 +496,7 @@ RETRY_CHANGE:
 	} else {
 		debug("(change lock %q lease) get store value by key %s -> %#v", lockHandle.LockName, storeKeyName, value)
 
-		if currentLease, err := extractLockLeaseFromStoreValue(value); err != nil {
+		if currentLease, err := ExtractLockLeaseFromStoreValue(value); err != nil {
 			return err
 		} else if currentLease == nil {
 			return ErrNoExistingLockLeaseFound
@@ -244,7 +520,9 @@ RETRY_CHANGE:
 	}
 }
 
-func extractLockLeaseFromStoreValue(value *optimistic_locking_store.Value) (*LockLeaseRecord, error) {
+// ExtractLockLeaseFromStoreValue returns nil when the lock is not held, the record of the released lock
+// is kept to keep the fencing token and the state of the condition variable of the lock.
+func ExtractLockLeaseFromStoreValue(value *optimistic_locking_store.Value) (*LockLeaseRecord, error) {
 	if value.Data == "" {
 		return nil, nil
 	}
@@ -253,17 +531,55 @@ func extractLockLeaseFromStoreValue(value *optimistic_locking_store.Value) (*Loc
 	if err := json.Unmarshal([]byte(value.Data), &lease); err != nil {
 		return nil, err
 	}
+	if lease == nil || lease.UUID == "" {
+		return nil, nil
+	}
 	return lease, nil
 }
 
-func setLockLeaseIntoStoreValue(lease *LockLeaseRecord, value *optimistic_locking_store.Value) {
-	if data, err := json.Marshal(lease); err != nil {
-		panic(fmt.Sprintf("json marshal %#v failed: %s", lease, err))
-	} else {
-		value.Data = string(data)
+// SetLockLeaseIntoStoreValue puts the lease into the store value. The new lease takes over the state
+// of the condition variable from the record of the released lock and gets the next fencing token of the lock.
+func SetLockLeaseIntoStoreValue(lease *LockLeaseRecord, value *optimistic_locking_store.Value) {
+	prevRecord := &LockLeaseRecord{}
+	if _, err := extractRecordFromStoreValue(value, prevRecord); err != nil {
+		prevRecord = &LockLeaseRecord{}
+	}
+
+	if lease.Cond == nil {
+		lease.Cond = prevRecord.Cond
+	}
+	if lease.UUID != prevRecord.UUID {
+		lease.FencingToken = prevRecord.FencingToken + 1
+	}
+	setRecordIntoStoreValue(lease, value)
+}
+
+// UnsetLockLeaseFromStoreValue removes the lease from the store value. The record of the released lock is kept
+// with the last fencing token, so that the fencing token of the next lease is greater regardless of clocks of the hosts,
+// and with the state of the condition variable of the lock.
+func UnsetLockLeaseFromStoreValue(lease *LockLeaseRecord, value *optimistic_locking_store.Value) {
+	setRecordIntoStoreValue(&LockLeaseRecord{
+		LockHandle: lockgate.LockHandle{LockName: lease.LockName, FencingToken: lease.FencingToken},
+		Cond:       lease.Cond,
+	}, value)
+}
+
+// extractRecordFromStoreValue unmarshals the store value data into the record, returns false when there is no data.
+func extractRecordFromStoreValue(value *optimistic_locking_store.Value, record interface{}) (bool, error) {
+	if value.Data == "" {
+		return false, nil
 	}
+
+	if err := json.Unmarshal([]byte(value.Data), record); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
-func unsetLockLeaseFromStoreValue(value *optimistic_locking_store.Value) {
-	value.Data = ""
+func setRecordIntoStoreValue(record interface{}, value *optimistic_locking_store.Value) {
+	if data, err := json.Marshal(record); err != nil {
+		panic(fmt.Sprintf("json marshal %#v failed: %s", record, err))
+	} else {
+		value.Data = string(data)
+	}
 }
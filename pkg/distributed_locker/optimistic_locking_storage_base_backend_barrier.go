@@ -0,0 +1,350 @@
+package distributed_locker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+)
+
+// BarrierRecord is a versioned record of the barrier arrivals. Arrivals are leased by participants
+// while waiting, so that crashed participants are not counted. The generation is incremented and arrivals
+// are reset each time all parties arrive. Participants of the done generation stay in Released until they
+// observe the generation done, the record is deleted when there are no arrivals and released participants.
+type BarrierRecord struct {
+	Parties    int
+	Generation int64
+	Arrivals   map[string]*BarrierArrival
+	Released   map[string]int64
+}
+
+type BarrierArrival struct {
+	ParticipantId     string
+	ExpireAtTimestamp int64
+}
+
+// LatchRecord is a versioned record of the countdown latch. Participants which joined the latch
+// lease their pending state until they count down, expired participants are reported as lost.
+// Waiters lease their registration until they observe the latch counted down.
+type LatchRecord struct {
+	Count        int
+	CountedDown  map[string]int64
+	Participants map[string]*LatchParticipant
+	Waiters      map[string]int64
+}
+
+type LatchParticipant struct {
+	ParticipantId     string
+	ExpireAtTimestamp int64
+}
+
+// BarrierArrive registers participant arrival and returns the generation of the barrier the participant waits for.
+func (backend *OptimisticLockingStorageBasedBackend) BarrierArrive(name string, parties int, participantId string) (int64, error) {
+	var generation int64
+
+	if parties < 1 {
+		return 0, fmt.Errorf("barrier %q should have at least 1 party, got %d", name, parties)
+	}
+
+	err := backend.changeStoreValue(backend.recordKeyName("barrier", name), func(value *optimistic_locking_store.Value) (bool, error) {
+		record, err := extractBarrierFromStoreValue(value)
+		if err != nil {
+			return false, err
+		}
+		if record == nil {
+			record = newBarrierRecord(parties)
+		} else if record.Parties != parties {
+			return false, fmt.Errorf("barrier %q has %d parties, got %d", name, record.Parties, parties)
+		}
+
+		removeExpiredBarrierArrivals(record)
+
+		generation = record.Generation
+		record.Arrivals[participantId] = &BarrierArrival{
+			ParticipantId:     participantId,
+			ExpireAtTimestamp: time.Now().Unix() + DistributedLockLeaseTTLSeconds,
+		}
+
+		if len(record.Arrivals) >= record.Parties {
+			debug("(barrier %q) all %d parties arrived, generation %d done", name, record.Parties, record.Generation)
+			releaseBarrierArrivals(record, "")
+		}
+
+		setBarrierIntoStoreValue(record, value)
+		return true, nil
+	})
+
+	return generation, err
+}
+
+// BarrierPoll returns true when the barrier generation is done, otherwise renews the participant arrival.
+func (backend *OptimisticLockingStorageBasedBackend) BarrierPoll(name, participantId string, generation int64) (bool, error) {
+	var done bool
+
+	err := backend.changeStoreValue(backend.recordKeyName("barrier", name), func(value *optimistic_locking_store.Value) (bool, error) {
+		record, err := extractBarrierFromStoreValue(value)
+		if err != nil {
+			return false, err
+		}
+		if record == nil {
+			return false, fmt.Errorf("barrier %q not found", name)
+		}
+
+		removeExpiredBarrierArrivals(record)
+
+		if record.Generation > generation {
+			done = true
+			delete(record.Released, participantId)
+			setBarrierIntoStoreValue(record, value)
+			return true, nil
+		}
+
+		// Participant arrival could expire when participant was not able to renew it in time
+		record.Arrivals[participantId] = &BarrierArrival{
+			ParticipantId:     participantId,
+			ExpireAtTimestamp: time.Now().Unix() + DistributedLockLeaseTTLSeconds,
+		}
+
+		if len(record.Arrivals) >= record.Parties {
+			releaseBarrierArrivals(record, participantId)
+			done = true
+		}
+
+		setBarrierIntoStoreValue(record, value)
+		return true, nil
+	})
+
+	return done, err
+}
+
+// BarrierLeave removes the participant arrival, which has not been completed yet.
+func (backend *OptimisticLockingStorageBasedBackend) BarrierLeave(name, participantId string) error {
+	return backend.changeStoreValue(backend.recordKeyName("barrier", name), func(value *optimistic_locking_store.Value) (bool, error) {
+		record, err := extractBarrierFromStoreValue(value)
+		if err != nil {
+			return false, err
+		}
+		if record == nil {
+			return false, nil
+		}
+		if _, hasKey := record.Arrivals[participantId]; !hasKey {
+			return false, nil
+		}
+
+		delete(record.Arrivals, participantId)
+		setBarrierIntoStoreValue(record, value)
+		return true, nil
+	})
+}
+
+// LatchJoin registers participant of the latch or renews the participant lease.
+func (backend *OptimisticLockingStorageBasedBackend) LatchJoin(name string, count int, participantId string) error {
+	return backend.changeLatch(name, count, func(record *LatchRecord) bool {
+		if _, hasKey := record.CountedDown[participantId]; hasKey {
+			return false
+		}
+
+		record.Participants[participantId] = &LatchParticipant{
+			ParticipantId:     participantId,
+			ExpireAtTimestamp: time.Now().Unix() + DistributedLockLeaseTTLSeconds,
+		}
+		return true
+	})
+}
+
+// LatchCountDown counts down the latch once per participant.
+func (backend *OptimisticLockingStorageBasedBackend) LatchCountDown(name string, count int, participantId string) error {
+	return backend.changeLatch(name, count, func(record *LatchRecord) bool {
+		if _, hasKey := record.CountedDown[participantId]; hasKey {
+			return false
+		}
+
+		delete(record.Participants, participantId)
+		record.CountedDown[participantId] = time.Now().Unix()
+		return true
+	})
+}
+
+// GetLatchState returns the state of the latch, the latch which does not exist yet has all count remaining.
+func (backend *OptimisticLockingStorageBasedBackend) GetLatchState(name string, count int) (*LatchState, error) {
+	storeKeyName := backend.recordKeyName("latch", name)
+
+	value, err := backend.Store.GetValue(storeKeyName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get store value by name %s: %s", storeKeyName, err)
+	}
+
+	record, err := extractLatchFromStoreValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract latch record from data record by key %s: %s", storeKeyName, err)
+	}
+	if record == nil {
+		return &LatchState{Count: count, Remaining: count}, nil
+	} else if record.Count != count {
+		return nil, fmt.Errorf("latch %q has count %d, got %d", name, record.Count, count)
+	}
+
+	return newLatchState(record), nil
+}
+
+// LatchWait registers or renews the waiter of the latch and returns the state of the latch. The waiter is
+// unregistered when the latch is counted down, the last unregistered waiter deletes the record of the latch.
+func (backend *OptimisticLockingStorageBasedBackend) LatchWait(name string, count int, waiterId string) (*LatchState, error) {
+	var state *LatchState
+
+	err := backend.changeStoreValue(backend.recordKeyName("latch", name), func(value *optimistic_locking_store.Value) (bool, error) {
+		record, err := extractLatchFromStoreValue(value)
+		if err != nil {
+			return false, err
+		}
+		if record == nil {
+			record = newLatchRecord(count)
+		} else if record.Count != count {
+			return false, fmt.Errorf("latch %q has count %d, got %d", name, record.Count, count)
+		}
+
+		now := time.Now().Unix()
+		for id, expireAt := range record.Waiters {
+			if expireAt < now {
+				delete(record.Waiters, id)
+			}
+		}
+
+		state = newLatchState(record)
+		if state.Remaining > 0 {
+			record.Waiters[waiterId] = now + DistributedLockLeaseTTLSeconds
+			setRecordIntoStoreValue(record, value)
+			return true, nil
+		}
+
+		delete(record.Waiters, waiterId)
+		if len(record.Waiters) == 0 {
+			debug("(latch %q) counted down and observed by all waiters: removing latch", name)
+			value.Data = ""
+		} else {
+			setRecordIntoStoreValue(record, value)
+		}
+		return true, nil
+	})
+
+	return state, err
+}
+
+func newLatchState(record *LatchRecord) *LatchState {
+	state := &LatchState{Count: record.Count, Remaining: record.Count - len(record.CountedDown)}
+	if state.Remaining < 0 {
+		state.Remaining = 0
+	}
+
+	now := time.Now().Unix()
+	for _, participant := range record.Participants {
+		if participant.ExpireAtTimestamp < now {
+			state.LostParticipants = append(state.LostParticipants, participant.ParticipantId)
+		}
+	}
+
+	return state
+}
+
+func (backend *OptimisticLockingStorageBasedBackend) changeLatch(name string, count int, changeFunc func(record *LatchRecord) bool) error {
+	return backend.changeStoreValue(backend.recordKeyName("latch", name), func(value *optimistic_locking_store.Value) (bool, error) {
+		record, err := extractLatchFromStoreValue(value)
+		if err != nil {
+			return false, err
+		}
+		if record == nil {
+			record = newLatchRecord(count)
+		} else if record.Count != count {
+			return false, fmt.Errorf("latch %q has count %d, got %d", name, record.Count, count)
+		}
+
+		if !changeFunc(record) {
+			return false, nil
+		}
+
+		setRecordIntoStoreValue(record, value)
+		return true, nil
+	})
+}
+
+func newBarrierRecord(parties int) *BarrierRecord {
+	return &BarrierRecord{
+		Parties:  parties,
+		Arrivals: make(map[string]*BarrierArrival),
+		Released: make(map[string]int64),
+	}
+}
+
+func newLatchRecord(count int) *LatchRecord {
+	return &LatchRecord{
+		Count:        count,
+		CountedDown:  make(map[string]int64),
+		Participants: make(map[string]*LatchParticipant),
+		Waiters:      make(map[string]int64),
+	}
+}
+
+// releaseBarrierArrivals completes the current generation of the barrier,
+// the participant completing the generation observes it done immediately.
+func releaseBarrierArrivals(record *BarrierRecord, participantId string) {
+	for key := range record.Arrivals {
+		if key != participantId {
+			record.Released[key] = time.Now().Unix() + DistributedLockLeaseTTLSeconds
+		}
+	}
+	record.Generation++
+	record.Arrivals = make(map[string]*BarrierArrival)
+}
+
+func removeExpiredBarrierArrivals(record *BarrierRecord) {
+	now := time.Now().Unix()
+	for key, arrival := range record.Arrivals {
+		if arrival.ExpireAtTimestamp < now {
+			delete(record.Arrivals, key)
+		}
+	}
+	for key, expireAt := range record.Released {
+		if expireAt < now {
+			delete(record.Released, key)
+		}
+	}
+}
+
+func setBarrierIntoStoreValue(record *BarrierRecord, value *optimistic_locking_store.Value) {
+	if len(record.Arrivals) == 0 && len(record.Released) == 0 {
+		value.Data = ""
+	} else {
+		setRecordIntoStoreValue(record, value)
+	}
+}
+
+func extractBarrierFromStoreValue(value *optimistic_locking_store.Value) (*BarrierRecord, error) {
+	record := &BarrierRecord{}
+	if exists, err := extractRecordFromStoreValue(value, record); err != nil || !exists {
+		return nil, err
+	}
+	if record.Arrivals == nil {
+		record.Arrivals = make(map[string]*BarrierArrival)
+	}
+	if record.Released == nil {
+		record.Released = make(map[string]int64)
+	}
+	return record, nil
+}
+
+func extractLatchFromStoreValue(value *optimistic_locking_store.Value) (*LatchRecord, error) {
+	record := &LatchRecord{}
+	if exists, err := extractRecordFromStoreValue(value, record); err != nil || !exists {
+		return nil, err
+	}
+	if record.CountedDown == nil {
+		record.CountedDown = make(map[string]int64)
+	}
+	if record.Participants == nil {
+		record.Participants = make(map[string]*LatchParticipant)
+	}
+	if record.Waiters == nil {
+		record.Waiters = make(map[string]int64)
+	}
+	return record, nil
+}
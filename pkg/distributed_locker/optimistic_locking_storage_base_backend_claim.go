@@ -0,0 +1,136 @@
+package distributed_locker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/werf/lockgate"
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+)
+
+// ClaimDoneRecord is a versioned record of the item, which holds the lease UUID of the worker which claimed
+// the item last, so that only that worker is able to complete the item.
+type ClaimDoneRecord struct {
+	HolderUUID           string `json:"holderUUID,omitempty"`
+	CompletedAtTimestamp int64  `json:"completedAtTimestamp,omitempty"`
+}
+
+// Claim acquires exclusive leases on up to max candidate items of the queue, skipping items
+// which are held by others or have been completed.
+func (backend *OptimisticLockingStorageBasedBackend) Claim(queue string, candidates []string, max int) ([]ClaimedItem, error) {
+	var claimed []ClaimedItem
+
+	for _, item := range candidates {
+		if len(claimed) >= max {
+			break
+		}
+
+		if done, err := backend.isClaimDone(queue, item); err != nil {
+			return claimed, err
+		} else if done {
+			debug("(claim %q) item %q is done, skip", queue, item)
+			continue
+		}
+
+		handle, err := backend.Acquire(ClaimLockName(queue, item), AcquireOptions{})
+		if IsErrShouldWait(err) || IsErrLockDrained(err) || IsErrLockReserved(err) {
+			debug("(claim %q) item %q is claimed by others, drained or reserved, skip", queue, item)
+			continue
+		} else if err != nil {
+			return claimed, fmt.Errorf("unable to claim item %q of queue %q: %s", item, queue, err)
+		}
+
+		// Item could be completed by other worker right before the lease has been acquired
+		if done, err := backend.setClaimHolder(queue, item, handle); err != nil {
+			if err := backend.Release(handle); err != nil {
+				return claimed, fmt.Errorf("unable to release item %q of queue %q: %s", item, queue, err)
+			}
+			return claimed, err
+		} else if done {
+			if err := backend.Release(handle); err != nil {
+				return claimed, fmt.Errorf("unable to release completed item %q of queue %q: %s", item, queue, err)
+			}
+			continue
+		}
+
+		claimed = append(claimed, ClaimedItem{Queue: queue, Item: item, Handle: handle})
+	}
+
+	return claimed, nil
+}
+
+// CompleteClaim marks the item as done so that it will never be claimed again,
+// the lease of the item is not released. The item is completed only if it has not been claimed
+// by another worker since the handle was claimed, which is checked in the same write.
+func (backend *OptimisticLockingStorageBasedBackend) CompleteClaim(queue, item string, handle lockgate.LockHandle) error {
+	return backend.changeStoreValue(backend.claimDoneKeyName(queue, item), func(value *optimistic_locking_store.Value) (bool, error) {
+		record := &ClaimDoneRecord{}
+		if exists, err := extractRecordFromStoreValue(value, record); err != nil {
+			return false, err
+		} else if !exists {
+			return false, ErrNoExistingLockLeaseFound
+		} else if record.HolderUUID != handle.UUID {
+			return false, ErrLockAlreadyLeased
+		} else if record.CompletedAtTimestamp != 0 {
+			return false, nil
+		}
+
+		record.CompletedAtTimestamp = time.Now().Unix()
+		setRecordIntoStoreValue(record, value)
+		return true, nil
+	})
+}
+
+// ForgetClaim deletes the record of the item.
+func (backend *OptimisticLockingStorageBasedBackend) ForgetClaim(queue, item string) error {
+	return backend.changeStoreValue(backend.claimDoneKeyName(queue, item), func(value *optimistic_locking_store.Value) (bool, error) {
+		if value.Data == "" {
+			return false, nil
+		}
+
+		value.Data = ""
+		return true, nil
+	})
+}
+
+// setClaimHolder records the lease of the handle as the holder of the item, returns true if the item is done.
+func (backend *OptimisticLockingStorageBasedBackend) setClaimHolder(queue, item string, handle lockgate.LockHandle) (bool, error) {
+	var done bool
+
+	err := backend.changeStoreValue(backend.claimDoneKeyName(queue, item), func(value *optimistic_locking_store.Value) (bool, error) {
+		record := &ClaimDoneRecord{}
+		if _, err := extractRecordFromStoreValue(value, record); err != nil {
+			return false, err
+		}
+
+		done = record.CompletedAtTimestamp != 0
+		if done {
+			return false, nil
+		}
+
+		record.HolderUUID = handle.UUID
+		setRecordIntoStoreValue(record, value)
+		return true, nil
+	})
+
+	return done, err
+}
+
+func (backend *OptimisticLockingStorageBasedBackend) isClaimDone(queue, item string) (bool, error) {
+	storeKeyName := backend.claimDoneKeyName(queue, item)
+
+	value, err := backend.Store.GetValue(storeKeyName)
+	if err != nil {
+		return false, fmt.Errorf("unable to get store value by name %s: %s", storeKeyName, err)
+	}
+
+	record := &ClaimDoneRecord{}
+	if _, err := extractRecordFromStoreValue(value, record); err != nil {
+		return false, fmt.Errorf("unable to extract claim done record from data record by key %s: %s", storeKeyName, err)
+	}
+	return record.CompletedAtTimestamp != 0, nil
+}
+
+func (backend *OptimisticLockingStorageBasedBackend) claimDoneKeyName(queue, item string) string {
+	return backend.recordKeyName("claim-done", ClaimLockName(queue, item))
+}
@@ -0,0 +1,191 @@
+package distributed_locker
+
+import (
+	"time"
+
+	"github.com/werf/lockgate"
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+)
+
+// CondRecord is the state of the condition variable kept in the lock lease record.
+// Broadcast increments the generation to wake all waiters registered in the previous generations,
+// Signal wakes the oldest registered waiter. Waiters lease their entries while waiting.
+//
+// The state is removed from the lock record when no waiters are left, a waiter which has not been able
+// to renew its entry in time may then miss the wake up and waits for the next one.
+type CondRecord struct {
+	Generation int64
+	Waiters    map[string]*CondWaiter
+}
+
+type CondWaiter struct {
+	WaiterId            string
+	Generation          int64
+	RegisteredTimestamp int64
+	Signaled            bool
+	ExpireAtTimestamp   int64
+}
+
+// CondRegisterAndRelease registers the waiter of the condition variable and releases the lock held by the handle
+// in a single write of the lock lease record, returns the generation the waiter waits in.
+func (backend *OptimisticLockingStorageBasedBackend) CondRegisterAndRelease(handle lockgate.LockHandle, waiterId string) (int64, error) {
+	var generation int64
+
+	err := backend.changeLease(handle, func(value *optimistic_locking_store.Value, currentLease *LockLeaseRecord) error {
+		if currentLease.Cond == nil {
+			currentLease.Cond = &CondRecord{}
+		}
+		cond := currentLease.Cond
+		removeExpiredCondWaiters(cond)
+
+		now := time.Now().Unix()
+		generation = cond.Generation
+		cond.Waiters[waiterId] = &CondWaiter{
+			WaiterId:            waiterId,
+			Generation:          cond.Generation,
+			RegisteredTimestamp: now,
+			ExpireAtTimestamp:   now + DistributedLockLeaseTTLSeconds,
+		}
+
+		releaseLease(currentLease, value)
+		return nil
+	})
+
+	return generation, err
+}
+
+// CondPoll returns true when the waiter has been woken up, otherwise renews the waiter entry.
+func (backend *OptimisticLockingStorageBasedBackend) CondPoll(lockName, waiterId string, generation int64) (bool, error) {
+	var woken bool
+
+	err := backend.changeCond(lockName, true, func(cond *CondRecord) bool {
+		// Wake up is checked before expired waiters are removed, so that the slow waiter does not miss the signal
+		waiter, hasKey := cond.Waiters[waiterId]
+		if cond.Generation > generation || (hasKey && waiter.Signaled) {
+			woken = true
+			delete(cond.Waiters, waiterId)
+			removeExpiredCondWaiters(cond)
+			return true
+		}
+
+		removeExpiredCondWaiters(cond)
+
+		if !hasKey {
+			// Waiter entry could expire when waiter was not able to renew it in time
+			waiter = &CondWaiter{
+				WaiterId:            waiterId,
+				Generation:          generation,
+				RegisteredTimestamp: time.Now().Unix(),
+			}
+			cond.Waiters[waiterId] = waiter
+		}
+		waiter.ExpireAtTimestamp = time.Now().Unix() + DistributedLockLeaseTTLSeconds
+
+		return true
+	})
+
+	return woken, err
+}
+
+// CondSignal wakes the oldest waiter of the condition variable, does nothing when there are no waiters.
+func (backend *OptimisticLockingStorageBasedBackend) CondSignal(lockName string) error {
+	return backend.changeCond(lockName, false, func(cond *CondRecord) bool {
+		removeExpiredCondWaiters(cond)
+
+		var next *CondWaiter
+		for _, waiter := range cond.Waiters {
+			if waiter.Signaled || waiter.Generation < cond.Generation {
+				continue
+			}
+			if next == nil || waiter.RegisteredTimestamp < next.RegisteredTimestamp || (waiter.RegisteredTimestamp == next.RegisteredTimestamp && waiter.WaiterId < next.WaiterId) {
+				next = waiter
+			}
+		}
+
+		if next == nil {
+			return false
+		}
+		next.Signaled = true
+
+		return true
+	})
+}
+
+// CondLeave removes the waiter which stops waiting without being woken up,
+// the signal already sent to the waiter is passed to the next waiter.
+func (backend *OptimisticLockingStorageBasedBackend) CondLeave(lockName, waiterId string) error {
+	var isSignaled bool
+
+	if err := backend.changeCond(lockName, false, func(cond *CondRecord) bool {
+		waiter, hasKey := cond.Waiters[waiterId]
+		if !hasKey {
+			return false
+		}
+
+		isSignaled = waiter.Signaled
+		delete(cond.Waiters, waiterId)
+		return true
+	}); err != nil {
+		return err
+	}
+
+	if isSignaled {
+		return backend.CondSignal(lockName)
+	}
+	return nil
+}
+
+// CondBroadcast wakes all waiters of the condition variable. Expired waiters are not removed,
+// they are woken up as well when they manage to poll the condition variable.
+func (backend *OptimisticLockingStorageBasedBackend) CondBroadcast(lockName string) error {
+	return backend.changeCond(lockName, false, func(cond *CondRecord) bool {
+		cond.Generation++
+		return true
+	})
+}
+
+// changeCond calls changeFunc with the state of the condition variable of the lock regardless of the lease owner.
+// When the lock has no condition variable state, the state is created only if shouldCreate is set:
+// no waiter has ever been registered otherwise, so there is nobody to wake up.
+func (backend *OptimisticLockingStorageBasedBackend) changeCond(lockName string, shouldCreate bool, changeFunc func(cond *CondRecord) bool) error {
+	return backend.changeStoreValue(backend.keyName(lockName), func(value *optimistic_locking_store.Value) (bool, error) {
+		record := &LockLeaseRecord{}
+		if _, err := extractRecordFromStoreValue(value, record); err != nil {
+			return false, err
+		}
+
+		if record.Cond == nil {
+			if !shouldCreate {
+				return false, nil
+			}
+			record.LockName = lockName
+			record.Cond = &CondRecord{}
+		}
+		if record.Cond.Waiters == nil {
+			record.Cond.Waiters = make(map[string]*CondWaiter)
+		}
+
+		if !changeFunc(record.Cond) {
+			return false, nil
+		}
+		if len(record.Cond.Waiters) == 0 {
+			record.Cond = nil
+		}
+
+		setRecordIntoStoreValue(record, value)
+		return true, nil
+	})
+}
+
+func removeExpiredCondWaiters(cond *CondRecord) {
+	if cond.Waiters == nil {
+		cond.Waiters = make(map[string]*CondWaiter)
+	}
+
+	now := time.Now().Unix()
+	for key, waiter := range cond.Waiters {
+		if waiter.ExpireAtTimestamp < now {
+			delete(cond.Waiters, key)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package distributed_locker
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+)
+
+// DrainsRecord keeps all drains in a single record, so that drains can be listed and checked by Acquire with a single read.
+type DrainsRecord struct {
+	Drains map[string]*Drain
+}
+
+func (backend *OptimisticLockingStorageBasedBackend) SetDrain(drain *Drain) error {
+	if drain.Pattern == "" {
+		return fmt.Errorf("drain pattern should be specified")
+	}
+
+	return backend.changeDrains(func(record *DrainsRecord) bool {
+		record.Drains[drain.Pattern] = drain
+		return true
+	})
+}
+
+func (backend *OptimisticLockingStorageBasedBackend) LiftDrain(pattern string) error {
+	return backend.changeDrains(func(record *DrainsRecord) bool {
+		if _, ok := record.Drains[pattern]; !ok {
+			return false
+		}
+		delete(record.Drains, pattern)
+		return true
+	})
+}
+
+// ListDrains returns active drains sorted by pattern.
+func (backend *OptimisticLockingStorageBasedBackend) ListDrains() ([]*Drain, error) {
+	record, err := backend.getDrains()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*Drain
+	now := time.Now()
+	for _, drain := range record.Drains {
+		if !drain.IsExpired(now) {
+			res = append(res, drain)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Pattern < res[j].Pattern })
+
+	return res, nil
+}
+
+// extractLockDrain returns an active drain matching the lock name if any from the drains record value.
+func (backend *OptimisticLockingStorageBasedBackend) extractLockDrain(value *optimistic_locking_store.Value, lockName string) (*Drain, error) {
+	record := &DrainsRecord{}
+	if _, err := extractRecordFromStoreValue(value, record); err != nil {
+		return nil, fmt.Errorf("unable to extract drains record from data record by key %s: %s", backend.drainsKeyName(), err)
+	}
+
+	now := time.Now()
+	for _, drain := range record.Drains {
+		if !drain.IsExpired(now) && drain.Matches(lockName) {
+			return drain, nil
+		}
+	}
+	return nil, nil
+}
+
+func (backend *OptimisticLockingStorageBasedBackend) getDrains() (*DrainsRecord, error) {
+	storeKeyName := backend.drainsKeyName()
+
+	value, err := backend.Store.GetValue(storeKeyName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get store value by name %s: %s", storeKeyName, err)
+	}
+
+	record := &DrainsRecord{}
+	if _, err := extractRecordFromStoreValue(value, record); err != nil {
+		return nil, fmt.Errorf("unable to extract drains record from data record by key %s: %s", storeKeyName, err)
+	}
+	return record, nil
+}
+
+// changeDrains also removes expired drains from the record.
+func (backend *OptimisticLockingStorageBasedBackend) changeDrains(changeFunc func(record *DrainsRecord) bool) error {
+	storeKeyName := backend.drainsKeyName()
+
+	return backend.changeStoreValue(storeKeyName, func(value *optimistic_locking_store.Value) (bool, error) {
+		record := &DrainsRecord{}
+		if _, err := extractRecordFromStoreValue(value, record); err != nil {
+			return false, fmt.Errorf("unable to extract drains record from data record by key %s: %s", storeKeyName, err)
+		}
+		if record.Drains == nil {
+			record.Drains = make(map[string]*Drain)
+		}
+
+		var changed bool
+		now := time.Now()
+		for pattern, drain := range record.Drains {
+			if drain.IsExpired(now) {
+				delete(record.Drains, pattern)
+				changed = true
+			}
+		}
+
+		if changeFunc(record) {
+			changed = true
+		}
+		if !changed {
+			return false, nil
+		}
+
+		if len(record.Drains) == 0 {
+			value.Data = ""
+		} else {
+			setRecordIntoStoreValue(record, value)
+		}
+		return true, nil
+	})
+}
+
+func (backend *OptimisticLockingStorageBasedBackend) drainsKeyName() string {
+	return backend.recordKeyName("drains", "drains")
+}
@@ -0,0 +1,225 @@
+package distributed_locker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/werf/lockgate"
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+)
+
+// PoolQueueRecord is a single wait queue of acquirers shared by all locks of the pool.
+type PoolQueueRecord struct {
+	QueueMembers map[string]*QueueMember
+}
+
+// AcquireAny acquires the first available lock of the pool. Acquirer with AcquirerId takes its place
+// in the queue of the pool and gets a lock only when there are enough available locks for all acquirers
+// which have been waiting longer. The acquired lease is held by the acquirer as with Acquire.
+func (backend *OptimisticLockingStorageBasedBackend) AcquireAny(lockNames []string, opts AcquireOptions) (lockgate.LockHandle, error) {
+	if opts.AcquirerId == "" {
+		return backend.acquireFirstAvailable(lockNames, opts)
+	}
+
+	lockOpts := opts
+	lockOpts.inPoolQueue = true
+
+	availableLockNames, err := backend.getAvailableLockNames(lockNames, opts)
+	if err != nil {
+		return lockgate.LockHandle{}, err
+	}
+
+	position, err := backend.updatePoolQueue(lockNames, opts.AcquirerId, opts.Priority)
+	if err != nil {
+		return lockgate.LockHandle{}, err
+	}
+	debug("(acquire any %v) acquirer %q position in the pool queue is %d, available locks: %v", lockNames, opts.AcquirerId, position, availableLockNames)
+
+	if position >= len(availableLockNames) {
+		return lockgate.LockHandle{}, ErrShouldWait
+	}
+
+	handle, err := backend.acquireFirstAvailable(availableLockNames, lockOpts)
+	if err != nil {
+		return lockgate.LockHandle{}, err
+	}
+
+	if err := backend.LeaveQueueAny(lockNames, opts.AcquirerId); err != nil {
+		if releaseErr := backend.Release(handle); releaseErr != nil {
+			return lockgate.LockHandle{}, fmt.Errorf("unable to leave queue of pool %v: %s, unable to release lock %q: %s", lockNames, err, handle.LockName, releaseErr)
+		}
+		return lockgate.LockHandle{}, err
+	}
+
+	return handle, nil
+}
+
+// LeaveQueueAny removes the acquirer from the wait queue of the pool.
+func (backend *OptimisticLockingStorageBasedBackend) LeaveQueueAny(lockNames []string, acquirerId string) error {
+	return backend.changeStoreValue(backend.poolKeyName(lockNames), func(value *optimistic_locking_store.Value) (bool, error) {
+		record, err := extractPoolQueueFromStoreValue(value)
+		if err != nil {
+			return false, err
+		}
+		if record == nil {
+			return false, nil
+		}
+		if _, ok := record.QueueMembers[acquirerId]; !ok {
+			return false, nil
+		}
+
+		delete(record.QueueMembers, acquirerId)
+		setPoolQueueIntoStoreValue(record, value)
+
+		return true, nil
+	})
+}
+
+func (backend *OptimisticLockingStorageBasedBackend) acquireFirstAvailable(lockNames []string, opts AcquireOptions) (lockgate.LockHandle, error) {
+	for _, lockName := range lockNames {
+		if handle, err := backend.Acquire(lockName, opts); IsErrShouldWait(err) || IsErrLockDrained(err) || IsErrLockReserved(err) {
+			continue
+		} else if err != nil {
+			return lockgate.LockHandle{}, err
+		} else {
+			return handle, nil
+		}
+	}
+
+	return lockgate.LockHandle{}, ErrShouldWait
+}
+
+// getAvailableLockNames returns the locks of the pool which the acquirer is able to take right now,
+// drained locks and locks reserved for someone else are not available.
+func (backend *OptimisticLockingStorageBasedBackend) getAvailableLockNames(lockNames []string, opts AcquireOptions) ([]string, error) {
+	keys := []string{backend.drainsKeyName()}
+	for _, lockName := range lockNames {
+		keys = append(keys, backend.reservationsKeyName(lockName), backend.keyName(lockName))
+	}
+
+	values, err := optimistic_locking_store.GetValues(backend.Store, keys)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get store values of locks %v: %s", lockNames, err)
+	}
+
+	var res []string
+	now := time.Now()
+
+	for i, lockName := range lockNames {
+		reservationsValue, leaseValue := values[1+2*i], values[2+2*i]
+
+		if drain, err := backend.extractLockDrain(values[0], lockName); err != nil {
+			return nil, err
+		} else if drain != nil {
+			continue
+		}
+
+		if reservation, err := backend.extractActiveReservation(reservationsValue, lockName, now); err != nil {
+			return nil, err
+		} else if reservation != nil && reservation.Owner != opts.AcquirerId {
+			continue
+		}
+
+		lease, err := ExtractLockLeaseFromStoreValue(leaseValue)
+		if err != nil {
+			return nil, fmt.Errorf("unable to extract lock lease record from data record by key %s: %s", backend.keyName(lockName), err)
+		}
+
+		if isLockLeaseAvailable(lease, opts.Shared) {
+			res = append(res, lockName)
+		}
+	}
+
+	return res, nil
+}
+
+func isLockLeaseAvailable(lease *LockLeaseRecord, shared bool) bool {
+	if lease == nil {
+		return true
+	}
+
+	if lease.IsActive(time.Now()) {
+		return shared && lease.IsShared && lease.PreemptRequestedAtTimestamp == 0
+	}
+
+	now := time.Now().Unix()
+	// Expired lease will be taken by the lock queue members first
+	for _, member := range lease.QueueMembers {
+		if member.ExpireAtTimestamp >= now {
+			return false
+		}
+	}
+	return true
+}
+
+// updatePoolQueue renews the acquirer's place in the pool queue and returns the number of acquirers ahead of it.
+func (backend *OptimisticLockingStorageBasedBackend) updatePoolQueue(lockNames []string, acquirerId string, priority int) (int, error) {
+	var position int
+
+	err := backend.changeStoreValue(backend.poolKeyName(lockNames), func(value *optimistic_locking_store.Value) (bool, error) {
+		record, err := extractPoolQueueFromStoreValue(value)
+		if err != nil {
+			return false, err
+		}
+		if record == nil {
+			record = &PoolQueueRecord{QueueMembers: make(map[string]*QueueMember)}
+		}
+
+		now := time.Now().Unix()
+		for key, member := range record.QueueMembers {
+			if member.ExpireAtTimestamp < now {
+				delete(record.QueueMembers, key)
+			}
+		}
+
+		if member, ok := record.QueueMembers[acquirerId]; ok {
+			member.ExpireAtTimestamp = now + DistributedLockLeaseTTLSeconds
+			member.Priority = priority
+		} else {
+			record.QueueMembers[acquirerId] = &QueueMember{
+				AcquirerId:          acquirerId,
+				AcquiredAtTimestamp: now,
+				ExpireAtTimestamp:   now + DistributedLockLeaseTTLSeconds,
+				Priority:            priority,
+			}
+		}
+
+		position = 0
+		self := record.QueueMembers[acquirerId]
+		for _, member := range record.QueueMembers {
+			if member.IsAheadOf(self) {
+				position++
+			}
+		}
+
+		setPoolQueueIntoStoreValue(record, value)
+
+		return true, nil
+	})
+
+	return position, err
+}
+
+func (backend *OptimisticLockingStorageBasedBackend) poolKeyName(lockNames []string) string {
+	names := append([]string{}, lockNames...)
+	sort.Strings(names)
+	return backend.recordKeyName("pool", strings.Join(names, "\n"))
+}
+
+func extractPoolQueueFromStoreValue(value *optimistic_locking_store.Value) (*PoolQueueRecord, error) {
+	record := &PoolQueueRecord{}
+	if exists, err := extractRecordFromStoreValue(value, record); err != nil || !exists {
+		return nil, err
+	}
+	return record, nil
+}
+
+func setPoolQueueIntoStoreValue(record *PoolQueueRecord, value *optimistic_locking_store.Value) {
+	if len(record.QueueMembers) == 0 {
+		value.Data = ""
+		return
+	}
+	setRecordIntoStoreValue(record, value)
+}
@@ -0,0 +1,9 @@
+package distributed_locker
+
+import (
+	"github.com/werf/lockgate/pkg/ratelimit"
+)
+
+func (backend *OptimisticLockingStorageBasedBackend) RateLimitTake(key string, min, max int, limit ratelimit.Limit) (*ratelimit.TakeResult, error) {
+	return ratelimit.TakeFromStore(backend.Store, key, min, max, limit)
+}
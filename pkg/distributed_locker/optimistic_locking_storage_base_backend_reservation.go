@@ -0,0 +1,153 @@
+package distributed_locker
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+)
+
+// ReservationsRecord is stored next to the lock lease record, reservations are sorted by the start time and never overlap.
+type ReservationsRecord struct {
+	Reservations []*Reservation
+}
+
+func (backend *OptimisticLockingStorageBasedBackend) Reserve(lockName string, from, to time.Time, owner string) (*Reservation, error) {
+	if owner == "" {
+		return nil, fmt.Errorf("reservation owner should be specified")
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("bad reservation window from %s to %s", from, to)
+	}
+
+	reservation := &Reservation{
+		Id:                 uuid.New().String(),
+		LockName:           lockName,
+		Owner:              owner,
+		FromTimestamp:      from.Unix(),
+		ToTimestamp:        to.Unix(),
+		CreatedAtTimestamp: time.Now().Unix(),
+	}
+
+	if err := backend.changeReservations(lockName, func(record *ReservationsRecord) (bool, error) {
+		for _, r := range record.Reservations {
+			if r.Overlaps(reservation) {
+				return false, fmt.Errorf("lock %q is already reserved by %q from %s to %s", lockName, r.Owner, time.Unix(r.FromTimestamp, 0), time.Unix(r.ToTimestamp, 0))
+			}
+		}
+
+		record.Reservations = append(record.Reservations, reservation)
+		sort.Slice(record.Reservations, func(i, j int) bool {
+			return record.Reservations[i].FromTimestamp < record.Reservations[j].FromTimestamp
+		})
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+// ListReservations returns current and future reservations of the lock sorted by the start time.
+func (backend *OptimisticLockingStorageBasedBackend) ListReservations(lockName string) ([]*Reservation, error) {
+	record, err := backend.getReservations(lockName)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*Reservation
+	now := time.Now()
+	for _, reservation := range record.Reservations {
+		if !reservation.IsOver(now) {
+			res = append(res, reservation)
+		}
+	}
+	return res, nil
+}
+
+func (backend *OptimisticLockingStorageBasedBackend) CancelReservation(lockName, reservationId string) error {
+	return backend.changeReservations(lockName, func(record *ReservationsRecord) (bool, error) {
+		for i, reservation := range record.Reservations {
+			if reservation.Id == reservationId {
+				record.Reservations = append(record.Reservations[:i], record.Reservations[i+1:]...)
+				return true, nil
+			}
+		}
+		return false, fmt.Errorf("reservation %q of lock %q not found", reservationId, lockName)
+	})
+}
+
+// extractActiveReservation returns the reservation active at the moment if any from the reservations record value.
+func (backend *OptimisticLockingStorageBasedBackend) extractActiveReservation(value *optimistic_locking_store.Value, lockName string, now time.Time) (*Reservation, error) {
+	record := &ReservationsRecord{}
+	if _, err := extractRecordFromStoreValue(value, record); err != nil {
+		return nil, fmt.Errorf("unable to extract reservations record from data record by key %s: %s", backend.reservationsKeyName(lockName), err)
+	}
+
+	for _, reservation := range record.Reservations {
+		if reservation.IsActive(now) {
+			return reservation, nil
+		}
+	}
+	return nil, nil
+}
+
+func (backend *OptimisticLockingStorageBasedBackend) getReservations(lockName string) (*ReservationsRecord, error) {
+	storeKeyName := backend.reservationsKeyName(lockName)
+
+	value, err := backend.Store.GetValue(storeKeyName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get store value by name %s: %s", storeKeyName, err)
+	}
+
+	record := &ReservationsRecord{}
+	if _, err := extractRecordFromStoreValue(value, record); err != nil {
+		return nil, fmt.Errorf("unable to extract reservations record from data record by key %s: %s", storeKeyName, err)
+	}
+	return record, nil
+}
+
+// changeReservations also removes reservations which are over from the record.
+func (backend *OptimisticLockingStorageBasedBackend) changeReservations(lockName string, changeFunc func(record *ReservationsRecord) (bool, error)) error {
+	storeKeyName := backend.reservationsKeyName(lockName)
+
+	return backend.changeStoreValue(storeKeyName, func(value *optimistic_locking_store.Value) (bool, error) {
+		record := &ReservationsRecord{}
+		if _, err := extractRecordFromStoreValue(value, record); err != nil {
+			return false, fmt.Errorf("unable to extract reservations record from data record by key %s: %s", storeKeyName, err)
+		}
+
+		var reservations []*Reservation
+		now := time.Now()
+		for _, reservation := range record.Reservations {
+			if !reservation.IsOver(now) {
+				reservations = append(reservations, reservation)
+			}
+		}
+		changed := len(reservations) != len(record.Reservations)
+		record.Reservations = reservations
+
+		if ok, err := changeFunc(record); err != nil {
+			return false, err
+		} else if ok {
+			changed = true
+		}
+		if !changed {
+			return false, nil
+		}
+
+		if len(record.Reservations) == 0 {
+			value.Data = ""
+		} else {
+			setRecordIntoStoreValue(record, value)
+		}
+		return true, nil
+	})
+}
+
+func (backend *OptimisticLockingStorageBasedBackend) reservationsKeyName(lockName string) string {
+	return backend.recordKeyName("reservations", lockName)
+}
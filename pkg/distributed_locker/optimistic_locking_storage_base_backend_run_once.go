@@ -0,0 +1,98 @@
+package distributed_locker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/werf/lockgate"
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+)
+
+// GetRunOnceResult returns the stored result, the expired result is deleted from the store.
+func (backend *OptimisticLockingStorageBasedBackend) GetRunOnceResult(key string) (*RunOnceResult, error) {
+	storeKeyName := backend.recordKeyName("run-once", key)
+
+	value, err := backend.Store.GetValue(storeKeyName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get store value by name %s: %s", storeKeyName, err)
+	}
+
+	result := &RunOnceResult{}
+	if exists, err := extractRecordFromStoreValue(value, result); err != nil {
+		return nil, fmt.Errorf("unable to extract run once result from data record by key %s: %s", storeKeyName, err)
+	} else if !exists || result.Pending {
+		return nil, nil
+	} else if !result.isExpired() {
+		return result, nil
+	}
+
+	debug("(run once %q) result expired: removing record", key)
+	return nil, backend.changeStoreValue(storeKeyName, func(value *optimistic_locking_store.Value) (bool, error) {
+		// The record could be claimed or stored again since the read
+		current := &RunOnceResult{}
+		if exists, err := extractRecordFromStoreValue(value, current); err != nil || !exists {
+			return false, err
+		} else if current.Pending || !current.isExpired() {
+			return false, nil
+		}
+
+		value.Data = ""
+		return true, nil
+	})
+}
+
+// ClaimRunOnce returns the stored result, otherwise marks the record as pending for the lease of the handle.
+// The new holder of the lock takes over the claim of the previous holder, which has lost the lease.
+func (backend *OptimisticLockingStorageBasedBackend) ClaimRunOnce(key string, handle lockgate.LockHandle) (*RunOnceResult, error) {
+	var result *RunOnceResult
+
+	err := backend.changeStoreValue(backend.recordKeyName("run-once", key), func(value *optimistic_locking_store.Value) (bool, error) {
+		var err error
+		if result, err = extractRunOnceResultFromStoreValue(value); err != nil || result != nil {
+			return false, err
+		}
+
+		setRecordIntoStoreValue(&RunOnceResult{HolderUUID: handle.UUID, Pending: true}, value)
+		return true, nil
+	})
+
+	return result, err
+}
+
+// PutRunOnceResult stores the result only if the record is still claimed by the lease of the handle,
+// so that the holder which has lost the lease to the next holder does not publish its result.
+func (backend *OptimisticLockingStorageBasedBackend) PutRunOnceResult(key string, handle lockgate.LockHandle, result *RunOnceResult) error {
+	return backend.changeStoreValue(backend.recordKeyName("run-once", key), func(value *optimistic_locking_store.Value) (bool, error) {
+		current := &RunOnceResult{}
+		if exists, err := extractRecordFromStoreValue(value, current); err != nil {
+			return false, err
+		} else if !exists || !current.Pending {
+			return false, ErrNoExistingLockLeaseFound
+		} else if current.HolderUUID != handle.UUID {
+			return false, ErrLockAlreadyLeased
+		}
+
+		stored := *result
+		stored.HolderUUID = handle.UUID
+		stored.Pending = false
+		setRecordIntoStoreValue(&stored, value)
+		return true, nil
+	})
+}
+
+// extractRunOnceResultFromStoreValue returns nil when there is no result, the result is pending or expired.
+func extractRunOnceResultFromStoreValue(value *optimistic_locking_store.Value) (*RunOnceResult, error) {
+	result := &RunOnceResult{}
+	if exists, err := extractRecordFromStoreValue(value, result); err != nil || !exists {
+		return nil, err
+	}
+
+	if result.Pending || result.isExpired() {
+		return nil, nil
+	}
+	return result, nil
+}
+
+func (result *RunOnceResult) isExpired() bool {
+	return time.Now().After(time.Unix(result.ExpireAtTimestamp, 0))
+}
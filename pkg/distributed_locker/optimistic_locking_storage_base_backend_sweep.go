@@ -0,0 +1,63 @@
+package distributed_locker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+)
+
+func (backend *OptimisticLockingStorageBasedBackend) SweepExpiredLeases(olderThan time.Duration) (int, error) {
+	lister, ok := backend.Store.(optimistic_locking_store.KeysLister)
+	if !ok {
+		return 0, fmt.Errorf("store %T is not able to list keys", backend.Store)
+	}
+
+	keys, err := lister.ListKeys()
+	if err != nil {
+		return 0, fmt.Errorf("unable to list store keys: %s", err)
+	}
+
+	swept := 0
+	staleAt := time.Now().Add(-olderThan).Unix()
+
+	for _, key := range keys {
+		// Only lock lease records, auxiliary records have the "<kind>.lockgate.io/" prefix
+		if !strings.HasPrefix(key, "lockgate.io/") {
+			continue
+		}
+
+		removed := false
+		if err := backend.changeStoreValue(key, func(value *optimistic_locking_store.Value) (bool, error) {
+			removed = false
+
+			lease, err := ExtractLockLeaseFromStoreValue(value)
+			if err != nil {
+				return false, fmt.Errorf("unable to extract lock lease record from data record by key %s: %s", key, err)
+			}
+			if lease == nil || lease.ExpireAtTimestamp > staleAt {
+				return false, nil
+			}
+
+			for _, member := range lease.QueueMembers {
+				if member.ExpireAtTimestamp > staleAt {
+					return false, nil
+				}
+			}
+
+			debug("(sweep) removing lock %q lease expired at %s", lease.LockName, time.Unix(lease.ExpireAtTimestamp, 0))
+			UnsetLockLeaseFromStoreValue(lease, value)
+			removed = true
+			return true, nil
+		}); err != nil {
+			return swept, err
+		}
+
+		if removed {
+			swept++
+		}
+	}
+
+	return swept, nil
+}
@@ -0,0 +1,45 @@
+package distributed_locker
+
+import (
+	"time"
+
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+)
+
+// WatchLock watches the lock lease record if the store implements optimistic_locking_store.ValueWatcher.
+// Waiters and the holder rewrite the record every few seconds, only the change of the lease UUID is reported
+// and the release of the observed active lease, which keeps the UUID when somebody is waiting in the queue.
+func (backend *OptimisticLockingStorageBasedBackend) WatchLock(lockName string, observedValue *optimistic_locking_store.Value, stopChan <-chan struct{}) <-chan struct{} {
+	watcher, ok := backend.Store.(optimistic_locking_store.ValueWatcher)
+	if !ok || observedValue == nil {
+		return nil
+	}
+
+	observedLease, err := ExtractLockLeaseFromStoreValue(observedValue)
+	if err != nil {
+		return nil
+	}
+
+	var observedUUID string
+	var observedActive bool
+	if observedLease != nil {
+		observedUUID = observedLease.UUID
+		observedActive = observedLease.IsActive(time.Now())
+	}
+
+	return watcher.WatchValue(backend.keyName(lockName), observedValue, func(data string) bool {
+		lease, err := ExtractLockLeaseFromStoreValue(&optimistic_locking_store.Value{Data: data})
+		if err != nil {
+			return true
+		}
+
+		var uuid string
+		if lease != nil {
+			uuid = lease.UUID
+		}
+		if uuid != observedUUID {
+			return true
+		}
+		return observedActive && lease != nil && !lease.IsActive(time.Now())
+	}, stopChan)
+}
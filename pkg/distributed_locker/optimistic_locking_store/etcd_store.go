@@ -0,0 +1,210 @@
+package optimistic_locking_store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const DefaultEtcdKeyPrefix = "/lockgate/"
+
+// EtcdStore stores each key in its own etcd v3 key under the Prefix. PutValue is a transaction
+// comparing the ModRevision of the key with the revision observed by GetValue, an empty value deletes the key.
+//
+// When LeaseRecordTTL is set, lock lease records are attached to an etcd lease, so that records abandoned
+// by crashed clients are removed by etcd itself. The etcd lease is shared by puts within the first half of its TTL,
+// so a record lives from LeaseRecordTTL/2 to LeaseRecordTTL after the last put. Holders and waiters rewrite the record
+// every few seconds, other records (drains, reservations, etc.) are never expired.
+type EtcdStore struct {
+	Client         *clientv3.Client
+	Prefix         string
+	LeaseRecordTTL time.Duration
+
+	recordLeaseMux       sync.Mutex
+	recordLeaseID        clientv3.LeaseID
+	recordLeaseGrantedAt time.Time
+}
+
+type etcdValueMetadata struct {
+	ModRevision int64
+	// Revision of the store at the read, changes of the key are watched after it
+	Revision int64
+}
+
+func NewEtcdStore(client *clientv3.Client, prefix string) *EtcdStore {
+	if prefix == "" {
+		prefix = DefaultEtcdKeyPrefix
+	}
+	return &EtcdStore{
+		Client: client,
+		Prefix: prefix,
+	}
+}
+
+func (store *EtcdStore) StoreId() string {
+	return fmt.Sprintf("etcd:%s%s", strings.Join(store.Client.Endpoints(), ","), store.Prefix)
+}
+
+func (store *EtcdStore) GetValue(key string) (*Value, error) {
+	debug("EtcdStore.GetValue by key %q", key)
+
+	resp, err := store.Client.Get(context.Background(), store.etcdKey(key))
+	if err != nil {
+		return nil, fmt.Errorf("cannot get etcd key %s: %s", store.etcdKey(key), err)
+	}
+
+	// Zero ModRevision of the missing key makes the put create the key
+	metadata := &etcdValueMetadata{Revision: resp.Header.Revision}
+	value := &Value{metadata: metadata}
+	if len(resp.Kvs) > 0 {
+		value.Data = string(resp.Kvs[0].Value)
+		metadata.ModRevision = resp.Kvs[0].ModRevision
+	}
+
+	debug("EtcdStore.GetValue by key %q -> %#v", key, value)
+
+	return value, nil
+}
+
+func (store *EtcdStore) PutValue(key string, value *Value) error {
+	debug("EtcdStore.PutValue %s %#v", key, value)
+
+	metadata := value.metadata.(*etcdValueMetadata)
+	etcdKey := store.etcdKey(key)
+
+	if value.Data == "" && metadata.ModRevision == 0 {
+		return nil
+	}
+
+RETRY_PUT:
+	var op clientv3.Op
+	var leaseID clientv3.LeaseID
+	if value.Data == "" {
+		op = clientv3.OpDelete(etcdKey)
+	} else if store.LeaseRecordTTL > 0 && strings.HasPrefix(key, "lockgate.io/") {
+		var err error
+		if leaseID, err = store.getRecordLease(); err != nil {
+			return fmt.Errorf("cannot grant etcd lease for key %s: %s", etcdKey, err)
+		}
+		op = clientv3.OpPut(etcdKey, value.Data, clientv3.WithLease(leaseID))
+	} else {
+		op = clientv3.OpPut(etcdKey, value.Data)
+	}
+
+	resp, err := store.Client.Txn(context.Background()).
+		If(clientv3.Compare(clientv3.ModRevision(etcdKey), "=", metadata.ModRevision)).
+		Then(op).
+		Commit()
+	if leaseID != 0 && err == rpctypes.ErrLeaseNotFound {
+		// Shared lease has expired meanwhile, e.g. the client has been paused for a long time
+		debug("EtcdStore.PutValue %s: etcd lease %x not found, will grant a new one", key, leaseID)
+		store.resetRecordLease(leaseID)
+		goto RETRY_PUT
+	} else if err != nil {
+		return fmt.Errorf("cannot put etcd key %s: %s", etcdKey, err)
+	}
+	if !resp.Succeeded {
+		return ErrRecordVersionChanged
+	}
+	return nil
+}
+
+func (store *EtcdStore) ListKeys() ([]string, error) {
+	resp, err := store.Client.Get(context.Background(), store.Prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, fmt.Errorf("cannot list etcd keys by prefix %s: %s", store.Prefix, err)
+	}
+
+	var keys []string
+	for _, kv := range resp.Kvs {
+		keys = append(keys, strings.TrimPrefix(string(kv.Key), store.Prefix))
+	}
+	return keys, nil
+}
+
+// WatchValue watches changes of the key since the value has been read, so that changes between the read
+// and the call are not missed. Only changes for which isChangedFunc returns true close the returned channel.
+func (store *EtcdStore) WatchValue(key string, value *Value, isChangedFunc func(data string) bool, stopChan <-chan struct{}) <-chan struct{} {
+	changedChan := make(chan struct{})
+
+	// There are no changes of the key between its ModRevision and the read revision
+	metadata := value.metadata.(*etcdValueMetadata)
+	fromRevision := metadata.Revision + 1
+	if metadata.ModRevision != 0 {
+		fromRevision = metadata.ModRevision + 1
+	}
+
+	ctx, cancel := context.WithCancel(clientv3.WithRequireLeader(context.Background()))
+	watchChan := store.Client.Watch(ctx, store.etcdKey(key), clientv3.WithRev(fromRevision))
+
+	go func() {
+		defer close(changedChan)
+		defer cancel()
+
+		for {
+			select {
+			case resp, ok := <-watchChan:
+				if !ok || resp.Canceled || resp.Err() != nil {
+					// Waiters fall back to polling
+					debug("EtcdStore.WatchValue by key %q failed: %v", key, resp.Err())
+					<-stopChan
+					return
+				}
+
+				for _, event := range resp.Events {
+					var data string
+					if event.Type == clientv3.EventTypePut {
+						data = string(event.Kv.Value)
+					}
+					if isChangedFunc(data) {
+						debug("EtcdStore.WatchValue by key %q: changed at revision %d", key, event.Kv.ModRevision)
+						return
+					}
+				}
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+
+	return changedChan
+}
+
+// getRecordLease returns the etcd lease for lock lease records, a new lease is granted
+// when the current one has lived the half of its TTL.
+func (store *EtcdStore) getRecordLease() (clientv3.LeaseID, error) {
+	store.recordLeaseMux.Lock()
+	defer store.recordLeaseMux.Unlock()
+
+	if store.recordLeaseID != 0 && time.Since(store.recordLeaseGrantedAt) < store.LeaseRecordTTL/2 {
+		return store.recordLeaseID, nil
+	}
+
+	grantedAt := time.Now()
+	lease, err := store.Client.Grant(context.Background(), int64(store.LeaseRecordTTL/time.Second))
+	if err != nil {
+		return 0, err
+	}
+
+	// Previous lease is not revoked: records attached to it are removed by etcd when the lease expires
+	store.recordLeaseID, store.recordLeaseGrantedAt = lease.ID, grantedAt
+	return lease.ID, nil
+}
+
+func (store *EtcdStore) resetRecordLease(leaseID clientv3.LeaseID) {
+	store.recordLeaseMux.Lock()
+	defer store.recordLeaseMux.Unlock()
+
+	if store.recordLeaseID == leaseID {
+		store.recordLeaseID = 0
+	}
+}
+
+func (store *EtcdStore) etcdKey(key string) string {
+	return store.Prefix + key
+}
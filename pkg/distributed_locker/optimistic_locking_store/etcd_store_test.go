@@ -0,0 +1,203 @@
+package optimistic_locking_store
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// newEmbeddedEtcdClient starts the single member etcd server in the temporary dir and returns the client connected to it.
+func newEmbeddedEtcdClient(t *testing.T) *clientv3.Client {
+	t.Helper()
+
+	localURL, _ := url.Parse("http://127.0.0.1:0")
+
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	cfg.ListenClientUrls = []url.URL{*localURL}
+	cfg.AdvertiseClientUrls = []url.URL{*localURL}
+	cfg.ListenPeerUrls = []url.URL{*localURL}
+	cfg.AdvertisePeerUrls = []url.URL{*localURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	server, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("start etcd: %s", err)
+	}
+	t.Cleanup(server.Close)
+
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		t.Fatalf("etcd server is not ready")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{server.Clients[0].Addr().String()},
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("connect to etcd: %s", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+func TestEtcdStore(t *testing.T) {
+	testOptimisticLockingStore(t, NewEtcdStore(newEmbeddedEtcdClient(t), "/test/"))
+}
+
+func TestEtcdStore_DeleteOnEmpty(t *testing.T) {
+	client := newEmbeddedEtcdClient(t)
+	store := NewEtcdStore(client, "/test/")
+	key := LockLeaseKey("mylock")
+
+	putTestValue(t, store, key, "data")
+	putTestValue(t, store, key, "")
+
+	resp, err := client.Get(context.Background(), "/test/"+key)
+	if err != nil {
+		t.Fatalf("get etcd key: %s", err)
+	}
+	if len(resp.Kvs) != 0 {
+		t.Errorf("etcd key should be deleted, got %q", resp.Kvs[0].Value)
+	}
+}
+
+func TestEtcdStore_LeaseRecordTTL(t *testing.T) {
+	client := newEmbeddedEtcdClient(t)
+	store := NewEtcdStore(client, "/test/")
+	store.LeaseRecordTTL = time.Minute
+
+	leaseKey, recordKey := LockLeaseKey("mylock"), "reservations."+LockLeaseKey("mylock")
+	getEtcdLease := func(key string) clientv3.LeaseID {
+		t.Helper()
+
+		resp, err := client.Get(context.Background(), "/test/"+key)
+		if err != nil {
+			t.Fatalf("get etcd key: %s", err)
+		}
+		if len(resp.Kvs) == 0 {
+			t.Fatalf("etcd key %s not found", key)
+		}
+		return clientv3.LeaseID(resp.Kvs[0].Lease)
+	}
+	getEtcdLeasesCount := func() int {
+		t.Helper()
+
+		resp, err := client.Leases(context.Background())
+		if err != nil {
+			t.Fatalf("list etcd leases: %s", err)
+		}
+		return len(resp.Leases)
+	}
+
+	putTestValue(t, store, leaseKey, "first")
+	putTestValue(t, store, recordKey, "record")
+
+	leaseID := getEtcdLease(leaseKey)
+	if leaseID == 0 {
+		t.Fatalf("lock lease record should be attached to the etcd lease")
+	}
+	if recordLeaseID := getEtcdLease(recordKey); recordLeaseID != 0 {
+		t.Errorf("auxiliary record should not be attached to the etcd lease, got lease %x", recordLeaseID)
+	}
+
+	// Lease is shared by puts and is not granted for the failed put
+	staleValue := getTestValue(t, store, leaseKey)
+	putTestValue(t, store, leaseKey, "second")
+	staleValue.Data = "stale"
+	if err := store.PutValue(leaseKey, staleValue); !IsErrRecordVersionChanged(err) {
+		t.Errorf("put with the stale revision: expected %q, got %v", ErrRecordVersionChanged, err)
+	}
+	if newLeaseID := getEtcdLease(leaseKey); newLeaseID != leaseID {
+		t.Errorf("expected the shared etcd lease %x, got %x", leaseID, newLeaseID)
+	}
+	if count := getEtcdLeasesCount(); count != 1 {
+		t.Errorf("expected 1 etcd lease, got %d", count)
+	}
+
+	// Revoked lease deletes the record, the next put grants a new lease
+	if _, err := client.Revoke(context.Background(), leaseID); err != nil {
+		t.Fatalf("revoke etcd lease: %s", err)
+	}
+	if value := getTestValue(t, store, leaseKey); value.Data != "" {
+		t.Errorf("record of the revoked lease should be deleted, got %q", value.Data)
+	}
+
+	putTestValue(t, store, leaseKey, "third")
+	if newLeaseID := getEtcdLease(leaseKey); newLeaseID == 0 || newLeaseID == leaseID {
+		t.Errorf("expected a new etcd lease, got %x", newLeaseID)
+	}
+}
+
+func TestEtcdStore_WatchValue(t *testing.T) {
+	store := NewEtcdStore(newEmbeddedEtcdClient(t), "")
+	key := LockLeaseKey("mylock")
+
+	isChangedFunc := func(data string) bool { return data != "holder-1" }
+	isClosed := func(changedChan <-chan struct{}, timeout time.Duration) bool {
+		select {
+		case <-changedChan:
+			return true
+		case <-time.After(timeout):
+			return false
+		}
+	}
+
+	putTestValue(t, store, key, "holder-1")
+	observedValue := getTestValue(t, store, key)
+
+	stopChan := make(chan struct{})
+	changedChan := store.WatchValue(key, observedValue, isChangedFunc, stopChan)
+
+	// Rewrite of the record which does not change the holder
+	putTestValue(t, store, key, "holder-1")
+	if isClosed(changedChan, time.Second) {
+		t.Fatalf("watch should not be woken up by the change rejected by isChangedFunc")
+	}
+
+	putTestValue(t, store, key, "")
+	if !isClosed(changedChan, 5*time.Second) {
+		t.Fatalf("watch should be woken up by the deletion")
+	}
+	close(stopChan)
+
+	// Change between the read and the watch is not missed
+	putTestValue(t, store, key, "holder-1")
+	observedValue = getTestValue(t, store, key)
+	putTestValue(t, store, key, "holder-2")
+
+	stopChan = make(chan struct{})
+	changedChan = store.WatchValue(key, observedValue, isChangedFunc, stopChan)
+	if !isClosed(changedChan, 5*time.Second) {
+		t.Fatalf("watch should be woken up by the change made after the read")
+	}
+	close(stopChan)
+
+	// Watch of the missing key
+	putTestValue(t, store, key, "")
+	observedValue = getTestValue(t, store, key)
+
+	stopChan = make(chan struct{})
+	changedChan = store.WatchValue(key, observedValue, func(data string) bool { return data != "" }, stopChan)
+	putTestValue(t, store, key, "holder-3")
+	if !isClosed(changedChan, 5*time.Second) {
+		t.Fatalf("watch should be woken up by the creation")
+	}
+	close(stopChan)
+
+	// Stopped watch
+	stopChan = make(chan struct{})
+	changedChan = store.WatchValue(key, getTestValue(t, store, key), isChangedFunc, stopChan)
+	close(stopChan)
+	if !isClosed(changedChan, 5*time.Second) {
+		t.Fatalf("channel should be closed when the watch is stopped")
+	}
+}
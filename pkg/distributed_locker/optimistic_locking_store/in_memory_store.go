@@ -1,6 +1,9 @@
 package optimistic_locking_store
 
-import "sync"
+import (
+	"fmt"
+	"sync"
+)
 
 type InMemoryStore struct {
 	Mux    sync.Mutex
@@ -15,20 +18,24 @@ func NewInMemoryStore() *InMemoryStore {
 	return &InMemoryStore{Values: make(map[string]*Value)}
 }
 
+func (store *InMemoryStore) StoreId() string {
+	return fmt.Sprintf("in-memory:%p", store)
+}
+
 func (store *InMemoryStore) GetValue(key string) (*Value, error) {
 	store.Mux.Lock()
 	defer store.Mux.Unlock()
 
-	if rec, hasKey := store.Values[key]; hasKey {
-		return rec, nil
-	} else {
-		rec := &Value{
+	rec, hasKey := store.Values[key]
+	if !hasKey {
+		rec = &Value{
 			metadata: &inMemoryRecordMetadata{Version: 1},
 		}
 		store.Values[key] = rec
-
-		return rec, nil
 	}
+
+	// The caller changes the data of the returned value before the put, so the stored value is never shared
+	return &Value{Data: rec.Data, metadata: rec.metadata}, nil
 }
 
 func (store *InMemoryStore) PutValue(key string, value *Value) error {
@@ -52,3 +59,16 @@ func (store *InMemoryStore) PutValue(key string, value *Value) error {
 
 	return nil
 }
+
+func (store *InMemoryStore) ListKeys() ([]string, error) {
+	store.Mux.Lock()
+	defer store.Mux.Unlock()
+
+	var keys []string
+	for key, value := range store.Values {
+		if value.Data != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
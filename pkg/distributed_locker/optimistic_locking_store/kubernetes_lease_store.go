@@ -0,0 +1,208 @@
+package optimistic_locking_store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/werf/lockgate/pkg/util"
+)
+
+const (
+	KubernetesLeaseKeyAnnotation  = "lockgate.io/key"
+	KubernetesLeaseDataAnnotation = "lockgate.io/data"
+	KubernetesLeaseManagedByLabel = "app.kubernetes.io/managed-by"
+	KubernetesLeaseManagedBy      = "lockgate"
+
+	kubernetesMicroTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+var KubernetesLeaseGVR = schema.GroupVersionResource{Group: "coordination.k8s.io", Version: "v1", Resource: "leases"}
+
+// KubernetesLeaseStore stores each key in its own coordination.k8s.io/v1 Lease object in the namespace,
+// so that unrelated keys never conflict with each other. The Lease is created on the first put
+// and deleted when the value becomes empty.
+type KubernetesLeaseStore struct {
+	KubernetesInterface dynamic.Interface
+	Namespace           string
+	// Names of Lease objects are prefixed with NamePrefix.
+	NamePrefix string
+}
+
+// The spec of the Lease is filled in from the lock lease record, so that "kubectl get leases" shows the lock holder.
+type kubernetesLeaseRecordFields struct {
+	UUID              string `json:"uuid"`
+	HolderId          string
+	ExpireAtTimestamp int64
+}
+
+func NewKubernetesLeaseStore(kubernetesInterface dynamic.Interface, namespace string) *KubernetesLeaseStore {
+	return &KubernetesLeaseStore{
+		KubernetesInterface: kubernetesInterface,
+		Namespace:           namespace,
+		NamePrefix:          "lockgate",
+	}
+}
+
+func (store *KubernetesLeaseStore) StoreId() string {
+	return fmt.Sprintf("kubernetes-leases:%s/%s", store.Namespace, store.NamePrefix)
+}
+
+func (store *KubernetesLeaseStore) GetValue(key string) (*Value, error) {
+	debug("KubernetesLeaseStore.GetValue by key %q", key)
+
+	obj, err := store.KubernetesInterface.Resource(KubernetesLeaseGVR).Namespace(store.Namespace).Get(context.Background(), store.leaseName(key), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		// Lease will be created on put
+		return &Value{metadata: (*unstructured.Unstructured)(nil)}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot get lease %s/%s: %s", store.Namespace, store.leaseName(key), err)
+	}
+
+	value := &Value{
+		Data:     obj.GetAnnotations()[KubernetesLeaseDataAnnotation],
+		metadata: obj,
+	}
+
+	debug("KubernetesLeaseStore.GetValue by key %q -> %#v", key, value)
+
+	return value, nil
+}
+
+func (store *KubernetesLeaseStore) PutValue(key string, value *Value) error {
+	debug("KubernetesLeaseStore.PutValue %s %#v", key, value)
+
+	obj := value.metadata.(*unstructured.Unstructured)
+	leases := store.KubernetesInterface.Resource(KubernetesLeaseGVR).Namespace(store.Namespace)
+
+	if obj == nil {
+		if value.Data == "" {
+			return nil
+		}
+
+		obj = store.newLease(key)
+		store.setLeaseData(obj, value.Data)
+
+		if _, err := leases.Create(context.Background(), obj, metav1.CreateOptions{}); errors.IsAlreadyExists(err) {
+			return ErrRecordVersionChanged
+		} else if err != nil {
+			return fmt.Errorf("cannot create lease %s/%s: %s", store.Namespace, obj.GetName(), err)
+		}
+		return nil
+	}
+
+	if value.Data == "" {
+		resourceVersion := obj.GetResourceVersion()
+		err := leases.Delete(context.Background(), obj.GetName(), metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{ResourceVersion: &resourceVersion},
+		})
+		if errors.IsConflict(err) || errors.IsNotFound(err) {
+			return ErrRecordVersionChanged
+		} else if err != nil {
+			return fmt.Errorf("cannot delete lease %s/%s: %s", store.Namespace, obj.GetName(), err)
+		}
+		return nil
+	}
+
+	// Update of the object with the resourceVersion of the read object fails when the object has been changed meanwhile
+	obj = obj.DeepCopy()
+	store.setLeaseData(obj, value.Data)
+
+	if _, err := leases.Update(context.Background(), obj, metav1.UpdateOptions{}); errors.IsConflict(err) || errors.IsNotFound(err) {
+		return ErrRecordVersionChanged
+	} else if err != nil {
+		return fmt.Errorf("cannot update lease %s/%s: %s", store.Namespace, obj.GetName(), err)
+	}
+	return nil
+}
+
+func (store *KubernetesLeaseStore) ListKeys() ([]string, error) {
+	list, err := store.KubernetesInterface.Resource(KubernetesLeaseGVR).Namespace(store.Namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", KubernetesLeaseManagedByLabel, KubernetesLeaseManagedBy),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list leases in namespace %s: %s", store.Namespace, err)
+	}
+
+	var keys []string
+	for _, obj := range list.Items {
+		annots := obj.GetAnnotations()
+		if annots[KubernetesLeaseKeyAnnotation] != "" && annots[KubernetesLeaseDataAnnotation] != "" {
+			keys = append(keys, annots[KubernetesLeaseKeyAnnotation])
+		}
+	}
+	return keys, nil
+}
+
+func (store *KubernetesLeaseStore) leaseName(key string) string {
+	return fmt.Sprintf("%s-%s", store.NamePrefix, util.Sha3_224Hash(key))
+}
+
+func (store *KubernetesLeaseStore) newLease(key string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("coordination.k8s.io/v1")
+	obj.SetKind("Lease")
+	obj.SetName(store.leaseName(key))
+	obj.SetNamespace(store.Namespace)
+	obj.SetLabels(map[string]string{KubernetesLeaseManagedByLabel: KubernetesLeaseManagedBy})
+	obj.SetAnnotations(map[string]string{KubernetesLeaseKeyAnnotation: key})
+	return obj
+}
+
+func (store *KubernetesLeaseStore) setLeaseData(obj *unstructured.Unstructured, data string) {
+	annots := obj.GetAnnotations()
+	if annots == nil {
+		annots = make(map[string]string)
+	}
+	var currentFields kubernetesLeaseRecordFields
+	_ = json.Unmarshal([]byte(annots[KubernetesLeaseDataAnnotation]), &currentFields)
+	annots[KubernetesLeaseDataAnnotation] = data
+	obj.SetAnnotations(annots)
+
+	var fields kubernetesLeaseRecordFields
+	if err := json.Unmarshal([]byte(data), &fields); err != nil || fields.UUID == "" {
+		// Not a lock lease record (pool queue, barrier, etc.)
+		unstructured.RemoveNestedField(obj.Object, "spec")
+		return
+	}
+
+	holderIdentity := fields.HolderId
+	if holderIdentity == "" {
+		holderIdentity = fields.UUID
+	}
+
+	now := time.Now().UTC().Format(kubernetesMicroTimeFormat)
+	spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+	if spec == nil {
+		spec = make(map[string]interface{})
+	}
+
+	if currentHolderIdentity, _ := spec["holderIdentity"].(string); currentHolderIdentity != holderIdentity {
+		leaseTransitions, _ := spec["leaseTransitions"].(int64)
+		if currentHolderIdentity != "" {
+			leaseTransitions++
+		}
+		spec["holderIdentity"] = holderIdentity
+		spec["acquireTime"] = now
+		spec["leaseTransitions"] = leaseTransitions
+	}
+	// Waiters rewrite the record to keep their place in the queue, renew time is changed only by the holder
+	// extending the lease, so that renewTime+leaseDurationSeconds is the expiration time of the lease
+	if currentFields.UUID != fields.UUID || currentFields.ExpireAtTimestamp != fields.ExpireAtTimestamp || spec["renewTime"] == nil {
+		spec["renewTime"] = now
+		if leaseDurationSeconds := fields.ExpireAtTimestamp - time.Now().Unix(); leaseDurationSeconds > 0 {
+			spec["leaseDurationSeconds"] = leaseDurationSeconds
+		} else {
+			delete(spec, "leaseDurationSeconds")
+		}
+	}
+
+	_ = unstructured.SetNestedMap(obj.Object, spec, "spec")
+}
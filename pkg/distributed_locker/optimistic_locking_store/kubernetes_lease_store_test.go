@@ -0,0 +1,127 @@
+package optimistic_locking_store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func leaseRecordData(uuid, holderId string, expireAt time.Time, queueMembers ...string) string {
+	queue := ""
+	for i, member := range queueMembers {
+		if i > 0 {
+			queue += ","
+		}
+		queue += fmt.Sprintf("%q:{}", member)
+	}
+	return fmt.Sprintf(`{"uuid":%q,"lockName":"mylock","HolderId":%q,"ExpireAtTimestamp":%d,"SharedHoldersCount":1,"QueueMembers":{%s}}`, uuid, holderId, expireAt.Unix(), queue)
+}
+
+func TestSetLeaseData_RenewTime(t *testing.T) {
+	store := &KubernetesLeaseStore{Namespace: "ns", NamePrefix: "lockgate"}
+	obj := store.newLease("mylock")
+	expireAt := time.Now().Add(time.Minute)
+
+	getSpec := func() map[string]interface{} {
+		t.Helper()
+
+		spec, _, err := unstructured.NestedMap(obj.Object, "spec")
+		if err != nil {
+			t.Fatalf("get spec: %s", err)
+		}
+		return spec
+	}
+
+	store.setLeaseData(obj, leaseRecordData("uuid-1", "holder", expireAt))
+	spec := getSpec()
+	if spec["holderIdentity"] != "holder" || spec["renewTime"] == nil || spec["leaseDurationSeconds"] == nil {
+		t.Fatalf("got spec %v, expected the holder, renew time and lease duration set", spec)
+	}
+
+	// Waiter joining the queue does not renew the lease of the holder
+	_ = unstructured.SetNestedField(obj.Object, "2000-01-01T00:00:00.000000Z", "spec", "renewTime")
+	store.setLeaseData(obj, leaseRecordData("uuid-1", "holder", expireAt, "waiter"))
+	if renewTime := getSpec()["renewTime"]; renewTime != "2000-01-01T00:00:00.000000Z" {
+		t.Errorf("got renew time %v after the queue change, expected the renew time kept", renewTime)
+	}
+
+	store.setLeaseData(obj, leaseRecordData("uuid-1", "holder", expireAt.Add(time.Minute), "waiter"))
+	if renewTime := getSpec()["renewTime"]; renewTime == "2000-01-01T00:00:00.000000Z" {
+		t.Errorf("got renew time %v after the lease renew, expected the renew time updated", renewTime)
+	}
+
+	// The lease is taken over by the waiter
+	store.setLeaseData(obj, leaseRecordData("uuid-2", "waiter", expireAt))
+	spec = getSpec()
+	if spec["holderIdentity"] != "waiter" {
+		t.Errorf("got holder identity %v, expected the new holder", spec["holderIdentity"])
+	}
+	if leaseTransitions, _ := spec["leaseTransitions"].(int64); leaseTransitions != 1 {
+		t.Errorf("got lease transitions %d, expected 1", leaseTransitions)
+	}
+
+	// Other records are stored without the lease spec
+	store.setLeaseData(obj, `{"Members":{}}`)
+	if _, found, _ := unstructured.NestedMap(obj.Object, "spec"); found {
+		t.Errorf("got spec for the record which is not a lock lease, expected no spec")
+	}
+}
+
+func TestKubernetesLeaseStore(t *testing.T) {
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		KubernetesLeaseGVR: "LeaseList",
+	})
+	store := NewKubernetesLeaseStore(client, "ns")
+
+	put := func(key, data string) error {
+		t.Helper()
+
+		value, err := store.GetValue(key)
+		if err != nil {
+			t.Fatalf("get value: %s", err)
+		}
+		value.Data = data
+		return store.PutValue(key, value)
+	}
+
+	data := leaseRecordData("uuid-1", "holder", time.Now().Add(time.Minute))
+	if err := put("mylock", data); err != nil {
+		t.Fatalf("put value: %s", err)
+	}
+	if err := put("other", `{"Members":{}}`); err != nil {
+		t.Fatalf("put value: %s", err)
+	}
+
+	if value, err := store.GetValue("mylock"); err != nil {
+		t.Fatalf("get value: %s", err)
+	} else if value.Data != data {
+		t.Errorf("got data %q, expected %q", value.Data, data)
+	}
+
+	if keys, err := store.ListKeys(); err != nil {
+		t.Fatalf("list keys: %s", err)
+	} else if len(keys) != 2 {
+		t.Errorf("got keys %v, expected mylock and other", keys)
+	}
+
+	// The Lease is deleted with the empty value
+	if err := put("mylock", ""); err != nil {
+		t.Fatalf("put value: %s", err)
+	}
+	if _, err := client.Resource(KubernetesLeaseGVR).Namespace("ns").Get(context.Background(), store.leaseName("mylock"), metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("got %v, expected the lease deleted", err)
+	}
+	if keys, err := store.ListKeys(); err != nil {
+		t.Fatalf("list keys: %s", err)
+	} else if len(keys) != 1 || keys[0] != "other" {
+		t.Errorf("got keys %v, expected other", keys)
+	}
+}
@@ -0,0 +1,317 @@
+package optimistic_locking_store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	KubernetesLockKind            = "Lock"
+	KubernetesLockAPIVersion      = "lockgate.io/v1alpha1"
+	KubernetesLockRecordKindLabel = "lockgate.io/record-kind"
+
+	KubernetesLockModeExclusive = "Exclusive"
+	KubernetesLockModeShared    = "Shared"
+
+	KubernetesLockQueuePolicyFIFO = "FIFO"
+	KubernetesLockQueuePolicyNone = "None"
+)
+
+var KubernetesLockGVR = schema.GroupVersionResource{Group: "lockgate.io", Version: "v1alpha1", Resource: "locks"}
+
+// KubernetesLockStore stores each key in its own Lock custom resource (see the CRD in deploy/crd),
+// so that locks are observable with "kubectl get locks" and RBAC may be configured per lock.
+// The store keeps the raw record in the annotation and fills in the status of the Lock from the lock lease record:
+// holders, waiters and the fencing token of the lease, which is the one returned to the holder in the lock handle.
+//
+// The spec of the Lock is declarative: Lock objects may be created beforehand, the store then rejects
+// acquisitions which do not match the declared mode or queue policy. Lock objects are kept when the lock is released
+// to keep the fencing token monotonic, objects of auxiliary records are deleted when the record becomes empty.
+type KubernetesLockStore struct {
+	KubernetesInterface dynamic.Interface
+	Namespace           string
+}
+
+// KubernetesLockRecord contains the fields of the lock lease record used to fill in the Lock status.
+type KubernetesLockRecord struct {
+	UUID               string `json:"uuid"`
+	LockName           string `json:"lockName"`
+	FencingToken       int64  `json:"fencingToken"`
+	HolderId           string
+	ExpireAtTimestamp  int64
+	SharedHoldersCount int64
+	IsShared           bool
+	QueueMembers       map[string]*KubernetesLockQueueMember
+}
+
+type KubernetesLockQueueMember struct {
+	AcquirerId          string
+	AcquiredAtTimestamp int64
+	ExpireAtTimestamp   int64
+	Priority            int
+}
+
+func NewKubernetesLockStore(kubernetesInterface dynamic.Interface, namespace string) *KubernetesLockStore {
+	return &KubernetesLockStore{
+		KubernetesInterface: kubernetesInterface,
+		Namespace:           namespace,
+	}
+}
+
+func (store *KubernetesLockStore) StoreId() string {
+	return fmt.Sprintf("kubernetes-locks:%s", store.Namespace)
+}
+
+func (store *KubernetesLockStore) GetValue(key string) (*Value, error) {
+	debug("KubernetesLockStore.GetValue by key %q", key)
+
+	obj, err := store.locks().Get(context.Background(), KubernetesLockObjectName(key), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		// Lock will be created on put
+		return &Value{metadata: (*unstructured.Unstructured)(nil)}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot get lock %s/%s: %s", store.Namespace, KubernetesLockObjectName(key), err)
+	}
+
+	value := &Value{
+		Data:     obj.GetAnnotations()[KubernetesLeaseDataAnnotation],
+		metadata: obj,
+	}
+
+	debug("KubernetesLockStore.GetValue by key %q -> %#v", key, value)
+
+	return value, nil
+}
+
+func (store *KubernetesLockStore) PutValue(key string, value *Value) error {
+	debug("KubernetesLockStore.PutValue %s %#v", key, value)
+
+	obj := value.metadata.(*unstructured.Unstructured)
+
+	if obj == nil {
+		if value.Data == "" {
+			return nil
+		}
+
+		obj = store.newLock(key, value.Data)
+		if err := SetKubernetesLockData(obj, value.Data); err != nil {
+			return err
+		}
+
+		if _, err := store.locks().Create(context.Background(), obj, metav1.CreateOptions{}); errors.IsAlreadyExists(err) {
+			return ErrRecordVersionChanged
+		} else if err != nil {
+			return fmt.Errorf("cannot create lock %s/%s: %s", store.Namespace, obj.GetName(), err)
+		}
+		return nil
+	}
+
+	if value.Data == "" && kubernetesLockRecordKind(key) != "lock" {
+		resourceVersion := obj.GetResourceVersion()
+		err := store.locks().Delete(context.Background(), obj.GetName(), metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{ResourceVersion: &resourceVersion},
+		})
+		if errors.IsConflict(err) || errors.IsNotFound(err) {
+			return ErrRecordVersionChanged
+		} else if err != nil {
+			return fmt.Errorf("cannot delete lock %s/%s: %s", store.Namespace, obj.GetName(), err)
+		}
+		return nil
+	}
+
+	// Update of the object with the resourceVersion of the read object fails when the object has been changed meanwhile
+	obj = obj.DeepCopy()
+	if err := SetKubernetesLockData(obj, value.Data); err != nil {
+		return err
+	}
+
+	if _, err := store.locks().Update(context.Background(), obj, metav1.UpdateOptions{}); errors.IsConflict(err) || errors.IsNotFound(err) {
+		return ErrRecordVersionChanged
+	} else if err != nil {
+		return fmt.Errorf("cannot update lock %s/%s: %s", store.Namespace, obj.GetName(), err)
+	}
+	return nil
+}
+
+func (store *KubernetesLockStore) ListKeys() ([]string, error) {
+	list, err := store.locks().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list locks in namespace %s: %s", store.Namespace, err)
+	}
+
+	var keys []string
+	for _, obj := range list.Items {
+		annots := obj.GetAnnotations()
+		if annots[KubernetesLeaseKeyAnnotation] != "" && annots[KubernetesLeaseDataAnnotation] != "" {
+			keys = append(keys, annots[KubernetesLeaseKeyAnnotation])
+		}
+	}
+	return keys, nil
+}
+
+func (store *KubernetesLockStore) locks() dynamic.ResourceInterface {
+	return store.KubernetesInterface.Resource(KubernetesLockGVR).Namespace(store.Namespace)
+}
+
+func (store *KubernetesLockStore) newLock(key, data string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(KubernetesLockAPIVersion)
+	obj.SetKind(KubernetesLockKind)
+	obj.SetName(KubernetesLockObjectName(key))
+	obj.SetNamespace(store.Namespace)
+	obj.SetLabels(map[string]string{
+		KubernetesLeaseManagedByLabel: KubernetesLeaseManagedBy,
+		KubernetesLockRecordKindLabel: kubernetesLockRecordKind(key),
+	})
+	obj.SetAnnotations(map[string]string{KubernetesLeaseKeyAnnotation: key})
+
+	// Mode and queue policy are not declared for the created Lock, any acquisitions are allowed
+	if record := ParseKubernetesLockRecord(data); record != nil {
+		_ = unstructured.SetNestedField(obj.Object, record.LockName, "spec", "lockName")
+	}
+
+	return obj
+}
+
+// KubernetesLockObjectName returns the name of the Lock object storing the key:
+// the sha3-224 hash of the lock name for lock lease records and "<kind>-<hash>" for auxiliary records.
+func KubernetesLockObjectName(key string) string {
+	kind := kubernetesLockRecordKind(key)
+	hash := key[strings.LastIndex(key, "/")+1:]
+	if kind == "lock" {
+		return hash
+	}
+	return fmt.Sprintf("%s-%s", kind, hash)
+}
+
+// kubernetesLockRecordKind returns "lock" for "lockgate.io/<hash>" keys and the kind for "<kind>.lockgate.io/<hash>" keys.
+func kubernetesLockRecordKind(key string) string {
+	prefix := key[:strings.LastIndex(key, "/")+1]
+	if kind, hasKind := strings.CutSuffix(prefix, ".lockgate.io/"); hasKind {
+		return kind
+	}
+	return "lock"
+}
+
+// ParseKubernetesLockRecord returns nil if the data is not a lock lease record (pool queue, barrier, etc.).
+func ParseKubernetesLockRecord(data string) *KubernetesLockRecord {
+	var record *KubernetesLockRecord
+	if err := json.Unmarshal([]byte(data), &record); err != nil || record == nil || record.UUID == "" {
+		return nil
+	}
+	return record
+}
+
+// SetKubernetesLockData sets the record data into the Lock object and updates the status of the Lock,
+// returns an error if the record does not match the spec of the Lock.
+func SetKubernetesLockData(obj *unstructured.Unstructured, data string) error {
+	record := ParseKubernetesLockRecord(data)
+
+	if record != nil {
+		mode, _, _ := unstructured.NestedString(obj.Object, "spec", "mode")
+		if mode == KubernetesLockModeExclusive && record.IsShared {
+			return fmt.Errorf("lock %q is declared exclusive", record.LockName)
+		} else if mode == KubernetesLockModeShared && !record.IsShared {
+			return fmt.Errorf("lock %q is declared shared", record.LockName)
+		}
+
+		queuePolicy, _, _ := unstructured.NestedString(obj.Object, "spec", "queuePolicy")
+		if queuePolicy == KubernetesLockQueuePolicyNone && len(record.QueueMembers) > 0 {
+			return fmt.Errorf("lock %q is declared without queue", record.LockName)
+		}
+	}
+
+	annots := obj.GetAnnotations()
+	if annots == nil {
+		annots = make(map[string]string)
+	}
+	if data == "" {
+		delete(annots, KubernetesLeaseDataAnnotation)
+	} else {
+		annots[KubernetesLeaseDataAnnotation] = data
+	}
+	obj.SetAnnotations(annots)
+
+	status, _, _ := unstructured.NestedMap(obj.Object, "status")
+	if status == nil {
+		status = make(map[string]interface{})
+	}
+
+	if record == nil {
+		delete(status, "holders")
+		delete(status, "waiters")
+		delete(status, "leaseUUID")
+		delete(status, "expireTime")
+		delete(status, "mode")
+		_ = unstructured.SetNestedMap(obj.Object, status, "status")
+		return nil
+	}
+
+	// Fencing token of the lease is the token returned to the holder in the lock handle
+	status["fencingToken"] = record.FencingToken
+	status["leaseUUID"] = record.UUID
+
+	if expireTime := formatKubernetesTime(record.ExpireAtTimestamp); status["expireTime"] != expireTime {
+		status["expireTime"] = expireTime
+		status["renewTime"] = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	status["mode"] = KubernetesLockModeExclusive
+	if record.IsShared {
+		status["mode"] = KubernetesLockModeShared
+	}
+
+	identity := record.HolderId
+	if identity == "" {
+		identity = record.UUID
+	}
+	status["lockName"] = record.LockName
+	status["holders"] = []interface{}{
+		map[string]interface{}{
+			"identity": identity,
+			"count":    record.SharedHoldersCount,
+		},
+	}
+
+	var members []*KubernetesLockQueueMember
+	for _, member := range record.QueueMembers {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Priority != members[j].Priority {
+			return members[i].Priority > members[j].Priority
+		}
+		return members[i].AcquiredAtTimestamp < members[j].AcquiredAtTimestamp
+	})
+
+	var waiters []interface{}
+	for _, member := range members {
+		waiters = append(waiters, map[string]interface{}{
+			"acquirerId": member.AcquirerId,
+			"since":      formatKubernetesTime(member.AcquiredAtTimestamp),
+			"priority":   int64(member.Priority),
+		})
+	}
+	if len(waiters) > 0 {
+		status["waiters"] = waiters
+	} else {
+		delete(status, "waiters")
+	}
+
+	_ = unstructured.SetNestedMap(obj.Object, status, "status")
+	return nil
+}
+
+func formatKubernetesTime(timestamp int64) string {
+	return time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
+}
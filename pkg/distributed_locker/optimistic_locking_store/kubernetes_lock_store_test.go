@@ -0,0 +1,138 @@
+package optimistic_locking_store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func lockRecordData(uuid string, fencingToken int64, expireAt time.Time) string {
+	return fmt.Sprintf(`{"uuid":%q,"lockName":"mylock","fencingToken":%d,"HolderId":"holder","ExpireAtTimestamp":%d,"SharedHoldersCount":1}`, uuid, fencingToken, expireAt.Unix())
+}
+
+// releasedLockRecordData returns the record of the released lock, which keeps the fencing token of the last lease.
+func releasedLockRecordData(fencingToken int64) string {
+	return fmt.Sprintf(`{"uuid":"","lockName":"mylock","fencingToken":%d}`, fencingToken)
+}
+
+func lockFencingToken(t *testing.T, obj *unstructured.Unstructured) int64 {
+	t.Helper()
+
+	fencingToken, _, err := unstructured.NestedInt64(obj.Object, "status", "fencingToken")
+	if err != nil {
+		t.Fatalf("get fencing token: %s", err)
+	}
+	return fencingToken
+}
+
+func TestSetKubernetesLockData_FencingToken(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	expireAt := time.Now().Add(time.Minute)
+
+	for _, step := range []struct {
+		desc                 string
+		data                 string
+		expectedFencingToken int64
+		expectedLeaseUUID    string
+	}{
+		{"first lease", lockRecordData("uuid-1", 1, expireAt), 1, "uuid-1"},
+		{"renewed lease", lockRecordData("uuid-1", 1, expireAt.Add(time.Minute)), 1, "uuid-1"},
+		{"new lease", lockRecordData("uuid-2", 2, expireAt), 2, "uuid-2"},
+		{"released lock", releasedLockRecordData(2), 2, ""},
+		{"lease after release", lockRecordData("uuid-3", 3, expireAt), 3, "uuid-3"},
+		{"removed record", "", 3, ""},
+		// The token of the holder is published as is, even if the lock has been recreated
+		{"lease of the recreated lock", lockRecordData("uuid-4", 1, expireAt), 1, "uuid-4"},
+	} {
+		if err := SetKubernetesLockData(obj, step.data); err != nil {
+			t.Fatalf("%s: set lock data: %s", step.desc, err)
+		}
+
+		if fencingToken := lockFencingToken(t, obj); fencingToken != step.expectedFencingToken {
+			t.Errorf("%s: got fencing token %d, expected %d", step.desc, fencingToken, step.expectedFencingToken)
+		}
+		if leaseUUID, _, _ := unstructured.NestedString(obj.Object, "status", "leaseUUID"); leaseUUID != step.expectedLeaseUUID {
+			t.Errorf("%s: got lease uuid %q, expected %q", step.desc, leaseUUID, step.expectedLeaseUUID)
+		}
+		if data := obj.GetAnnotations()[KubernetesLeaseDataAnnotation]; data != step.data {
+			t.Errorf("%s: got data annotation %q, expected %q", step.desc, data, step.data)
+		}
+	}
+}
+
+func TestSetKubernetesLockData_Spec(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	_ = unstructured.SetNestedField(obj.Object, KubernetesLockModeShared, "spec", "mode")
+
+	if err := SetKubernetesLockData(obj, lockRecordData("uuid-1", 1, time.Now())); err == nil {
+		t.Errorf("expected error for the exclusive lease of the shared lock")
+	}
+	if fencingToken := lockFencingToken(t, obj); fencingToken != 0 {
+		t.Errorf("rejected lease should not change the fencing token, got %d", fencingToken)
+	}
+}
+
+func TestKubernetesLockStore_FencingToken(t *testing.T) {
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		KubernetesLockGVR: "LockList",
+	})
+	store := NewKubernetesLockStore(client, "ns")
+	key := LockLeaseKey("mylock")
+
+	put := func(data string) {
+		t.Helper()
+
+		value, err := store.GetValue(key)
+		if err != nil {
+			t.Fatalf("get value: %s", err)
+		}
+		value.Data = data
+		if err := store.PutValue(key, value); err != nil {
+			t.Fatalf("put value: %s", err)
+		}
+	}
+
+	getLock := func() *unstructured.Unstructured {
+		t.Helper()
+
+		obj, err := client.Resource(KubernetesLockGVR).Namespace("ns").Get(context.Background(), KubernetesLockObjectName(key), metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get lock: %s", err)
+		}
+		return obj
+	}
+
+	expireAt := time.Now().Add(time.Minute)
+
+	put(lockRecordData("uuid-1", 1, expireAt))
+	if fencingToken := lockFencingToken(t, getLock()); fencingToken != 1 {
+		t.Errorf("got fencing token %d of the created lock, expected 1", fencingToken)
+	}
+
+	put(lockRecordData("uuid-1", 1, expireAt.Add(time.Minute)))
+	if fencingToken := lockFencingToken(t, getLock()); fencingToken != 1 {
+		t.Errorf("got fencing token %d of the renewed lease, expected 1", fencingToken)
+	}
+
+	// Lock object is kept on release to keep the fencing token
+	put("")
+	obj := getLock()
+	if fencingToken := lockFencingToken(t, obj); fencingToken != 1 {
+		t.Errorf("got fencing token %d of the released lock, expected 1", fencingToken)
+	}
+	if holders, found, _ := unstructured.NestedSlice(obj.Object, "status", "holders"); found {
+		t.Errorf("released lock should have no holders, got %v", holders)
+	}
+
+	put(lockRecordData("uuid-2", 2, expireAt))
+	if fencingToken := lockFencingToken(t, getLock()); fencingToken != 2 {
+		t.Errorf("got fencing token %d of the new lease, expected 2", fencingToken)
+	}
+}
@@ -2,21 +2,35 @@ package optimistic_locking_store
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"strings"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
 )
 
+var ConfigMapGVR = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "configmaps"}
+
 type KubernetesResourceAnnotationsStore struct {
 	KubernetesInterface dynamic.Interface
 	GVR                 schema.GroupVersionResource
 	ResourceName        string
 	Namespace           string
+
+	// The resource is created when it does not exist, creation is disabled when CreateOptions is nil.
+	CreateOptions *KubernetesResourceCreateOptions
+}
+
+// KubernetesResourceCreateOptions describes the resource created by the store when it does not exist.
+type KubernetesResourceCreateOptions struct {
+	// Kind of the resource, "ConfigMap" is used for configmaps by default.
+	Kind            string
+	Labels          map[string]string
+	OwnerReferences []metav1.OwnerReference
 }
 
 func NewKubernetesResourceAnnotationsStore(kubernetesInterface dynamic.Interface, gvr schema.GroupVersionResource, resourceName, namespace string) *KubernetesResourceAnnotationsStore {
@@ -25,9 +39,14 @@ func NewKubernetesResourceAnnotationsStore(kubernetesInterface dynamic.Interface
 		GVR:                 gvr,
 		ResourceName:        resourceName,
 		Namespace:           namespace,
+		CreateOptions:       &KubernetesResourceCreateOptions{},
 	}
 }
 
+func (store *KubernetesResourceAnnotationsStore) StoreId() string {
+	return fmt.Sprintf("kubernetes:%s:%s/%s", store.GVR.String(), store.Namespace, store.ResourceName)
+}
+
 func (store *KubernetesResourceAnnotationsStore) GetValue(key string) (*Value, error) {
 	debug("KubernetesResourceAnnotationsStore.GetValue by key %q", key)
 
@@ -45,42 +64,80 @@ func (store *KubernetesResourceAnnotationsStore) GetValue(key string) (*Value, e
 	}
 }
 
+// GetValues gets values by the keys with a single request of the resource, each value keeps its own copy
+// of the resource to be put independently.
+func (store *KubernetesResourceAnnotationsStore) GetValues(keys []string) ([]*Value, error) {
+	debug("KubernetesResourceAnnotationsStore.GetValues by keys %v", keys)
+
+	obj, err := store.getResource()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]*Value, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, &Value{
+			Data:     obj.GetAnnotations()[key],
+			metadata: obj.DeepCopy(),
+		})
+	}
+	return values, nil
+}
+
 func (store *KubernetesResourceAnnotationsStore) PutValue(key string, value *Value) error {
 	debug("KubernetesResourceAnnotationsStore.PutValue %s %#v", key, value)
 
 	obj := value.metadata.(*unstructured.Unstructured)
 
-	annots := obj.GetAnnotations()
-
+	// Merge patch touches only the annotation of the key, null value removes the annotation.
+	// The resourceVersion of the read object in the patch makes the server reject the patch with the conflict
+	// when the object has been changed meanwhile.
+	var annotValue interface{}
 	if value.Data != "" {
-		if annots == nil {
-			annots = make(map[string]string)
-		}
-		annots[key] = value.Data
-		obj.SetAnnotations(annots)
-	} else if annots != nil {
-		delete(annots, key)
-		obj.SetAnnotations(annots)
+		annotValue = value.Data
+	}
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": obj.GetResourceVersion(),
+			"annotations":     map[string]interface{}{key: annotValue},
+		},
 	}
 
-	debug("KubernetesResourceAnnotationsStore.PutValue annots=%#v", obj.GetAnnotations())
-
-	if _, err := store.updateResource(obj); isOptimisticLockingError(err) {
+	if err := store.patchResource(patch); errors.IsConflict(err) || errors.IsNotFound(err) {
 		return ErrRecordVersionChanged
 	} else if err != nil {
-		return err
+		return fmt.Errorf("cannot patch %s by name %s: %s", store.GVR.String(), store.ResourceName, err)
 	}
 	return nil
 }
 
-func (store *KubernetesResourceAnnotationsStore) getResource() (*unstructured.Unstructured, error) {
-	var err error
-	var obj *unstructured.Unstructured
+func (store *KubernetesResourceAnnotationsStore) ListKeys() ([]string, error) {
+	obj, err := store.getResource()
+	if err != nil {
+		return nil, err
+	}
+
+	// Resource could be annotated by kubectl or other tools, only lockgate keys are listed
+	var keys []string
+	for key := range obj.GetAnnotations() {
+		if IsLockgateKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
 
+func (store *KubernetesResourceAnnotationsStore) resourceInterface() dynamic.ResourceInterface {
 	if store.Namespace == "" {
-		obj, err = store.KubernetesInterface.Resource(store.GVR).Get(context.Background(), store.ResourceName, metav1.GetOptions{})
-	} else {
-		obj, err = store.KubernetesInterface.Resource(store.GVR).Namespace(store.Namespace).Get(context.Background(), store.ResourceName, metav1.GetOptions{})
+		return store.KubernetesInterface.Resource(store.GVR)
+	}
+	return store.KubernetesInterface.Resource(store.GVR).Namespace(store.Namespace)
+}
+
+func (store *KubernetesResourceAnnotationsStore) getResource() (*unstructured.Unstructured, error) {
+	obj, err := store.resourceInterface().Get(context.Background(), store.ResourceName, metav1.GetOptions{})
+	if errors.IsNotFound(err) && store.CreateOptions != nil {
+		obj, err = store.createResource()
 	}
 
 	if err != nil {
@@ -89,26 +146,43 @@ func (store *KubernetesResourceAnnotationsStore) getResource() (*unstructured.Un
 	return obj, err
 }
 
-func (store *KubernetesResourceAnnotationsStore) updateResource(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
-	var err error
-	var newObj *unstructured.Unstructured
-
-	if store.Namespace == "" {
-		newObj, err = store.KubernetesInterface.Resource(store.GVR).Update(context.Background(), obj, metav1.UpdateOptions{})
-	} else {
-		newObj, err = store.KubernetesInterface.Resource(store.GVR).Namespace(store.Namespace).Update(context.Background(), obj, metav1.UpdateOptions{})
+func (store *KubernetesResourceAnnotationsStore) createResource() (*unstructured.Unstructured, error) {
+	kind := store.CreateOptions.Kind
+	if kind == "" {
+		if store.GVR != ConfigMapGVR {
+			return nil, fmt.Errorf("resource does not exist and cannot be created: kind of the resource is not specified")
+		}
+		kind = "ConfigMap"
 	}
 
-	if errors.IsAlreadyExists(err) || err == nil {
-		return newObj, err
-	} else {
-		return newObj, fmt.Errorf("cannot update %s by name %s: %s", store.GVR.String(), store.ResourceName, err)
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(store.GVR.GroupVersion().String())
+	obj.SetKind(kind)
+	obj.SetName(store.ResourceName)
+	obj.SetNamespace(store.Namespace)
+	obj.SetLabels(store.CreateOptions.Labels)
+	obj.SetOwnerReferences(store.CreateOptions.OwnerReferences)
+
+	debug("KubernetesResourceAnnotationsStore creating %s by name %q", store.GVR.String(), store.ResourceName)
+
+	newObj, err := store.resourceInterface().Create(context.Background(), obj, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		// Created by someone else meanwhile
+		return store.resourceInterface().Get(context.Background(), store.ResourceName, metav1.GetOptions{})
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to create resource: %s", err)
 	}
+	return newObj, nil
 }
 
-func isOptimisticLockingError(err error) bool {
+func (store *KubernetesResourceAnnotationsStore) patchResource(patch map[string]interface{}) error {
+	data, err := json.Marshal(patch)
 	if err != nil {
-		return strings.HasSuffix(err.Error(), "the object has been modified; please apply your changes to the latest version and try again")
+		return fmt.Errorf("unable to marshal patch: %s", err)
 	}
-	return false
+
+	debug("KubernetesResourceAnnotationsStore patch %s", data)
+
+	_, err = store.resourceInterface().Patch(context.Background(), store.ResourceName, types.MergePatchType, data, metav1.PatchOptions{})
+	return err
 }
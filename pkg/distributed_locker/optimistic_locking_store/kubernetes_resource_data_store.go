@@ -0,0 +1,206 @@
+package optimistic_locking_store
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var SecretGVR = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "secrets"}
+
+// KubernetesResourceDataStore stores values in the data map of a ConfigMap or a Secret instead of annotations.
+// Keys are escaped to be valid data keys: characters other than alphanumerics, "-" and "." are replaced with "_XX",
+// where XX is the hex code of the character.
+type KubernetesResourceDataStore struct {
+	KubernetesInterface dynamic.Interface
+	// GVR is either ConfigMapGVR or SecretGVR.
+	GVR          schema.GroupVersionResource
+	ResourceName string
+	Namespace    string
+
+	// The resource is created when it does not exist, set CreateOptions to nil to disable creation.
+	CreateOptions *KubernetesResourceCreateOptions
+}
+
+func NewKubernetesConfigMapDataStore(kubernetesInterface dynamic.Interface, resourceName, namespace string) *KubernetesResourceDataStore {
+	return &KubernetesResourceDataStore{
+		KubernetesInterface: kubernetesInterface,
+		GVR:                 ConfigMapGVR,
+		ResourceName:        resourceName,
+		Namespace:           namespace,
+		CreateOptions:       &KubernetesResourceCreateOptions{Kind: "ConfigMap"},
+	}
+}
+
+func NewKubernetesSecretDataStore(kubernetesInterface dynamic.Interface, resourceName, namespace string) *KubernetesResourceDataStore {
+	return &KubernetesResourceDataStore{
+		KubernetesInterface: kubernetesInterface,
+		GVR:                 SecretGVR,
+		ResourceName:        resourceName,
+		Namespace:           namespace,
+		CreateOptions:       &KubernetesResourceCreateOptions{Kind: "Secret"},
+	}
+}
+
+func (store *KubernetesResourceDataStore) StoreId() string {
+	return fmt.Sprintf("kubernetes-data:%s:%s/%s", store.GVR.String(), store.Namespace, store.ResourceName)
+}
+
+func (store *KubernetesResourceDataStore) GetValue(key string) (*Value, error) {
+	debug("KubernetesResourceDataStore.GetValue by key %q", key)
+
+	obj, err := store.resource().getResource()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := store.getData(obj, KubernetesDataKey(key))
+	if err != nil {
+		return nil, fmt.Errorf("cannot get %s by name %q data by key %q: %s", store.GVR.String(), store.ResourceName, key, err)
+	}
+
+	value := &Value{
+		Data:     data,
+		metadata: obj,
+	}
+
+	debug("KubernetesResourceDataStore.GetValue by key %q -> %#v", key, value)
+
+	return value, nil
+}
+
+// GetValues gets values by the keys with a single request of the resource, each value keeps its own copy
+// of the resource to be put independently.
+func (store *KubernetesResourceDataStore) GetValues(keys []string) ([]*Value, error) {
+	debug("KubernetesResourceDataStore.GetValues by keys %v", keys)
+
+	obj, err := store.resource().getResource()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]*Value, 0, len(keys))
+	for _, key := range keys {
+		data, err := store.getData(obj, KubernetesDataKey(key))
+		if err != nil {
+			return nil, fmt.Errorf("cannot get %s by name %q data by key %q: %s", store.GVR.String(), store.ResourceName, key, err)
+		}
+		values = append(values, &Value{
+			Data:     data,
+			metadata: obj.DeepCopy(),
+		})
+	}
+	return values, nil
+}
+
+func (store *KubernetesResourceDataStore) PutValue(key string, value *Value) error {
+	debug("KubernetesResourceDataStore.PutValue %s %#v", key, value)
+
+	obj := value.metadata.(*unstructured.Unstructured)
+
+	// Merge patch touches only the data key, null value removes the key.
+	// The resourceVersion of the read object makes the server reject the patch when the object has been changed meanwhile.
+	var dataValue interface{}
+	if value.Data != "" {
+		if store.isSecret() {
+			dataValue = base64.StdEncoding.EncodeToString([]byte(value.Data))
+		} else {
+			dataValue = value.Data
+		}
+	}
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": obj.GetResourceVersion(),
+		},
+		"data": map[string]interface{}{KubernetesDataKey(key): dataValue},
+	}
+
+	if err := store.resource().patchResource(patch); errors.IsConflict(err) || errors.IsNotFound(err) {
+		return ErrRecordVersionChanged
+	} else if err != nil {
+		return fmt.Errorf("cannot patch %s by name %s: %s", store.GVR.String(), store.ResourceName, err)
+	}
+	return nil
+}
+
+func (store *KubernetesResourceDataStore) ListKeys() ([]string, error) {
+	obj, err := store.resource().getResource()
+	if err != nil {
+		return nil, err
+	}
+
+	data, _, _ := unstructured.NestedMap(obj.Object, "data")
+
+	var keys []string
+	for dataKey := range data {
+		if key, err := ParseKubernetesDataKey(dataKey); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (store *KubernetesResourceDataStore) isSecret() bool {
+	return store.GVR == SecretGVR
+}
+
+func (store *KubernetesResourceDataStore) getData(obj *unstructured.Unstructured, dataKey string) (string, error) {
+	data, _, err := unstructured.NestedString(obj.Object, "data", dataKey)
+	if err != nil || data == "" || !store.isSecret() {
+		return data, err
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode secret data: %s", err)
+	}
+	return string(decoded), nil
+}
+
+// resource returns the annotations store of the same resource, which is used to get, create and patch the resource.
+func (store *KubernetesResourceDataStore) resource() *KubernetesResourceAnnotationsStore {
+	resource := NewKubernetesResourceAnnotationsStore(store.KubernetesInterface, store.GVR, store.ResourceName, store.Namespace)
+	resource.CreateOptions = store.CreateOptions
+	return resource
+}
+
+// KubernetesDataKey escapes the key to be a valid ConfigMap or Secret data key.
+func KubernetesDataKey(key string) string {
+	var res strings.Builder
+	for _, b := range []byte(key) {
+		if (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9') || b == '-' || b == '.' {
+			res.WriteByte(b)
+		} else {
+			fmt.Fprintf(&res, "_%02x", b)
+		}
+	}
+	return res.String()
+}
+
+// ParseKubernetesDataKey returns the key escaped by KubernetesDataKey.
+func ParseKubernetesDataKey(dataKey string) (string, error) {
+	var res strings.Builder
+	for i := 0; i < len(dataKey); i++ {
+		if dataKey[i] != '_' {
+			res.WriteByte(dataKey[i])
+			continue
+		}
+
+		if i+2 >= len(dataKey) {
+			return "", fmt.Errorf("bad escape sequence in data key %q", dataKey)
+		}
+		b, err := strconv.ParseUint(dataKey[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("bad escape sequence in data key %q: %s", dataKey, err)
+		}
+		res.WriteByte(byte(b))
+		i += 2
+	}
+	return res.String(), nil
+}
@@ -0,0 +1,146 @@
+package optimistic_locking_store
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"k8s.io/client-go/dynamic"
+)
+
+// KubernetesShardedAnnotationsStore spreads keys over the annotations of N ConfigMaps named <prefix>-0 … <prefix>-<N-1>,
+// so that puts of keys in different shards do not race on a single resourceVersion.
+// Missing ConfigMaps are created on the first use.
+type KubernetesShardedAnnotationsStore struct {
+	KubernetesInterface dynamic.Interface
+	ResourceNamePrefix  string
+	Namespace           string
+	Shards              int
+
+	// ShardKeyFunc maps the key to the shard key, keys with the same shard key are stored in the same ConfigMap.
+	// Use it to keep keys changed together within one shard (see ShardKeyByName). By default the key itself is used.
+	ShardKeyFunc func(key string) string
+
+	// Options of the missing shards creation, set to nil to disable creation.
+	CreateOptions *KubernetesResourceCreateOptions
+}
+
+func NewKubernetesShardedAnnotationsStore(kubernetesInterface dynamic.Interface, resourceNamePrefix, namespace string, shards int) *KubernetesShardedAnnotationsStore {
+	return &KubernetesShardedAnnotationsStore{
+		KubernetesInterface: kubernetesInterface,
+		ResourceNamePrefix:  resourceNamePrefix,
+		Namespace:           namespace,
+		Shards:              shards,
+		CreateOptions:       &KubernetesResourceCreateOptions{Kind: "ConfigMap"},
+	}
+}
+
+func (store *KubernetesShardedAnnotationsStore) StoreId() string {
+	return fmt.Sprintf("kubernetes-sharded:%s:%s/%s-%d", ConfigMapGVR.String(), store.Namespace, store.ResourceNamePrefix, store.Shards)
+}
+
+func (store *KubernetesShardedAnnotationsStore) GetValue(key string) (*Value, error) {
+	shardStore, err := store.getShardStore(key)
+	if err != nil {
+		return nil, err
+	}
+	return shardStore.GetValue(key)
+}
+
+// GetValues gets values by the keys with a single request per shard, keys placed into the same shard
+// by ShardKeyFunc are got together.
+func (store *KubernetesShardedAnnotationsStore) GetValues(keys []string) ([]*Value, error) {
+	if store.Shards <= 0 {
+		return nil, fmt.Errorf("bad number of shards %d", store.Shards)
+	}
+
+	keyIndexesByShard := make(map[int][]int)
+	var shards []int
+	for i, key := range keys {
+		shard := store.ShardOf(key)
+		if _, hasKey := keyIndexesByShard[shard]; !hasKey {
+			shards = append(shards, shard)
+		}
+		keyIndexesByShard[shard] = append(keyIndexesByShard[shard], i)
+	}
+
+	values := make([]*Value, len(keys))
+	for _, shard := range shards {
+		var shardKeys []string
+		for _, i := range keyIndexesByShard[shard] {
+			shardKeys = append(shardKeys, keys[i])
+		}
+
+		shardValues, err := store.shardStore(shard).GetValues(shardKeys)
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range keyIndexesByShard[shard] {
+			values[i] = shardValues[j]
+		}
+	}
+	return values, nil
+}
+
+func (store *KubernetesShardedAnnotationsStore) PutValue(key string, value *Value) error {
+	shardStore, err := store.getShardStore(key)
+	if err != nil {
+		return err
+	}
+	return shardStore.PutValue(key, value)
+}
+
+func (store *KubernetesShardedAnnotationsStore) ListKeys() ([]string, error) {
+	var keys []string
+	for shard := 0; shard < store.Shards; shard++ {
+		shardKeys, err := store.shardStore(shard).ListKeys()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, shardKeys...)
+	}
+	return keys, nil
+}
+
+// ShardKeyByName drops the record kind from keys like "lockgate.io/<hash>" or "reservations.lockgate.io/<hash>",
+// so that the lock lease and all auxiliary records of the same name are stored in the same shard.
+func ShardKeyByName(key string) string {
+	if ind := strings.LastIndex(key, "/"); ind != -1 {
+		return key[ind+1:]
+	}
+	return key
+}
+
+// ShardOf returns the index of the shard storing the key.
+func (store *KubernetesShardedAnnotationsStore) ShardOf(key string) int {
+	shardKey := key
+	if store.ShardKeyFunc != nil {
+		shardKey = store.ShardKeyFunc(key)
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(shardKey))
+	return int(h.Sum32() % uint32(store.Shards))
+}
+
+func (store *KubernetesShardedAnnotationsStore) getShardStore(key string) (*KubernetesResourceAnnotationsStore, error) {
+	if store.Shards <= 0 {
+		return nil, fmt.Errorf("bad number of shards %d", store.Shards)
+	}
+
+	shard := store.ShardOf(key)
+	debug("KubernetesShardedAnnotationsStore key %q -> shard %d", key, shard)
+
+	return store.shardStore(shard), nil
+}
+
+// shardStore returns the store of the shard, which is cheap to create, so that the store is not shared between calls.
+func (store *KubernetesShardedAnnotationsStore) shardStore(shard int) *KubernetesResourceAnnotationsStore {
+	shardStore := NewKubernetesResourceAnnotationsStore(store.KubernetesInterface, ConfigMapGVR, store.shardResourceName(shard), store.Namespace)
+	shardStore.CreateOptions = store.CreateOptions
+	return shardStore
+}
+
+func (store *KubernetesShardedAnnotationsStore) shardResourceName(shard int) string {
+	return fmt.Sprintf("%s-%d", store.ResourceNamePrefix, shard)
+}
@@ -0,0 +1,333 @@
+package optimistic_locking_store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newFakeDynamicClient returns the fake client emulating resourceVersion of the API server:
+// the version is bumped on every change and the merge patch with a stale version is rejected with the conflict.
+func newFakeDynamicClient() *fake.FakeDynamicClient {
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		ConfigMapGVR: "ConfigMapList",
+	})
+
+	var resourceVersion int
+	nextResourceVersion := func() string {
+		resourceVersion++
+		return strconv.Itoa(resourceVersion)
+	}
+
+	client.PrependReactor("create", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		action.(k8stesting.CreateAction).GetObject().(metav1.Object).SetResourceVersion(nextResourceVersion())
+		return false, nil, nil
+	})
+
+	client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patchAction := action.(k8stesting.PatchAction)
+		gvr, namespace, name := patchAction.GetResource(), patchAction.GetNamespace(), patchAction.GetName()
+
+		current, err := client.Tracker().Get(gvr, namespace, name)
+		if err != nil {
+			return true, nil, err
+		}
+		currentObj := current.(*unstructured.Unstructured)
+
+		patch := &unstructured.Unstructured{}
+		if err := json.Unmarshal(patchAction.GetPatch(), &patch.Object); err != nil {
+			return true, nil, err
+		}
+		if rv := patch.GetResourceVersion(); rv != "" && rv != currentObj.GetResourceVersion() {
+			return true, nil, errors.NewConflict(gvr.GroupResource(), name, fmt.Errorf("resourceVersion %s is stale", rv))
+		}
+
+		currentData, err := json.Marshal(currentObj)
+		if err != nil {
+			return true, nil, err
+		}
+		newData, err := jsonpatch.MergePatch(currentData, patchAction.GetPatch())
+		if err != nil {
+			return true, nil, err
+		}
+
+		newObj := &unstructured.Unstructured{}
+		if err := json.Unmarshal(newData, &newObj.Object); err != nil {
+			return true, nil, err
+		}
+		newObj.SetResourceVersion(nextResourceVersion())
+
+		return true, newObj, client.Tracker().Update(gvr, newObj, namespace)
+	})
+
+	return client
+}
+
+func TestKubernetesShardedAnnotationsStore_CreatesShardOnPut(t *testing.T) {
+	client := newFakeDynamicClient()
+	store := NewKubernetesShardedAnnotationsStore(client, "locks", "ns", 4)
+
+	key := LockLeaseKey("mylock")
+	value, err := store.GetValue(key)
+	if err != nil {
+		t.Fatalf("get value: %s", err)
+	}
+	value.Data = "data"
+	if err := store.PutValue(key, value); err != nil {
+		t.Fatalf("put value: %s", err)
+	}
+
+	shard := store.ShardOf(key)
+	for i := 0; i < store.Shards; i++ {
+		obj, err := client.Resource(ConfigMapGVR).Namespace("ns").Get(context.Background(), fmt.Sprintf("locks-%d", i), metav1.GetOptions{})
+		if i != shard {
+			if !errors.IsNotFound(err) {
+				t.Errorf("shard %d should not be created, got err %v", i, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("get shard %d: %s", i, err)
+		}
+		if got := obj.GetAnnotations()[key]; got != "data" {
+			t.Errorf("shard %d annotation %q = %q, expected %q", i, key, got, "data")
+		}
+	}
+
+	value, err = store.GetValue(key)
+	if err != nil {
+		t.Fatalf("get value: %s", err)
+	}
+	if value.Data != "data" {
+		t.Errorf("got value %q, expected %q", value.Data, "data")
+	}
+}
+
+func TestKubernetesShardedAnnotationsStore_CreationDisabled(t *testing.T) {
+	store := NewKubernetesShardedAnnotationsStore(newFakeDynamicClient(), "locks", "ns", 4)
+	store.CreateOptions = nil
+
+	if _, err := store.GetValue(LockLeaseKey("mylock")); err == nil {
+		t.Errorf("expected error for the missing shard")
+	}
+}
+
+func TestKubernetesShardedAnnotationsStore_ShardOf(t *testing.T) {
+	store := NewKubernetesShardedAnnotationsStore(nil, "locks", "ns", 16)
+
+	// Keys should keep their shards between versions, otherwise the locks taken by the older version are not seen
+	for key, expectedShard := range map[string]int{
+		"a":                    12,
+		"mylock":               12,
+		LockLeaseKey("mylock"): 13,
+	} {
+		if shard := store.ShardOf(key); shard != expectedShard {
+			t.Errorf("ShardOf(%q) = %d, expected %d", key, shard, expectedShard)
+		}
+	}
+
+	otherStore := NewKubernetesShardedAnnotationsStore(nil, "other", "other-ns", 16)
+	for i := 0; i < 100; i++ {
+		key := LockLeaseKey(fmt.Sprintf("lock-%d", i))
+		shard := store.ShardOf(key)
+		if shard < 0 || shard >= store.Shards {
+			t.Fatalf("ShardOf(%q) = %d is out of range", key, shard)
+		}
+		if otherShard := otherStore.ShardOf(key); otherShard != shard {
+			t.Errorf("ShardOf(%q) = %d differs from %d of another store instance", key, otherShard, shard)
+		}
+	}
+}
+
+func TestKubernetesShardedAnnotationsStore_ShardKeyByName(t *testing.T) {
+	store := NewKubernetesShardedAnnotationsStore(nil, "locks", "ns", 16)
+	store.ShardKeyFunc = ShardKeyByName
+
+	shardsUsed := make(map[int]bool)
+	for i := 0; i < 100; i++ {
+		leaseKey := LockLeaseKey(fmt.Sprintf("lock-%d", i))
+		shard := store.ShardOf(leaseKey)
+		shardsUsed[shard] = true
+
+		for _, kind := range []string{"reservations", "run-once", "cond"} {
+			recordKey := fmt.Sprintf("%s.%s", kind, leaseKey)
+			if recordShard := store.ShardOf(recordKey); recordShard != shard {
+				t.Errorf("ShardOf(%q) = %d, expected shard %d of the lock lease", recordKey, recordShard, shard)
+			}
+		}
+	}
+
+	if len(shardsUsed) < 2 {
+		t.Errorf("expected locks to be spread over shards, got %d shard used", len(shardsUsed))
+	}
+}
+
+func TestKubernetesShardedAnnotationsStore_PutConflict(t *testing.T) {
+	store := NewKubernetesShardedAnnotationsStore(newFakeDynamicClient(), "locks", "ns", 4)
+	store.ShardKeyFunc = ShardKeyByName
+
+	key := LockLeaseKey("mylock")
+	firstValue, err := store.GetValue(key)
+	if err != nil {
+		t.Fatalf("get value: %s", err)
+	}
+	secondValue, err := store.GetValue(key)
+	if err != nil {
+		t.Fatalf("get value: %s", err)
+	}
+
+	firstValue.Data = "first"
+	if err := store.PutValue(key, firstValue); err != nil {
+		t.Fatalf("put value: %s", err)
+	}
+
+	secondValue.Data = "second"
+	if err := store.PutValue(key, secondValue); !IsErrRecordVersionChanged(err) {
+		t.Errorf("put of the stale value: expected %q, got %v", ErrRecordVersionChanged, err)
+	}
+
+	// Stale value of the record in the same shard conflicts as well
+	recordKey := fmt.Sprintf("reservations.%s", key)
+	staleValue := &Value{Data: "record", metadata: secondValue.metadata}
+	if err := store.PutValue(recordKey, staleValue); !IsErrRecordVersionChanged(err) {
+		t.Errorf("put of the stale record value: expected %q, got %v", ErrRecordVersionChanged, err)
+	}
+
+	value, err := store.GetValue(key)
+	if err != nil {
+		t.Fatalf("get value: %s", err)
+	}
+	if value.Data != "first" {
+		t.Errorf("got value %q, expected %q", value.Data, "first")
+	}
+
+	// Deletion of the key removes the annotation
+	value.Data = ""
+	if err := store.PutValue(key, value); err != nil {
+		t.Fatalf("delete value: %s", err)
+	}
+	keys, err := store.ListKeys()
+	if err != nil {
+		t.Fatalf("list keys: %s", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("expected no keys after deletion, got %v", keys)
+	}
+}
+
+func TestKubernetesShardedAnnotationsStore_GetValues(t *testing.T) {
+	client := newFakeDynamicClient()
+	store := NewKubernetesShardedAnnotationsStore(client, "locks", "ns", 4)
+	store.ShardKeyFunc = ShardKeyByName
+
+	var keys []string
+	for i := 0; i < 8; i++ {
+		key := LockLeaseKey(fmt.Sprintf("lock-%d", i))
+		keys = append(keys, key)
+
+		value, err := store.GetValue(key)
+		if err != nil {
+			t.Fatalf("get value: %s", err)
+		}
+		value.Data = key
+		if err := store.PutValue(key, value); err != nil {
+			t.Fatalf("put value: %s", err)
+		}
+	}
+	keys = append(keys, LockLeaseKey("missing"))
+
+	client.ClearActions()
+	values, err := GetValues(store, keys)
+	if err != nil {
+		t.Fatalf("get values: %s", err)
+	}
+
+	for i, key := range keys {
+		expected := key
+		if i == len(keys)-1 {
+			expected = ""
+		}
+		if values[i].Data != expected {
+			t.Errorf("value of %q = %q, expected %q", key, values[i].Data, expected)
+		}
+	}
+
+	shards := make(map[int]bool)
+	for _, key := range keys {
+		shards[store.ShardOf(key)] = true
+	}
+	var gets int
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "get" {
+			gets++
+		}
+	}
+	if gets != len(shards) {
+		t.Errorf("expected %d get requests, one per shard, got %d", len(shards), gets)
+	}
+}
+
+func TestKubernetesShardedAnnotationsStore_ListKeys(t *testing.T) {
+	client := newFakeDynamicClient()
+	store := NewKubernetesShardedAnnotationsStore(client, "locks", "ns", 4)
+	store.ShardKeyFunc = ShardKeyByName
+
+	expectedKeys := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		for _, key := range []string{LockLeaseKey(fmt.Sprintf("lock-%d", i)), fmt.Sprintf("reservations.%s", LockLeaseKey(fmt.Sprintf("lock-%d", i)))} {
+			expectedKeys[key] = true
+
+			value, err := store.GetValue(key)
+			if err != nil {
+				t.Fatalf("get value: %s", err)
+			}
+			value.Data = "data"
+			if err := store.PutValue(key, value); err != nil {
+				t.Fatalf("put value: %s", err)
+			}
+		}
+	}
+
+	// Shards are annotated by kubectl and other tools as well
+	for shard := 0; shard < store.Shards; shard++ {
+		obj, err := client.Resource(ConfigMapGVR).Namespace("ns").Get(context.Background(), fmt.Sprintf("locks-%d", shard), metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			t.Fatalf("get shard %d: %s", shard, err)
+		}
+
+		annots := obj.GetAnnotations()
+		annots["kubectl.kubernetes.io/last-applied-configuration"] = "{}"
+		annots["example.com/owner"] = "team"
+		obj.SetAnnotations(annots)
+		if _, err := client.Resource(ConfigMapGVR).Namespace("ns").Update(context.Background(), obj, metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("update shard %d: %s", shard, err)
+		}
+	}
+
+	keys, err := store.ListKeys()
+	if err != nil {
+		t.Fatalf("list keys: %s", err)
+	}
+	if len(keys) != len(expectedKeys) {
+		t.Errorf("got %d keys %v, expected %d lockgate keys", len(keys), keys, len(expectedKeys))
+	}
+	for _, key := range keys {
+		if !expectedKeys[key] {
+			t.Errorf("got unexpected key %q", key)
+		}
+	}
+}
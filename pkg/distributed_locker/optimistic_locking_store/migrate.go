@@ -0,0 +1,82 @@
+package optimistic_locking_store
+
+import (
+	"fmt"
+	"time"
+)
+
+const migrateRetryPeriod = 50 * time.Millisecond
+
+type MigrateResult struct {
+	// Moved is the number of records moved to the target store.
+	Moved int
+	// Conflicts are keys of records existing in both stores, such records are left in the source store
+	// and should be resolved manually.
+	Conflicts []string
+}
+
+// MigrateValues moves lockgate records (see IsLockgateKey) from one store to another,
+// for example from the annotations of a ConfigMap to its data. Records already existing in the target store
+// are neither overwritten nor removed from the source store, keys of such records are reported in MigrateResult.Conflicts.
+//
+// Clients should be stopped or switched to the target store before the migration,
+// records changed in the source store after the migration are not moved.
+func MigrateValues(from OptimisticLockingStore, to OptimisticLockingStore) (*MigrateResult, error) {
+	lister, ok := from.(KeysLister)
+	if !ok {
+		return nil, fmt.Errorf("store %T is not able to list keys", from)
+	}
+
+	keys, err := lister.ListKeys()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list store keys: %s", err)
+	}
+
+	res := &MigrateResult{}
+	for _, key := range keys {
+		if !IsLockgateKey(key) {
+			continue
+		}
+
+		value, err := from.GetValue(key)
+		if err != nil {
+			return res, fmt.Errorf("unable to get value by key %s: %s", key, err)
+		}
+		if value.Data == "" {
+			continue
+		}
+		data := value.Data
+
+		var conflict bool
+		if err := ChangeValue(to, key, migrateRetryPeriod, func(value *Value) (bool, error) {
+			conflict = value.Data != "" && value.Data != data
+			if value.Data != "" {
+				return false, nil
+			}
+			value.Data = data
+			return true, nil
+		}); err != nil {
+			return res, fmt.Errorf("unable to put value by key %s: %s", key, err)
+		}
+
+		if conflict {
+			debug("(migrate) key %s already exists in the target store, skipping", key)
+			res.Conflicts = append(res.Conflicts, key)
+			continue
+		}
+
+		if err := ChangeValue(from, key, migrateRetryPeriod, func(value *Value) (bool, error) {
+			if value.Data == "" {
+				return false, nil
+			}
+			value.Data = ""
+			return true, nil
+		}); err != nil {
+			return res, fmt.Errorf("unable to remove value by key %s: %s", key, err)
+		}
+
+		res.Moved++
+	}
+
+	return res, nil
+}
@@ -0,0 +1,48 @@
+package optimistic_locking_store
+
+import (
+	"testing"
+)
+
+func TestMigrateValues(t *testing.T) {
+	from, to := NewInMemoryStore(), NewInMemoryStore()
+
+	movedKey, conflictKey, sameKey := LockLeaseKey("moved"), LockLeaseKey("conflict"), LockLeaseKey("same")
+	putTestValue(t, from, movedKey, "moved")
+	putTestValue(t, from, conflictKey, "source")
+	putTestValue(t, to, conflictKey, "target")
+	// The record moved by the interrupted migration is still in the source store
+	putTestValue(t, from, sameKey, "same")
+	putTestValue(t, to, sameKey, "same")
+	putTestValue(t, from, "other", "other")
+
+	res, err := MigrateValues(from, to)
+	if err != nil {
+		t.Fatalf("migrate values: %s", err)
+	}
+	if res.Moved != 2 {
+		t.Errorf("got %d moved records, expected 2", res.Moved)
+	}
+	if len(res.Conflicts) != 1 || res.Conflicts[0] != conflictKey {
+		t.Errorf("got conflicts %v, expected [%s]", res.Conflicts, conflictKey)
+	}
+
+	for _, check := range []struct {
+		store        OptimisticLockingStore
+		key          string
+		expectedData string
+	}{
+		{from, movedKey, ""},
+		{to, movedKey, "moved"},
+		{from, sameKey, ""},
+		{to, sameKey, "same"},
+		{from, conflictKey, "source"},
+		{to, conflictKey, "target"},
+		{from, "other", "other"},
+		{to, "other", ""},
+	} {
+		if data := getTestValue(t, check.store, check.key).Data; data != check.expectedData {
+			t.Errorf("got %q by key %s, expected %q", data, check.key, check.expectedData)
+		}
+	}
+}
@@ -1,6 +1,13 @@
 package optimistic_locking_store
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/werf/lockgate/pkg/util"
+)
 
 var ErrRecordVersionChanged = errors.New("record version changed")
 
@@ -9,14 +16,96 @@ type OptimisticLockingStore interface {
 	PutValue(key string, value *Value) error
 }
 
+// StoreIdentifier is implemented by stores which are able to identify the underlying storage.
+type StoreIdentifier interface {
+	StoreId() string
+}
+
+// KeysLister is implemented by stores which are able to list keys having a value,
+// it is used to find stale records of crashed clients.
+type KeysLister interface {
+	ListKeys() ([]string, error)
+}
+
+// ValueWatcher is implemented by stores which are able to notify about changes of the value by the key,
+// so that waiters retry right away instead of waiting for the next poll.
+// The returned channel is closed on the first change since the value has been read by GetValue, for which
+// isChangedFunc returns true (the data is empty for the deleted key), or when stopChan is closed.
+type ValueWatcher interface {
+	WatchValue(key string, value *Value, isChangedFunc func(data string) bool, stopChan <-chan struct{}) <-chan struct{}
+}
+
+// ValuesGetter is implemented by stores which are able to get values by multiple keys in a single request,
+// e.g. stores keeping all records in one Kubernetes resource.
+type ValuesGetter interface {
+	GetValues(keys []string) ([]*Value, error)
+}
+
 type Value struct {
 	Data     string
 	metadata interface{}
 }
 
+// LockLeaseKey returns the key of the lock lease record of the lock.
+func LockLeaseKey(lockName string) string {
+	return fmt.Sprintf("lockgate.io/%s", util.Sha3_224Hash(lockName))
+}
+
+// IsLockgateKey returns true for keys of lockgate records like "lockgate.io/<hash>" or "<kind>.lockgate.io/<hash>",
+// so that other annotations or data keys of the resource shared with lockgate are not taken for records.
+func IsLockgateKey(key string) bool {
+	return strings.HasPrefix(key, "lockgate.io/") || strings.Contains(key, ".lockgate.io/")
+}
+
+// GetValues returns values by the keys in the same order, the values are got in a single request
+// when the store implements ValuesGetter, otherwise one by one.
+func GetValues(store OptimisticLockingStore, keys []string) ([]*Value, error) {
+	if getter, ok := store.(ValuesGetter); ok {
+		return getter.GetValues(keys)
+	}
+
+	values := make([]*Value, 0, len(keys))
+	for _, key := range keys {
+		value, err := store.GetValue(key)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
 func IsErrRecordVersionChanged(err error) bool {
 	if err == nil {
 		return false
 	}
 	return err.Error() == ErrRecordVersionChanged.Error()
 }
+
+// ChangeValue calls changeFunc with the current value by the key and puts the value back into the store
+// when changeFunc returns true. The whole procedure is retried after retryPeriod when the value
+// has been changed by someone else meanwhile.
+func ChangeValue(store OptimisticLockingStore, key string, retryPeriod time.Duration, changeFunc func(value *Value) (bool, error)) error {
+RETRY_CHANGE:
+	value, err := store.GetValue(key)
+	if err != nil {
+		return err
+	}
+	debug("(change value) get value by key %s -> %#v", key, value)
+
+	if changed, err := changeFunc(value); err != nil {
+		return err
+	} else if !changed {
+		return nil
+	}
+
+	if err := store.PutValue(key, value); IsErrRecordVersionChanged(err) {
+		debug("(change value) put value by key %s optimistic locking error! Will retry change...", key)
+		time.Sleep(retryPeriod)
+		goto RETRY_CHANGE
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
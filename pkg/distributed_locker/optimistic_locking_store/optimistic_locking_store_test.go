@@ -0,0 +1,134 @@
+package optimistic_locking_store
+
+import (
+	"sort"
+	"testing"
+)
+
+func getTestValue(t *testing.T, store OptimisticLockingStore, key string) *Value {
+	t.Helper()
+
+	value, err := store.GetValue(key)
+	if err != nil {
+		t.Fatalf("get value: %s", err)
+	}
+	return value
+}
+
+func putTestValue(t *testing.T, store OptimisticLockingStore, key, data string) {
+	t.Helper()
+
+	value := getTestValue(t, store, key)
+	value.Data = data
+	if err := store.PutValue(key, value); err != nil {
+		t.Fatalf("put value: %s", err)
+	}
+}
+
+// testOptimisticLockingStore checks the contract of OptimisticLockingStore common for all stores,
+// tests of the particular stores only cover the behavior specific to the store.
+func testOptimisticLockingStore(t *testing.T, store OptimisticLockingStore) {
+	t.Run("PutConflict", func(t *testing.T) {
+		key := LockLeaseKey("conflict")
+
+		// Both see the missing record, only one creates it
+		firstValue, secondValue := getTestValue(t, store, key), getTestValue(t, store, key)
+		if firstValue.Data != "" {
+			t.Fatalf("got value %q of the missing record, expected empty", firstValue.Data)
+		}
+		firstValue.Data, secondValue.Data = "first", "second"
+		if err := store.PutValue(key, firstValue); err != nil {
+			t.Fatalf("put value: %s", err)
+		}
+		if err := store.PutValue(key, secondValue); !IsErrRecordVersionChanged(err) {
+			t.Errorf("create of the existing record: expected %q, got %v", ErrRecordVersionChanged, err)
+		}
+
+		// Both see the same version, only one updates the record
+		firstValue, secondValue = getTestValue(t, store, key), getTestValue(t, store, key)
+		firstValue.Data, secondValue.Data = "first-update", "second-update"
+		if err := store.PutValue(key, firstValue); err != nil {
+			t.Fatalf("put value: %s", err)
+		}
+		if err := store.PutValue(key, secondValue); !IsErrRecordVersionChanged(err) {
+			t.Errorf("update with the stale version: expected %q, got %v", ErrRecordVersionChanged, err)
+		}
+
+		if value := getTestValue(t, store, key); value.Data != "first-update" {
+			t.Errorf("got value %q, expected %q", value.Data, "first-update")
+		}
+	})
+
+	t.Run("DeleteAndRecreate", func(t *testing.T) {
+		key := LockLeaseKey("deleted")
+
+		// Nothing to delete
+		putTestValue(t, store, key, "")
+
+		putTestValue(t, store, key, "data")
+		staleValue := getTestValue(t, store, key)
+
+		// Record is deleted and re-created with the same data
+		putTestValue(t, store, key, "")
+		if value := getTestValue(t, store, key); value.Data != "" {
+			t.Fatalf("got value %q of the deleted record, expected empty", value.Data)
+		}
+		putTestValue(t, store, key, "data")
+
+		staleValue.Data = "stale"
+		if err := store.PutValue(key, staleValue); !IsErrRecordVersionChanged(err) {
+			t.Errorf("put with the version observed before the deletion: expected %q, got %v", ErrRecordVersionChanged, err)
+		}
+		staleValue.Data = ""
+		if err := store.PutValue(key, staleValue); !IsErrRecordVersionChanged(err) {
+			t.Errorf("delete with the version observed before the deletion: expected %q, got %v", ErrRecordVersionChanged, err)
+		}
+
+		if value := getTestValue(t, store, key); value.Data != "data" {
+			t.Errorf("got value %q, expected %q", value.Data, "data")
+		}
+		putTestValue(t, store, key, "")
+	})
+
+	lister, ok := store.(KeysLister)
+	if !ok {
+		return
+	}
+	t.Run("ListKeys", func(t *testing.T) {
+		initialKeys, err := lister.ListKeys()
+		if err != nil {
+			t.Fatalf("list keys: %s", err)
+		}
+
+		newKeys := []string{LockLeaseKey("listed-a"), LockLeaseKey("listed-b"), "reservations." + LockLeaseKey("listed-a")}
+		for _, key := range newKeys {
+			putTestValue(t, store, key, "data")
+		}
+		// Deleted records and records which have only been read are not listed
+		putTestValue(t, store, LockLeaseKey("listed-deleted"), "data")
+		putTestValue(t, store, LockLeaseKey("listed-deleted"), "")
+		getTestValue(t, store, LockLeaseKey("listed-read"))
+
+		keys, err := lister.ListKeys()
+		if err != nil {
+			t.Fatalf("list keys: %s", err)
+		}
+
+		expectedKeys := append(append([]string{}, initialKeys...), newKeys...)
+		sort.Strings(keys)
+		sort.Strings(expectedKeys)
+		if len(keys) != len(expectedKeys) {
+			t.Fatalf("got keys %v, expected %v", keys, expectedKeys)
+		}
+		for i := range keys {
+			if keys[i] != expectedKeys[i] {
+				t.Errorf("got keys %v, expected %v", keys, expectedKeys)
+				break
+			}
+		}
+	})
+}
+
+func TestInMemoryStore(t *testing.T) {
+	testOptimisticLockingStore(t, NewInMemoryStore())
+}
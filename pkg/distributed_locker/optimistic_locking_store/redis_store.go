@@ -0,0 +1,152 @@
+package optimistic_locking_store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const DefaultRedisKeyPrefix = "lockgate:"
+
+// Checks the version of the record and puts the data with the new version, or deletes the record when the data is empty.
+// KEYS[1] — record key, ARGV[1] — expected version, ARGV[2] — data, ARGV[3] — TTL of the record in milliseconds, 0 for no TTL,
+// ARGV[4] — new version.
+var redisPutValueScript = redis.NewScript(`
+local version = redis.call("HGET", KEYS[1], "version") or ""
+if version ~= ARGV[1] then
+	return 0
+end
+if ARGV[2] == "" then
+	redis.call("DEL", KEYS[1])
+	return 1
+end
+redis.call("HSET", KEYS[1], "data", ARGV[2], "version", ARGV[4])
+if tonumber(ARGV[3]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[3])
+else
+	redis.call("PERSIST", KEYS[1])
+end
+return 1
+`)
+
+// RedisStore stores each key in its own Redis hash under the Prefix with the data and the version of the record.
+// PutValue is a Lua script which checks the version observed by GetValue and sets the new version, an empty value deletes the hash.
+// Versions are random UUIDs, so that a deleted and re-created record never gets the version observed before the deletion.
+//
+// When LeaseRecordTTL is set, lock lease records expire unless rewritten within the TTL, so that records abandoned
+// by crashed clients are removed by Redis itself. Holders and waiters rewrite the record every few seconds,
+// other records (drains, reservations, etc.) are never expired.
+type RedisStore struct {
+	Client         redis.UniversalClient
+	Prefix         string
+	LeaseRecordTTL time.Duration
+}
+
+type redisValueMetadata struct {
+	Version string
+}
+
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = DefaultRedisKeyPrefix
+	}
+	return &RedisStore{
+		Client: client,
+		Prefix: prefix,
+	}
+}
+
+func (store *RedisStore) StoreId() string {
+	var addrs []string
+	switch client := store.Client.(type) {
+	case *redis.ClusterClient:
+		addrs = client.Options().Addrs
+	case *redis.Client:
+		addrs = []string{fmt.Sprintf("%s/%d", client.Options().Addr, client.Options().DB)}
+	default:
+		addrs = []string{fmt.Sprintf("%T", store.Client)}
+	}
+	return fmt.Sprintf("redis:%s/%s", strings.Join(addrs, ","), store.Prefix)
+}
+
+func (store *RedisStore) GetValue(key string) (*Value, error) {
+	debug("RedisStore.GetValue by key %q", key)
+
+	res, err := store.Client.HMGet(context.Background(), store.redisKey(key), "data", "version").Result()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get redis key %s: %s", store.redisKey(key), err)
+	}
+
+	// Empty version of the missing record makes the put create the record
+	value := &Value{metadata: &redisValueMetadata{}}
+	if data, ok := res[0].(string); ok {
+		version, _ := res[1].(string)
+		value.Data = data
+		value.metadata = &redisValueMetadata{Version: version}
+	}
+
+	debug("RedisStore.GetValue by key %q -> %#v", key, value)
+
+	return value, nil
+}
+
+func (store *RedisStore) PutValue(key string, value *Value) error {
+	debug("RedisStore.PutValue %s %#v", key, value)
+
+	metadata := value.metadata.(*redisValueMetadata)
+
+	var ttl time.Duration
+	if strings.HasPrefix(key, "lockgate.io/") {
+		ttl = store.LeaseRecordTTL
+	}
+
+	put, err := redisPutValueScript.Run(context.Background(), store.Client, []string{store.redisKey(key)}, metadata.Version, value.Data, ttl.Milliseconds(), uuid.NewString()).Int()
+	if err != nil {
+		return fmt.Errorf("cannot put redis key %s: %s", store.redisKey(key), err)
+	}
+	if put == 0 {
+		return ErrRecordVersionChanged
+	}
+	return nil
+}
+
+func (store *RedisStore) ListKeys() ([]string, error) {
+	var keys []string
+
+	scan := func(ctx context.Context, client *redis.Client) error {
+		iter := client.Scan(ctx, 0, store.Prefix+"*", 100).Iterator()
+		for iter.Next(ctx) {
+			keys = append(keys, strings.TrimPrefix(iter.Val(), store.Prefix))
+		}
+		return iter.Err()
+	}
+
+	var err error
+	switch client := store.Client.(type) {
+	case *redis.ClusterClient:
+		// Each master node holds its own part of keys
+		var mux sync.Mutex
+		err = client.ForEachMaster(context.Background(), func(ctx context.Context, client *redis.Client) error {
+			mux.Lock()
+			defer mux.Unlock()
+			return scan(ctx, client)
+		})
+	case *redis.Client:
+		err = scan(context.Background(), client)
+	default:
+		return nil, fmt.Errorf("listing keys is not supported by redis client %T", store.Client)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan redis keys by prefix %s: %s", store.Prefix, err)
+	}
+	return keys, nil
+}
+
+func (store *RedisStore) redisKey(key string) string {
+	return store.Prefix + key
+}
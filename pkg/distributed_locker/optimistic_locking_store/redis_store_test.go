@@ -0,0 +1,82 @@
+package optimistic_locking_store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newMiniredisStore(t *testing.T, prefix string) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewRedisStore(client, prefix), server
+}
+
+func TestRedisStore(t *testing.T) {
+	store, _ := newMiniredisStore(t, "test:")
+	testOptimisticLockingStore(t, store)
+}
+
+func TestRedisStore_LeaseRecordTTL(t *testing.T) {
+	store, server := newMiniredisStore(t, "")
+	store.LeaseRecordTTL = time.Minute
+
+	leaseKey, recordKey := LockLeaseKey("mylock"), "reservations."+LockLeaseKey("mylock")
+	putTestValue(t, store, leaseKey, "lease")
+	putTestValue(t, store, recordKey, "record")
+
+	if ttl := server.TTL(store.redisKey(leaseKey)); ttl != time.Minute {
+		t.Errorf("got TTL %s of the lock lease record, expected %s", ttl, time.Minute)
+	}
+	if ttl := server.TTL(store.redisKey(recordKey)); ttl != 0 {
+		t.Errorf("auxiliary record should not expire, got TTL %s", ttl)
+	}
+
+	// Rewrite of the record prolongs the TTL
+	server.FastForward(40 * time.Second)
+	putTestValue(t, store, leaseKey, "renewed lease")
+	server.FastForward(40 * time.Second)
+	if value := getTestValue(t, store, leaseKey); value.Data != "renewed lease" {
+		t.Errorf("rewritten record should not expire, got %q", value.Data)
+	}
+
+	server.FastForward(time.Minute)
+	if value := getTestValue(t, store, leaseKey); value.Data != "" {
+		t.Errorf("record which has not been rewritten within the TTL should expire, got %q", value.Data)
+	}
+	if value := getTestValue(t, store, recordKey); value.Data != "record" {
+		t.Errorf("got auxiliary record %q, expected %q", value.Data, "record")
+	}
+
+	// Without TTL the lock lease record is persisted
+	store.LeaseRecordTTL = 0
+	putTestValue(t, store, leaseKey, "lease")
+	if ttl := server.TTL(store.redisKey(leaseKey)); ttl != 0 {
+		t.Errorf("got TTL %s of the lock lease record, expected no TTL", ttl)
+	}
+}
+
+func TestRedisStore_ListKeysOfPrefix(t *testing.T) {
+	store, server := newMiniredisStore(t, "test:")
+	putTestValue(t, store, LockLeaseKey("a"), "data")
+
+	// Keys of other prefixes are not listed
+	if err := server.Set("other:"+LockLeaseKey("c"), "data"); err != nil {
+		t.Fatalf("set redis key: %s", err)
+	}
+	putTestValue(t, NewRedisStore(store.Client, "other-store:"), LockLeaseKey("d"), "data")
+
+	keys, err := store.ListKeys()
+	if err != nil {
+		t.Fatalf("list keys: %s", err)
+	}
+	if len(keys) != 1 || keys[0] != LockLeaseKey("a") {
+		t.Errorf("got keys %v, expected [%s]", keys, LockLeaseKey("a"))
+	}
+}
@@ -0,0 +1,205 @@
+package optimistic_locking_store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Lease duration of lockgate leases, used when the holder of the resource lock changes.
+const resourceLockDefaultLeaseDurationSeconds = 10
+
+// ResourceLockStore is backed by an existing client-go resource lock (Lease, ConfigMap, etc.),
+// so that lockgate lockers and client-go leader electors coordinate through one backing resource.
+// The lock lease record of the LockName is mapped to the LeaderElectionRecord: holder id to the holder identity
+// and the expiration time to the renew time plus the lease duration.
+//
+// The resource lock holds a single record, so the store keeps only the lock lease record of the LockName
+// without the queue of waiters, other records are always empty and cannot be put. Shared locks are not supported.
+type ResourceLockStore struct {
+	Lock     resourcelock.Interface
+	LockName string
+
+	mux sync.Mutex
+	// Raw record of the resource lock observed by the last Get or written by the last Update
+	observedRaw []byte
+	// Lease UUIDs of the holder identities written by this store
+	leaseUUIDs map[string]string
+}
+
+type resourceLockValueMetadata struct {
+	record *resourcelock.LeaderElectionRecord
+	raw    []byte
+}
+
+func NewResourceLockStore(lock resourcelock.Interface, lockName string) *ResourceLockStore {
+	return &ResourceLockStore{
+		Lock:       lock,
+		LockName:   lockName,
+		leaseUUIDs: make(map[string]string),
+	}
+}
+
+func (store *ResourceLockStore) StoreId() string {
+	return fmt.Sprintf("resource-lock:%s", store.Lock.Describe())
+}
+
+func (store *ResourceLockStore) GetValue(key string) (*Value, error) {
+	debug("ResourceLockStore.GetValue by key %q", key)
+
+	if key != LockLeaseKey(store.LockName) {
+		// Auxiliary records (drains, reservations, etc.) are never stored
+		return &Value{metadata: &resourceLockValueMetadata{}}, nil
+	}
+
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	record, raw, err := store.Lock.Get(context.Background())
+	if errors.IsNotFound(err) {
+		store.observedRaw = nil
+		return &Value{metadata: &resourceLockValueMetadata{}}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot get resource lock %s: %s", store.Lock.Describe(), err)
+	}
+	store.observedRaw = raw
+
+	value := &Value{metadata: &resourceLockValueMetadata{record: record, raw: raw}}
+	if record.HolderIdentity != "" {
+		lease := &KubernetesLockRecord{
+			UUID:               store.leaseUUID(record),
+			LockName:           store.LockName,
+			HolderId:           record.HolderIdentity,
+			ExpireAtTimestamp:  record.RenewTime.Add(time.Duration(record.LeaseDurationSeconds) * time.Second).Unix(),
+			SharedHoldersCount: 1,
+			QueueMembers:       make(map[string]*KubernetesLockQueueMember),
+		}
+
+		data, err := json.Marshal(lease)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal lease record: %s", err)
+		}
+		value.Data = string(data)
+	}
+
+	debug("ResourceLockStore.GetValue by key %q -> %#v", key, value)
+
+	return value, nil
+}
+
+func (store *ResourceLockStore) PutValue(key string, value *Value) error {
+	debug("ResourceLockStore.PutValue %s %#v", key, value)
+
+	if key != LockLeaseKey(store.LockName) {
+		return fmt.Errorf("resource lock store keeps only the lock lease record of %q, got key %q", store.LockName, key)
+	}
+
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	metadata := value.metadata.(*resourceLockValueMetadata)
+	if !bytes.Equal(metadata.raw, store.observedRaw) {
+		return ErrRecordVersionChanged
+	}
+
+	record, err := store.newRecord(metadata.record, value.Data)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		// Only the queue of waiters has been changed, which is not stored
+		return nil
+	}
+
+	if metadata.record == nil {
+		err = store.Lock.Create(context.Background(), *record)
+	} else {
+		err = store.Lock.Update(context.Background(), *record)
+	}
+	if errors.IsConflict(err) || errors.IsAlreadyExists(err) {
+		return ErrRecordVersionChanged
+	} else if err != nil {
+		return fmt.Errorf("cannot update resource lock %s: %s", store.Lock.Describe(), err)
+	}
+
+	// Following Get will return this record, unless the resource lock has been changed by someone else
+	store.observedRaw = nil
+	return nil
+}
+
+// newRecord returns nil if the resource lock should not be changed.
+func (store *ResourceLockStore) newRecord(current *resourcelock.LeaderElectionRecord, data string) (*resourcelock.LeaderElectionRecord, error) {
+	now := metav1.NewTime(time.Now())
+
+	record := &resourcelock.LeaderElectionRecord{}
+	if current != nil {
+		*record = *current
+	}
+
+	if data == "" {
+		if current == nil || current.HolderIdentity == "" {
+			return nil, nil
+		}
+
+		// Voluntary step down the same way client-go leader elector releases the lock
+		record.HolderIdentity = ""
+		record.LeaseDurationSeconds = 1
+		record.RenewTime = now
+		return record, nil
+	}
+
+	var lease *KubernetesLockRecord
+	if err := json.Unmarshal([]byte(data), &lease); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal lease record: %s", err)
+	}
+	if lease.IsShared {
+		return nil, fmt.Errorf("shared locks are not supported by the resource lock store")
+	}
+	if lease.UUID == "" {
+		// The record of the released lock with the state of the condition variable
+		return nil, fmt.Errorf("condition variables are not supported by the resource lock store")
+	}
+
+	holderIdentity := lease.HolderId
+	if holderIdentity == "" {
+		holderIdentity = lease.UUID
+	}
+	if current != nil && current.HolderIdentity != "" && store.leaseUUID(current) == lease.UUID && lease.ExpireAtTimestamp == current.RenewTime.Add(time.Duration(current.LeaseDurationSeconds)*time.Second).Unix() {
+		return nil, nil
+	}
+
+	if current == nil || store.leaseUUID(current) != lease.UUID {
+		record.HolderIdentity = holderIdentity
+		record.AcquireTime = now
+		record.LeaseDurationSeconds = resourceLockDefaultLeaseDurationSeconds
+		if current != nil {
+			record.LeaderTransitions++
+		}
+		store.leaseUUIDs[holderIdentity] = lease.UUID
+	}
+
+	// Renew time is chosen so that the lease expires at the expiration time of the lock lease record
+	record.RenewTime = metav1.NewTime(time.Unix(lease.ExpireAtTimestamp, 0).Add(-time.Duration(record.LeaseDurationSeconds) * time.Second))
+
+	return record, nil
+}
+
+// leaseUUID returns the UUID of the lease written by this store for the holder identity, the holder identity itself
+// if it is a UUID (lockgate leases of acquirers without id), or the UUID derived from the holder identity and the acquire time.
+func (store *ResourceLockStore) leaseUUID(record *resourcelock.LeaderElectionRecord) string {
+	if leaseUUID, ok := store.leaseUUIDs[record.HolderIdentity]; ok {
+		return leaseUUID
+	}
+	if _, err := uuid.Parse(record.HolderIdentity); err == nil {
+		return record.HolderIdentity
+	}
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%s/%d", record.HolderIdentity, record.AcquireTime.Unix()))).String()
+}
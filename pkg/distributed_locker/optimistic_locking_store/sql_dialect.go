@@ -0,0 +1,54 @@
+package optimistic_locking_store
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// SQLDialect describes the differences between databases used by the SQLStore,
+// queries of the store are otherwise limited to SQL supported by all dialects.
+type SQLDialect interface {
+	Name() string
+	// Placeholder returns the placeholder of the n-th (starting with 1) argument of the query.
+	Placeholder(n int) string
+	// MigrationLockStatement returns the statement which serializes migrations of the table within the transaction,
+	// it is executed first in the transaction of the migration, empty when the database serializes the transactions itself.
+	MigrationLockStatement(table string) string
+}
+
+var (
+	SQLiteDialect   SQLDialect = sqliteDialect{}
+	PostgresDialect SQLDialect = postgresDialect{}
+)
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (sqliteDialect) Placeholder(n int) string {
+	return "?"
+}
+
+// MigrationLockStatement of SQLite is a write which takes the write lock at the start of the transaction like BEGIN IMMEDIATE,
+// otherwise concurrent migrations both read the applied versions and then fail to upgrade the read lock with SQLITE_BUSY.
+func (sqliteDialect) MigrationLockStatement(table string) string {
+	return fmt.Sprintf("DELETE FROM %s_schema_migrations WHERE version IS NULL", table)
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string {
+	return "postgres"
+}
+
+func (postgresDialect) Placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func (postgresDialect) MigrationLockStatement(table string) string {
+	h := fnv.New32a()
+	h.Write([]byte(table))
+	return fmt.Sprintf("SELECT pg_advisory_xact_lock(%d)", h.Sum32())
+}
@@ -0,0 +1,221 @@
+package optimistic_locking_store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const DefaultSQLTable = "locks"
+
+// Schema migrations of the table by version, %[1]s is the name of the table.
+var sqlMigrations = [][]string{
+	{
+		`CREATE TABLE IF NOT EXISTS %[1]s ("key" TEXT PRIMARY KEY, data TEXT NOT NULL, version TEXT NOT NULL, updated_at BIGINT NOT NULL)`,
+		`CREATE INDEX IF NOT EXISTS %[1]s_updated_at ON %[1]s (updated_at)`,
+	},
+}
+
+// SQLStore stores each key in its own row of the Table ("key", data, version) using database/sql,
+// the driver of the database (SQLite, Postgres) is registered by the user of the store.
+// PutValue updates the row only if the version has not been changed since GetValue, an empty value deletes the row.
+// Versions are random UUIDs, so that a deleted and re-created row never gets the version observed before the deletion.
+//
+// The table is created by Migrate, which should be called before the store is used.
+type SQLStore struct {
+	DB      *sql.DB
+	Dialect SQLDialect
+	Table   string
+}
+
+type sqlValueMetadata struct {
+	Version string
+}
+
+func NewSQLStore(db *sql.DB, dialect SQLDialect) *SQLStore {
+	return &SQLStore{
+		DB:      db,
+		Dialect: dialect,
+		Table:   DefaultSQLTable,
+	}
+}
+
+// Migrate applies schema migrations of the table which have not been applied yet,
+// applied versions are kept in the <table>_schema_migrations table.
+func (store *SQLStore) Migrate() error {
+	if _, err := store.DB.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s_schema_migrations (version INTEGER PRIMARY KEY)`, store.Table)); err != nil {
+		return fmt.Errorf("cannot create %s_schema_migrations table: %s", store.Table, err)
+	}
+
+	for i, statements := range sqlMigrations {
+		if err := store.migrate(i+1, statements); err != nil {
+			return fmt.Errorf("cannot migrate %s table to version %d: %s", store.Table, i+1, err)
+		}
+	}
+	return nil
+}
+
+func (store *SQLStore) migrate(version int, statements []string) error {
+	tx, err := store.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if stmt := store.Dialect.MigrationLockStatement(store.Table); stmt != "" {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	var applied int
+	if err := tx.QueryRow(store.query(`SELECT COUNT(*) FROM %s_schema_migrations WHERE version = ?`), version).Scan(&applied); err != nil {
+		return err
+	} else if applied > 0 {
+		return nil
+	}
+
+	debug("SQLStore.Migrate table %s to version %d", store.Table, version)
+
+	for _, stmt := range statements {
+		if _, err := tx.Exec(fmt.Sprintf(stmt, store.Table)); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(store.query(`INSERT INTO %s_schema_migrations (version) VALUES (?) ON CONFLICT (version) DO NOTHING`), version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (store *SQLStore) GetValue(key string) (*Value, error) {
+	debug("SQLStore.GetValue by key %q", key)
+
+	// Empty version of the missing row makes the put insert the row
+	value := &Value{metadata: &sqlValueMetadata{}}
+
+	var data, version string
+	err := store.DB.QueryRow(store.query(`SELECT data, version FROM %s WHERE "key" = ?`), key).Scan(&data, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return value, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot select key %s from %s table: %s", key, store.Table, err)
+	}
+	value.Data = data
+	value.metadata = &sqlValueMetadata{Version: version}
+
+	debug("SQLStore.GetValue by key %q -> %#v", key, value)
+
+	return value, nil
+}
+
+func (store *SQLStore) PutValue(key string, value *Value) error {
+	debug("SQLStore.PutValue %s %#v", key, value)
+
+	metadata := value.metadata.(*sqlValueMetadata)
+	now := time.Now().Unix()
+
+	var res sql.Result
+	var err error
+	switch {
+	case metadata.Version == "" && value.Data == "":
+		return nil
+	case metadata.Version == "":
+		res, err = store.DB.Exec(store.query(`INSERT INTO %s ("key", data, version, updated_at) VALUES (?, ?, ?, ?) ON CONFLICT ("key") DO NOTHING`), key, value.Data, uuid.NewString(), now)
+	case value.Data == "":
+		res, err = store.DB.Exec(store.query(`DELETE FROM %s WHERE "key" = ? AND version = ?`), key, metadata.Version)
+	default:
+		res, err = store.DB.Exec(store.query(`UPDATE %s SET data = ?, version = ?, updated_at = ? WHERE "key" = ? AND version = ?`), value.Data, uuid.NewString(), now, key, metadata.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot put key %s into %s table: %s", key, store.Table, err)
+	}
+
+	if rows, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("cannot put key %s into %s table: %s", key, store.Table, err)
+	} else if rows == 0 {
+		return ErrRecordVersionChanged
+	}
+	return nil
+}
+
+func (store *SQLStore) ListKeys() ([]string, error) {
+	rows, err := store.DB.Query(store.query(`SELECT "key" FROM %s`))
+	if err != nil {
+		return nil, fmt.Errorf("cannot select keys from %s table: %s", store.Table, err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("cannot select keys from %s table: %s", store.Table, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot select keys from %s table: %s", store.Table, err)
+	}
+	return keys, nil
+}
+
+// DeleteStaleLeaseRecords deletes lock lease records which have not been updated for olderThan,
+// returns the number of deleted rows. Holders and waiters rewrite the record every few seconds,
+// so such records are left by crashed clients. Other records (drains, reservations, etc.) are never deleted.
+func (store *SQLStore) DeleteStaleLeaseRecords(olderThan time.Duration) (int, error) {
+	res, err := store.DB.Exec(store.query(`DELETE FROM %s WHERE "key" LIKE 'lockgate.io/%%' AND updated_at < ?`), time.Now().Add(-olderThan).Unix())
+	if err != nil {
+		return 0, fmt.Errorf("cannot delete stale lease records from %s table: %s", store.Table, err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("cannot delete stale lease records from %s table: %s", store.Table, err)
+	}
+	return int(rows), nil
+}
+
+// RunCleanup deletes stale lock lease records every period until the context is done.
+// Cleanup errors are not fatal: the cleanup is retried on the next period.
+func (store *SQLStore) RunCleanup(ctx context.Context, period, olderThan time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		if deleted, err := store.DeleteStaleLeaseRecords(olderThan); err != nil {
+			debug("SQLStore.RunCleanup failed: %s", err)
+		} else {
+			debug("SQLStore.RunCleanup deleted %d stale lease records", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// query formats the query with the table name and replaces "?" with placeholders of the dialect.
+func (store *SQLStore) query(format string) string {
+	query := fmt.Sprintf(format, store.Table)
+
+	var res strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			res.WriteString(store.Dialect.Placeholder(n))
+			continue
+		}
+		res.WriteRune(r)
+	}
+	return res.String()
+}
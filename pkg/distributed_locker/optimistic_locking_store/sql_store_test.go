@@ -0,0 +1,175 @@
+package optimistic_locking_store
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// openSQLiteDB opens the SQLite database file, each call opens its own connection pool like a separate process.
+func openSQLiteDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)", path))
+	if err != nil {
+		t.Fatalf("open sqlite database: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newSQLiteStore(t *testing.T) *SQLStore {
+	t.Helper()
+
+	store := NewSQLStore(openSQLiteDB(t, filepath.Join(t.TempDir(), "locks.db")), SQLiteDialect)
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("migrate: %s", err)
+	}
+	return store
+}
+
+func TestSQLStore(t *testing.T) {
+	testOptimisticLockingStore(t, newSQLiteStore(t))
+}
+
+func TestSQLStore_Migrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locks.db")
+
+	// Processes started at the same time migrate the same database
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		store := NewSQLStore(openSQLiteDB(t, path), SQLiteDialect)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = store.Migrate()
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("concurrent migrate %d: %s", i, err)
+		}
+	}
+
+	store := NewSQLStore(openSQLiteDB(t, path), SQLiteDialect)
+	putTestValue(t, store, LockLeaseKey("mylock"), "data")
+
+	// Migrate of the migrated database does nothing and keeps the data
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("repeated migrate: %s", err)
+	}
+	if value := getTestValue(t, store, LockLeaseKey("mylock")); value.Data != "data" {
+		t.Errorf("got value %q after the repeated migrate, expected %q", value.Data, "data")
+	}
+
+	var versions int
+	if err := store.DB.QueryRow(`SELECT COUNT(*) FROM locks_schema_migrations`).Scan(&versions); err != nil {
+		t.Fatalf("select migrations: %s", err)
+	}
+	if versions != len(sqlMigrations) {
+		t.Errorf("got %d applied migrations, expected %d", versions, len(sqlMigrations))
+	}
+}
+
+func TestSQLStore_DeleteStaleLeaseRecords(t *testing.T) {
+	store := newSQLiteStore(t)
+
+	staleLeaseKey, leaseKey, staleRecordKey := LockLeaseKey("stale"), LockLeaseKey("active"), "reservations."+LockLeaseKey("stale")
+	for _, key := range []string{staleLeaseKey, leaseKey, staleRecordKey} {
+		putTestValue(t, store, key, "data")
+	}
+
+	staleAt := time.Now().Add(-time.Hour).Unix()
+	for _, key := range []string{staleLeaseKey, staleRecordKey} {
+		if _, err := store.DB.Exec(`UPDATE locks SET updated_at = ? WHERE "key" = ?`, staleAt, key); err != nil {
+			t.Fatalf("update row: %s", err)
+		}
+	}
+
+	deleted, err := store.DeleteStaleLeaseRecords(time.Minute)
+	if err != nil {
+		t.Fatalf("delete stale lease records: %s", err)
+	}
+	if deleted != 1 {
+		t.Errorf("got %d deleted records, expected 1", deleted)
+	}
+
+	keys, err := store.ListKeys()
+	if err != nil {
+		t.Fatalf("list keys: %s", err)
+	}
+	sort.Strings(keys)
+	expectedKeys := []string{leaseKey, staleRecordKey}
+	sort.Strings(expectedKeys)
+	if fmt.Sprint(keys) != fmt.Sprint(expectedKeys) {
+		t.Errorf("got keys %v, expected %v", keys, expectedKeys)
+	}
+}
+
+func TestSQLiteDialect_MigrationLockStatement(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locks.db")
+	first, second := NewSQLStore(openSQLiteDB(t, path), SQLiteDialect), NewSQLStore(openSQLiteDB(t, path), SQLiteDialect)
+	if err := first.Migrate(); err != nil {
+		t.Fatalf("migrate: %s", err)
+	}
+
+	firstTx, err := first.DB.Begin()
+	if err != nil {
+		t.Fatalf("begin: %s", err)
+	}
+	defer firstTx.Rollback()
+	if _, err := firstTx.Exec(SQLiteDialect.MigrationLockStatement(first.Table)); err != nil {
+		t.Fatalf("lock: %s", err)
+	}
+
+	// Second migration waits for the first one and then sees the version applied by it
+	lockedChan := make(chan error)
+	go func() {
+		secondTx, err := second.DB.Begin()
+		if err != nil {
+			lockedChan <- err
+			return
+		}
+		defer secondTx.Rollback()
+
+		if _, err := secondTx.Exec(SQLiteDialect.MigrationLockStatement(second.Table)); err != nil {
+			lockedChan <- err
+			return
+		}
+
+		var applied int
+		if err := secondTx.QueryRow(`SELECT COUNT(*) FROM locks_schema_migrations WHERE version = 100`).Scan(&applied); err != nil {
+			lockedChan <- err
+			return
+		} else if applied != 1 {
+			lockedChan <- fmt.Errorf("version applied by the first migration is not seen")
+			return
+		}
+		lockedChan <- nil
+	}()
+
+	select {
+	case err := <-lockedChan:
+		t.Fatalf("second migration should wait for the first one, got %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	if _, err := firstTx.Exec(`INSERT INTO locks_schema_migrations (version) VALUES (100)`); err != nil {
+		t.Fatalf("insert: %s", err)
+	}
+	if err := firstTx.Commit(); err != nil {
+		t.Fatalf("commit: %s", err)
+	}
+
+	if err := <-lockedChan; err != nil {
+		t.Errorf("second migration: %s", err)
+	}
+}
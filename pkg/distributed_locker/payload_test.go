@@ -0,0 +1,83 @@
+package distributed_locker
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/werf/lockgate"
+)
+
+func getTestPayload(t *testing.T, locker *DistributedLocker, lockName string) []byte {
+	t.Helper()
+
+	payload, err := locker.GetPayload(lockName)
+	if err != nil {
+		t.Fatalf("get payload: %s", err)
+	}
+	return payload
+}
+
+func TestPayload_SetByHolder(t *testing.T) {
+	locker, _ := newInMemoryLocker()
+
+	if payload := getTestPayload(t, locker, "mylock"); payload != nil {
+		t.Errorf("got payload %q of the free lock, expected none", payload)
+	}
+
+	handle := acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{})
+	if err := locker.SetPayload(handle, []byte("progress: 50%")); err != nil {
+		t.Fatalf("set payload: %s", err)
+	}
+	if payload := getTestPayload(t, locker, "mylock"); !bytes.Equal(payload, []byte("progress: 50%")) {
+		t.Errorf("got payload %q, expected %q", payload, "progress: 50%")
+	}
+
+	// Payload is kept by the lease renew
+	if err := locker.Backend.RenewLease(handle); err != nil {
+		t.Fatalf("renew lease: %s", err)
+	}
+	if payload := getTestPayload(t, locker, "mylock"); !bytes.Equal(payload, []byte("progress: 50%")) {
+		t.Errorf("got payload %q after renew, expected %q", payload, "progress: 50%")
+	}
+
+	if err := locker.SetPayload(handle, make([]byte, lockgate.MaxLockPayloadSize+1)); err == nil {
+		t.Errorf("got no error for payload above the limit, expected error")
+	}
+
+	// Payload is removed on release and is not inherited by the next holder
+	if err := locker.Release(handle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+	if payload := getTestPayload(t, locker, "mylock"); payload != nil {
+		t.Errorf("got payload %q of the released lock, expected none", payload)
+	}
+
+	handle = acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{})
+	if payload := getTestPayload(t, locker, "mylock"); payload != nil {
+		t.Errorf("got payload %q of the new holder, expected none", payload)
+	}
+	if err := locker.Release(handle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+}
+
+func TestPayload_SetByStaleHolder(t *testing.T) {
+	locker, backend := newInMemoryLocker()
+
+	handle := acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{})
+	changeTestLease(t, backend, "mylock", func(lease *LockLeaseRecord) {
+		lease.ExpireAtTimestamp = 0
+	})
+
+	newHandle := acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{})
+	if err := locker.SetPayload(handle, []byte("stale")); !IsErrLockAlreadyLeased(err) {
+		t.Errorf("got %v, expected %v", err, ErrLockAlreadyLeased)
+	}
+	if payload := getTestPayload(t, locker, "mylock"); payload != nil {
+		t.Errorf("got payload %q set by the stale holder, expected none", payload)
+	}
+
+	if err := locker.Release(newHandle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+}
@@ -0,0 +1,115 @@
+package distributed_locker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/werf/lockgate"
+)
+
+func acquireAnyTestLock(t *testing.T, backend *OptimisticLockingStorageBasedBackend, lockNames []string, acquirerId string) (lockgate.LockHandle, bool) {
+	t.Helper()
+
+	handle, err := backend.AcquireAny(lockNames, AcquireOptions{AcquirerId: acquirerId})
+	if IsErrShouldWait(err) {
+		return lockgate.LockHandle{}, false
+	} else if err != nil {
+		t.Fatalf("acquire any by %q: %s", acquirerId, err)
+	}
+	return handle, true
+}
+
+func TestAcquireAny_PoolQueueFairness(t *testing.T) {
+	_, backend := newInMemoryLocker()
+	pool := []string{"a", "b"}
+
+	first, _ := acquireAnyTestLock(t, backend, pool, "")
+	second, _ := acquireAnyTestLock(t, backend, pool, "")
+
+	// Waiters take places in the queue of the pool in order of arrival
+	for _, acquirerId := range []string{"first-waiter", "second-waiter"} {
+		if _, acquired := acquireAnyTestLock(t, backend, pool, acquirerId); acquired {
+			t.Fatalf("%q should wait for the busy pool", acquirerId)
+		}
+		time.Sleep(1100 * time.Millisecond)
+	}
+
+	if err := backend.Release(first); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+
+	// The only available lock is left for the first waiter
+	if _, acquired := acquireAnyTestLock(t, backend, pool, "second-waiter"); acquired {
+		t.Fatalf("second waiter should not take the lock before the first waiter")
+	}
+
+	handle, acquired := acquireAnyTestLock(t, backend, pool, "first-waiter")
+	if !acquired {
+		t.Fatalf("first waiter should take the available lock")
+	}
+	if handle.LockName != first.LockName {
+		t.Errorf("got lock %q, expected the released lock %q", handle.LockName, first.LockName)
+	}
+	if lease := getTestLease(t, backend, handle.LockName); lease.HolderId != "first-waiter" {
+		t.Errorf("got holder %q, expected the acquirer of the pool %q", lease.HolderId, "first-waiter")
+	} else if len(lease.QueueMembers) != 0 {
+		t.Errorf("waiters of the pool should not wait in the queues of the locks, got %v", lease.QueueMembers)
+	}
+
+	if err := backend.Release(second); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+	if handle, acquired := acquireAnyTestLock(t, backend, pool, "second-waiter"); !acquired {
+		t.Fatalf("second waiter should take the lock released after the first waiter left the queue")
+	} else if handle.LockName != second.LockName {
+		t.Errorf("got lock %q, expected the released lock %q", handle.LockName, second.LockName)
+	}
+}
+
+func TestAcquireAny_DrainedAndReservedLocks(t *testing.T) {
+	_, backend := newInMemoryLocker()
+	pool := []string{"drained", "reserved", "free"}
+
+	if err := backend.SetDrain(NewDrain("drained", "maintenance", time.Time{})); err != nil {
+		t.Fatalf("set drain: %s", err)
+	}
+	if _, err := backend.Reserve("reserved", time.Now().Add(-time.Minute), time.Now().Add(time.Hour), "owner"); err != nil {
+		t.Fatalf("reserve: %s", err)
+	}
+	freeHandle, _ := acquireAnyTestLock(t, backend, []string{"free"}, "")
+
+	for _, acquirerId := range []string{"first-waiter", "second-waiter"} {
+		if _, acquired := acquireAnyTestLock(t, backend, pool, acquirerId); acquired {
+			t.Fatalf("%q should wait for the busy pool", acquirerId)
+		}
+		time.Sleep(1100 * time.Millisecond)
+	}
+
+	// Drained and reserved locks are not counted as available for the queue of the pool
+	if err := backend.Release(freeHandle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+	if _, acquired := acquireAnyTestLock(t, backend, pool, "second-waiter"); acquired {
+		t.Fatalf("second waiter should not take the only available lock before the first waiter")
+	}
+	if handle, acquired := acquireAnyTestLock(t, backend, pool, "first-waiter"); !acquired {
+		t.Fatalf("first waiter should take the available lock")
+	} else if handle.LockName != "free" {
+		t.Errorf("got lock %q, expected %q", handle.LockName, "free")
+	}
+
+	// Owner of the reservation takes the reserved lock as the holder when nobody is ahead in the queue of the pool
+	if err := backend.LeaveQueueAny(pool, "second-waiter"); err != nil {
+		t.Fatalf("leave queue: %s", err)
+	}
+	handle, acquired := acquireAnyTestLock(t, backend, pool, "owner")
+	if !acquired {
+		t.Fatalf("owner of the reservation should take the reserved lock")
+	}
+	if handle.LockName != "reserved" {
+		t.Errorf("got lock %q, expected %q", handle.LockName, "reserved")
+	}
+	if lease := getTestLease(t, backend, "reserved"); lease.HolderId != "owner" {
+		t.Errorf("got holder %q, expected %q", lease.HolderId, "owner")
+	}
+}
@@ -0,0 +1,70 @@
+package distributed_locker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/werf/lockgate"
+)
+
+func TestRenewLease_Revoked(t *testing.T) {
+	locker, backend := newInMemoryLocker()
+
+	handle := acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{Preemptible: true})
+
+	// The grace period of the preempted holder is over
+	changeTestLease(t, backend, "mylock", func(lease *LockLeaseRecord) {
+		lease.PreemptRequestedAtTimestamp = time.Now().Unix() - 60
+		lease.PreemptDeadlineTimestamp = time.Now().Unix() - 1
+	})
+
+	if err := backend.RenewLease(handle); !IsErrLockAlreadyLeased(err) {
+		t.Errorf("got %v, expected %v", err, ErrLockAlreadyLeased)
+	}
+	if info, err := locker.GetLockInfo("mylock"); err != nil {
+		t.Fatalf("get lock info: %s", err)
+	} else if info.Held {
+		t.Errorf("got the revoked lease renewed, expected the lock not held")
+	}
+}
+
+func TestSharedJoin_MergesHolderOptions(t *testing.T) {
+	locker, backend := newInMemoryLocker()
+
+	handle := acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{Shared: true, Preemptible: true, MaxHoldDuration: time.Hour})
+	if lease := getTestLease(t, backend, "mylock"); !lease.Preemptible {
+		t.Fatalf("got lease not preemptible, expected preemptible")
+	}
+
+	// The holder which is not preemptible and has a shorter hold limit joins the lease
+	joinedHandle := acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{Shared: true, MaxHoldDuration: 10 * time.Minute})
+	if joinedHandle.UUID != handle.UUID {
+		t.Fatalf("got lease %q, expected to join the shared lease %q", joinedHandle.UUID, handle.UUID)
+	}
+
+	lease := getTestLease(t, backend, "mylock")
+	if lease.Preemptible {
+		t.Errorf("got lease preemptible, expected not preemptible after a non-preemptible holder joined")
+	}
+	if expected := time.Now().Add(10 * time.Minute).Unix(); lease.HoldDeadlineTimestamp > expected {
+		t.Errorf("got hold deadline %d, expected not later than %d", lease.HoldDeadlineTimestamp, expected)
+	}
+
+	// The lease with a non-preemptible holder is not preempted by a higher priority acquirer
+	acquired, _, err := locker.Acquire("mylock", lockgate.AcquireOptions{AcquirerId: "urgent", Priority: 10, NonBlocking: true})
+	if err != nil {
+		t.Fatalf("acquire: %s", err)
+	} else if acquired {
+		t.Fatalf("got lock acquired, expected shared holders to keep it")
+	}
+	if lease := getTestLease(t, backend, "mylock"); lease.PreemptRequestedAtTimestamp != 0 {
+		t.Errorf("got preemption requested, expected the lease not preempted")
+	}
+
+	// The later hold limit of the joining holder does not extend the deadline
+	deadline := lease.HoldDeadlineTimestamp
+	acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{Shared: true, MaxHoldDuration: 2 * time.Hour})
+	if lease := getTestLease(t, backend, "mylock"); lease.HoldDeadlineTimestamp != deadline {
+		t.Errorf("got hold deadline %d, expected %d", lease.HoldDeadlineTimestamp, deadline)
+	}
+}
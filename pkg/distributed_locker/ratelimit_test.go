@@ -0,0 +1,100 @@
+package distributed_locker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/werf/lockgate/pkg/ratelimit"
+)
+
+func TestRateLimit_TakeRange(t *testing.T) {
+	_, backend := newInMemoryLocker()
+	limit := ratelimit.Limit{Tokens: 10, Period: time.Hour}
+
+	// Up to max tokens are granted while at least min tokens are available
+	if result, err := backend.RateLimitTake("mykey", 2, 8, limit); err != nil {
+		t.Fatalf("take: %s", err)
+	} else if result.Granted != 8 {
+		t.Errorf("got %d tokens granted, expected 8", result.Granted)
+	}
+	if result, err := backend.RateLimitTake("mykey", 1, 5, limit); err != nil {
+		t.Fatalf("take: %s", err)
+	} else if result.Granted != 2 {
+		t.Errorf("got %d tokens granted, expected the remaining 2", result.Granted)
+	}
+
+	// Nothing is taken when min tokens are not available
+	if result, err := backend.RateLimitTake("mykey", 1, 1, limit); err != nil {
+		t.Fatalf("take: %s", err)
+	} else if result.Granted != 0 || result.RetryAfter <= 0 {
+		t.Errorf("got %d tokens granted and retry after %s, expected none granted and positive retry period", result.Granted, result.RetryAfter)
+	}
+
+	// Buckets of other keys are independent
+	if result, err := backend.RateLimitTake("otherkey", 10, 10, limit); err != nil {
+		t.Fatalf("take: %s", err)
+	} else if result.Granted != 10 {
+		t.Errorf("got %d tokens granted by other key, expected 10", result.Granted)
+	}
+
+	if _, err := backend.RateLimitTake("mykey", 2, 1, limit); err == nil {
+		t.Errorf("got no error for bad tokens range, expected error")
+	}
+}
+
+func TestRateLimit_LimitersShareBucket(t *testing.T) {
+	_, backend := newInMemoryLocker()
+	limit := ratelimit.Limit{Tokens: 4, Period: time.Hour}
+
+	// Batches of the first limiter take the whole bucket, the second limiter has nothing left
+	limiter1 := ratelimit.NewLimiter(backend, limit, 4)
+	limiter2 := ratelimit.NewLimiter(backend, limit, 4)
+
+	for i := 0; i < 4; i++ {
+		if allowed, err := limiter1.Allow("mykey", 1); err != nil {
+			t.Fatalf("allow: %s", err)
+		} else if !allowed {
+			t.Fatalf("got token %d denied, expected allowed", i)
+		}
+	}
+
+	if allowed, err := limiter2.Allow("mykey", 1); err != nil {
+		t.Fatalf("allow: %s", err)
+	} else if allowed {
+		t.Errorf("got token allowed by the second limiter, expected the bucket exhausted")
+	}
+	if allowed, err := limiter1.Allow("mykey", 1); err != nil {
+		t.Fatalf("allow: %s", err)
+	} else if allowed {
+		t.Errorf("got token allowed after the batch is exhausted, expected denied")
+	}
+
+	if _, err := limiter1.Allow("mykey", 5); err == nil {
+		t.Errorf("got no error for tokens above the burst, expected error")
+	}
+}
+
+func TestRateLimit_Wait(t *testing.T) {
+	_, backend := newInMemoryLocker()
+	limiter := ratelimit.NewLimiter(backend, ratelimit.Limit{Tokens: 10, Period: time.Second}, 1)
+
+	if err := limiter.Wait(context.Background(), "mykey", 10); err != nil {
+		t.Fatalf("wait: %s", err)
+	}
+
+	// Bucket is refilled at 10 tokens per second
+	startedAt := time.Now()
+	if err := limiter.Wait(context.Background(), "mykey", 5); err != nil {
+		t.Fatalf("wait: %s", err)
+	}
+	if elapsed := time.Since(startedAt); elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("got tokens after %s, expected about 500ms", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, "mykey", 10); err != context.DeadlineExceeded {
+		t.Errorf("got %v, expected %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,35 @@
+package distributed_locker
+
+import (
+	"time"
+)
+
+// ReservationBackend is implemented by backends which allow booking a lock for a time window in advance.
+// During the reserved window the lock is granted only to the acquirer with AcquirerId equal to the reservation owner.
+// The lease held by someone else at the start of the window is not revoked.
+type ReservationBackend interface {
+	Reserve(lockName string, from, to time.Time, owner string) (*Reservation, error)
+	ListReservations(lockName string) ([]*Reservation, error)
+	CancelReservation(lockName, reservationId string) error
+}
+
+type Reservation struct {
+	Id                 string `json:"id"`
+	LockName           string `json:"lockName"`
+	Owner              string `json:"owner"`
+	FromTimestamp      int64  `json:"fromTimestamp"`
+	ToTimestamp        int64  `json:"toTimestamp"`
+	CreatedAtTimestamp int64  `json:"createdAtTimestamp"`
+}
+
+func (reservation *Reservation) IsActive(now time.Time) bool {
+	return !now.Before(time.Unix(reservation.FromTimestamp, 0)) && now.Before(time.Unix(reservation.ToTimestamp, 0))
+}
+
+func (reservation *Reservation) IsOver(now time.Time) bool {
+	return !now.Before(time.Unix(reservation.ToTimestamp, 0))
+}
+
+func (reservation *Reservation) Overlaps(other *Reservation) bool {
+	return reservation.FromTimestamp < other.ToTimestamp && other.FromTimestamp < reservation.ToTimestamp
+}
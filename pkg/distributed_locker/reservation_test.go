@@ -0,0 +1,133 @@
+package distributed_locker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/werf/lockgate"
+)
+
+func TestReserve_Windows(t *testing.T) {
+	_, backend := newInMemoryLocker()
+	now := time.Now()
+
+	if _, err := backend.Reserve("mylock", now, now.Add(time.Hour), ""); err == nil {
+		t.Errorf("got reservation without the owner, expected an error")
+	}
+	if _, err := backend.Reserve("mylock", now.Add(time.Hour), now, "owner"); err == nil {
+		t.Errorf("got reservation with the window ending before the start, expected an error")
+	}
+
+	later, err := backend.Reserve("mylock", now.Add(2*time.Hour), now.Add(3*time.Hour), "later")
+	if err != nil {
+		t.Fatalf("reserve: %s", err)
+	}
+	earlier, err := backend.Reserve("mylock", now.Add(time.Hour), now.Add(2*time.Hour), "earlier")
+	if err != nil {
+		t.Fatalf("reserve the adjacent window: %s", err)
+	}
+	if _, err := backend.Reserve("mylock", now.Add(90*time.Minute), now.Add(150*time.Minute), "overlapping"); err == nil {
+		t.Errorf("got overlapping reservation, expected an error")
+	}
+
+	reservations, err := backend.ListReservations("mylock")
+	if err != nil {
+		t.Fatalf("list reservations: %s", err)
+	}
+	if len(reservations) != 2 || reservations[0].Id != earlier.Id || reservations[1].Id != later.Id {
+		t.Fatalf("got reservations %#v, expected the earlier and the later reservations sorted by the start time", reservations)
+	}
+
+	if err := backend.CancelReservation("mylock", earlier.Id); err != nil {
+		t.Fatalf("cancel reservation: %s", err)
+	}
+	if err := backend.CancelReservation("mylock", earlier.Id); err == nil {
+		t.Errorf("got the cancelled reservation cancelled again, expected not found error")
+	}
+	if reservations, err := backend.ListReservations("mylock"); err != nil {
+		t.Fatalf("list reservations: %s", err)
+	} else if len(reservations) != 1 || reservations[0].Id != later.Id {
+		t.Errorf("got reservations %#v, expected the later reservation only", reservations)
+	}
+
+	// The record is removed with the last reservation
+	if err := backend.CancelReservation("mylock", later.Id); err != nil {
+		t.Fatalf("cancel reservation: %s", err)
+	}
+	if value, err := backend.Store.GetValue(backend.reservationsKeyName("mylock")); err != nil {
+		t.Fatalf("get value: %s", err)
+	} else if value.Data != "" {
+		t.Errorf("got reservations record %q, expected the record removed", value.Data)
+	}
+}
+
+func TestReserve_OverReservationsAreDropped(t *testing.T) {
+	_, backend := newInMemoryLocker()
+
+	over, err := backend.Reserve("mylock", time.Now().Add(-time.Hour), time.Now().Add(time.Hour), "owner")
+	if err != nil {
+		t.Fatalf("reserve: %s", err)
+	}
+	if err := backend.changeReservations("mylock", func(record *ReservationsRecord) (bool, error) {
+		record.Reservations[0].ToTimestamp = time.Now().Unix() - 1
+		return true, nil
+	}); err != nil {
+		t.Fatalf("change reservations: %s", err)
+	}
+
+	if reservations, err := backend.ListReservations("mylock"); err != nil {
+		t.Fatalf("list reservations: %s", err)
+	} else if len(reservations) != 0 {
+		t.Errorf("got reservations %#v, expected the reservation which is over not listed", reservations)
+	}
+
+	// The window of the reservation which is over can be booked again
+	if _, err := backend.Reserve("mylock", time.Unix(over.FromTimestamp, 0), time.Now().Add(time.Hour), "other"); err != nil {
+		t.Errorf("reserve: %s", err)
+	}
+}
+
+func TestAcquire_Reserved(t *testing.T) {
+	locker, backend := newInMemoryLocker()
+
+	// The reservation in the future does not prevent acquiring the lock
+	reservation, err := backend.Reserve("mylock", time.Now().Add(time.Hour), time.Now().Add(2*time.Hour), "owner")
+	if err != nil {
+		t.Fatalf("reserve: %s", err)
+	}
+	handle := acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{AcquirerId: "other"})
+	if err := locker.Release(handle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+
+	if err := backend.CancelReservation("mylock", reservation.Id); err != nil {
+		t.Fatalf("cancel reservation: %s", err)
+	}
+	active, err := backend.Reserve("mylock", time.Now().Add(-time.Minute), time.Now().Add(time.Hour), "owner")
+	if err != nil {
+		t.Fatalf("reserve: %s", err)
+	}
+
+	if _, _, err := locker.Acquire("mylock", lockgate.AcquireOptions{AcquirerId: "other"}); err != lockgate.ErrLockReserved {
+		t.Errorf("got %v, expected %v", err, lockgate.ErrLockReserved)
+	}
+	if acquired, _, err := locker.Acquire("mylock", lockgate.AcquireOptions{AcquirerId: "other", WaitIfReserved: true, NonBlocking: true}); err != nil || acquired {
+		t.Errorf("got acquired=%v err=%v, expected the reserved lock not acquired", acquired, err)
+	}
+
+	// The lease held at the start of the window is not revoked, the owner waits for the release
+	if err := backend.CancelReservation("mylock", active.Id); err != nil {
+		t.Fatalf("cancel reservation: %s", err)
+	}
+	handle = acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{AcquirerId: "other"})
+	if _, err := backend.Reserve("mylock", time.Now().Add(-time.Minute), time.Now().Add(time.Hour), "owner"); err != nil {
+		t.Fatalf("reserve: %s", err)
+	}
+	if acquired, _, err := locker.Acquire("mylock", lockgate.AcquireOptions{AcquirerId: "owner", NonBlocking: true}); err != nil || acquired {
+		t.Errorf("got acquired=%v err=%v, expected the owner to wait for the release", acquired, err)
+	}
+	if err := locker.Release(handle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+	acquireTestLock(t, locker, "mylock", lockgate.AcquireOptions{AcquirerId: "owner"})
+}
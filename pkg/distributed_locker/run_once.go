@@ -0,0 +1,153 @@
+package distributed_locker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/werf/lockgate"
+)
+
+type RunOnceBackend interface {
+	GetRunOnceResult(key string) (*RunOnceResult, error)
+	// ClaimRunOnce returns the stored result or claims the result record for the holder of the lock lease,
+	// PutRunOnceResult stores the result only when the record is still claimed by the same lease.
+	ClaimRunOnce(key string, handle lockgate.LockHandle) (*RunOnceResult, error)
+	PutRunOnceResult(key string, handle lockgate.LockHandle, result *RunOnceResult) error
+}
+
+type RunOnceResult struct {
+	Data              []byte `json:"data,omitempty"`
+	Err               string `json:"err,omitempty"`
+	ExpireAtTimestamp int64  `json:"expireAtTimestamp"`
+
+	// HolderUUID is the lease UUID of the lock holder which claimed the record, the record without
+	// the result is Pending while the function is running.
+	HolderUUID string `json:"holderUUID,omitempty"`
+	Pending    bool   `json:"pending,omitempty"`
+}
+
+type RunOnceOptions struct {
+	// ResultRetention is the period the successful result is stored and returned to callers without running the function again,
+	// the retention should be positive.
+	ResultRetention time.Duration
+	// ErrorRetention is the period the error of the function is stored, by default the error is returned
+	// only to the callers waiting for the result at the moment.
+	ErrorRetention time.Duration
+}
+
+// RunOnce runs the function only in one of the processes calling RunOnce with the same key, other callers
+// wait for the result of the function. The function runs while holding the exclusive lock lease: when the lease
+// is lost the result is not stored and the function is run again by one of the waiting callers.
+// The result is retained for the ttl period.
+func (l *DistributedLocker) RunOnce(key string, ttl time.Duration, f func() ([]byte, error)) ([]byte, error) {
+	return l.RunOnceWithOptions(key, RunOnceOptions{ResultRetention: ttl}, f)
+}
+
+func (l *DistributedLocker) RunOnceWithOptions(key string, opts RunOnceOptions, f func() ([]byte, error)) ([]byte, error) {
+	backend, ok := l.Backend.(RunOnceBackend)
+	if !ok {
+		return nil, fmt.Errorf("backend %T does not support run once", l.Backend)
+	}
+
+	if opts.ResultRetention <= 0 {
+		return nil, fmt.Errorf("run once %q result retention should be positive, got %s", key, opts.ResultRetention)
+	}
+
+	if opts.ErrorRetention == 0 {
+		opts.ErrorRetention = 2 * DistributedLockPollRetryPeriodSeconds * time.Second
+	}
+
+	lockName := fmt.Sprintf("lockgate.io/run-once/%s", key)
+
+	for {
+		if result, err := backend.GetRunOnceResult(key); err != nil {
+			return nil, err
+		} else if result != nil {
+			debug("(run once %q) got stored result", key)
+			return result.Data, result.GetError()
+		}
+
+		var leaseLostMux sync.Mutex
+		var isLeaseLost bool
+
+		acquired, handle, err := l.Acquire(lockName, lockgate.AcquireOptions{
+			NonBlocking: true,
+			OnLostLeaseFunc: func(lock lockgate.LockHandle) error {
+				leaseLostMux.Lock()
+				defer leaseLostMux.Unlock()
+				isLeaseLost = true
+				return nil
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if !acquired {
+			debug("(run once %q) poll result: will retry in %d seconds", key, DistributedLockPollRetryPeriodSeconds)
+			time.Sleep(DistributedLockPollRetryPeriodSeconds * time.Second)
+			continue
+		}
+
+		data, runErr, err := l.runOnceHoldingLock(backend, key, handle, opts, f, func() bool {
+			leaseLostMux.Lock()
+			defer leaseLostMux.Unlock()
+			return isLeaseLost
+		})
+		if err != nil {
+			return nil, err
+		}
+		return data, runErr
+	}
+}
+
+func (l *DistributedLocker) runOnceHoldingLock(backend RunOnceBackend, key string, handle lockgate.LockHandle, opts RunOnceOptions, f func() ([]byte, error), isLeaseLost func() bool) ([]byte, error, error) {
+	// Result could be stored between the result check and the lock acquire
+	if result, err := backend.ClaimRunOnce(key, handle); err != nil {
+		return nil, nil, l.releaseRunOnceLock(handle, err)
+	} else if result != nil {
+		return result.Data, result.GetError(), l.releaseRunOnceLock(handle, nil)
+	}
+
+	debug("(run once %q) run function", key)
+	data, runErr := f()
+
+	if isLeaseLost() {
+		debug("(run once %q) lease lost, result will not be stored", key)
+		return data, runErr, nil
+	}
+
+	result := &RunOnceResult{Data: data}
+	retention := opts.ResultRetention
+	if runErr != nil {
+		result.Data = nil
+		result.Err = runErr.Error()
+		retention = opts.ErrorRetention
+	}
+	result.ExpireAtTimestamp = time.Now().Add(retention).Unix()
+
+	if err := backend.PutRunOnceResult(key, handle, result); IsErrLockAlreadyLeased(err) || IsErrNoExistingLockLeaseFound(err) {
+		debug("(run once %q) lease lost, result has not been stored", key)
+		return data, runErr, nil
+	} else if err != nil {
+		return nil, nil, l.releaseRunOnceLock(handle, err)
+	}
+
+	return data, runErr, l.releaseRunOnceLock(handle, nil)
+}
+
+func (l *DistributedLocker) releaseRunOnceLock(handle lockgate.LockHandle, resErr error) error {
+	if err := l.Release(handle); err != nil && resErr == nil {
+		return err
+	}
+	return resErr
+}
+
+func (result *RunOnceResult) GetError() error {
+	if result.Err == "" {
+		return nil
+	}
+	return errors.New(result.Err)
+}
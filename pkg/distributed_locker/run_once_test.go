@@ -0,0 +1,63 @@
+package distributed_locker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunOnce_StoredResult(t *testing.T) {
+	locker, _ := newInMemoryLocker()
+
+	var runs int
+	f := func() ([]byte, error) {
+		runs++
+		return []byte("result"), nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if data, err := locker.RunOnce("mykey", time.Hour, f); err != nil {
+			t.Fatalf("run once: %s", err)
+		} else if string(data) != "result" {
+			t.Errorf("got %q, expected %q", data, "result")
+		}
+	}
+	if runs != 1 {
+		t.Errorf("got %d runs, expected 1", runs)
+	}
+}
+
+func TestRunOnce_ZeroRetention(t *testing.T) {
+	locker, _ := newInMemoryLocker()
+
+	if _, err := locker.RunOnce("mykey", 0, func() ([]byte, error) { return nil, nil }); err == nil {
+		t.Errorf("got no error, expected error for zero result retention")
+	}
+}
+
+func TestRunOnce_ExpiredResultRemoved(t *testing.T) {
+	locker, backend := newInMemoryLocker()
+
+	if _, err := locker.RunOnce("mykey", time.Second, func() ([]byte, error) { return []byte("result"), nil }); err != nil {
+		t.Fatalf("run once: %s", err)
+	}
+
+	storeKeyName := backend.recordKeyName("run-once", "mykey")
+	if value, err := backend.Store.GetValue(storeKeyName); err != nil {
+		t.Fatalf("get value: %s", err)
+	} else if value.Data == "" {
+		t.Fatalf("got no result record, expected stored result")
+	}
+
+	time.Sleep(2 * time.Second)
+
+	if result, err := backend.GetRunOnceResult("mykey"); err != nil {
+		t.Fatalf("get run once result: %s", err)
+	} else if result != nil {
+		t.Errorf("got result %#v, expected expired result to be ignored", result)
+	}
+	if value, err := backend.Store.GetValue(storeKeyName); err != nil {
+		t.Fatalf("get value: %s", err)
+	} else if value.Data != "" {
+		t.Errorf("got result record %s, expected expired record removed", value.Data)
+	}
+}
@@ -0,0 +1,37 @@
+package distributed_locker
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultSweepOlderThan is the default time since the expiration after which a lock lease is considered stale.
+const DefaultSweepOlderThan = 10 * time.Minute
+
+// SweepBackend is implemented by backends which are able to remove records left by crashed clients.
+type SweepBackend interface {
+	// SweepExpiredLeases removes lock lease records expired more than olderThan ago and having no queue members,
+	// returns the number of removed records.
+	SweepExpiredLeases(olderThan time.Duration) (int, error)
+}
+
+// RunSweeper sweeps expired lock leases every period until the context is done.
+// Sweep errors are not fatal: the sweep is retried on the next period.
+func RunSweeper(ctx context.Context, backend SweepBackend, period, olderThan time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		if swept, err := backend.SweepExpiredLeases(olderThan); err != nil {
+			debug("(sweeper) unable to sweep expired leases: %s", err)
+		} else {
+			debug("(sweeper) swept %d expired leases", swept)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
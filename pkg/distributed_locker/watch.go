@@ -0,0 +1,17 @@
+package distributed_locker
+
+import (
+	"github.com/werf/lockgate"
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+)
+
+// LockWatcherBackend is implemented by backends which are able to notify waiters about changes of the lock,
+// so that the lock is acquired right after the release instead of the next poll.
+type LockWatcherBackend interface {
+	// AcquireObserved is Acquire which also returns the lock lease record read by the attempt to watch the lock since the read.
+	AcquireObserved(lockName string, opts AcquireOptions) (lockgate.LockHandle, *optimistic_locking_store.Value, error)
+	// WatchLock returns the channel which is closed when the lock is released or taken by another holder since
+	// the observed record has been read, or when stopChan is closed. Changes of the waiters queue are not reported.
+	// Nil channel is returned when changes cannot be watched.
+	WatchLock(lockName string, observedValue *optimistic_locking_store.Value, stopChan <-chan struct{}) <-chan struct{}
+}
@@ -0,0 +1,44 @@
+package file_locker
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/flock"
+)
+
+// The counter of fencing tokens is kept in the file next to the lock file and survives the release of the lock.
+// The counter file is locked only for the increment, so that shared holders of the lock get distinct tokens too.
+func (l *FileLocker) nextFencingToken(lockName string) (int64, error) {
+	path := l.fencingPath(lockName)
+
+	fileLock := flock.New(path)
+	if err := fileLock.Lock(); err != nil {
+		return 0, fmt.Errorf("unable to lock fencing token file %s: %s", path, err)
+	}
+	defer fileLock.Unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read fencing token file %s: %s", path, err)
+	}
+
+	var token int64
+	if str := strings.TrimSpace(string(data)); str != "" {
+		if token, err = strconv.ParseInt(str, 10, 64); err != nil {
+			return 0, fmt.Errorf("unable to parse fencing token file %s: %s", path, err)
+		}
+	}
+	token++
+
+	if err := os.WriteFile(path, []byte(strconv.FormatInt(token, 10)), 0o644); err != nil {
+		return 0, fmt.Errorf("unable to write fencing token file %s: %s", path, err)
+	}
+	return token, nil
+}
+
+func (l *FileLocker) fencingPath(lockName string) string {
+	return fmt.Sprintf("%s.fencing", l.lockFilePath(lockName))
+}
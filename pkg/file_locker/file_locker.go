@@ -3,7 +3,9 @@ package file_locker
 import (
 	"fmt"
 	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -11,11 +13,14 @@ import (
 	"github.com/werf/lockgate/pkg/file_lock"
 )
 
+const LockPollPeriod = 500 * time.Millisecond
+
 type FileLocker struct {
 	LocksDir string
 
-	mux   sync.Mutex
-	locks map[string]file_lock.LockObject
+	mux         sync.Mutex
+	locks       map[string]file_lock.LockObject
+	sharedLocks map[string]bool
 }
 
 func NewFileLocker(locksDir string) (*FileLocker, error) {
@@ -24,8 +29,9 @@ func NewFileLocker(locksDir string) (*FileLocker, error) {
 	}
 
 	return &FileLocker{
-		LocksDir: locksDir,
-		locks:    make(map[string]file_lock.LockObject),
+		LocksDir:    locksDir,
+		locks:       make(map[string]file_lock.LockObject),
+		sharedLocks: make(map[string]bool),
 	}, nil
 }
 
@@ -47,6 +53,7 @@ func (l *FileLocker) getAndRemoveLock(lockHandle lockgate.LockHandle) file_lock.
 
 	if lock, hasKey := l.locks[lockHandle.UUID]; hasKey {
 		delete(l.locks, lockHandle.UUID)
+		delete(l.sharedLocks, lockHandle.UUID)
 		return lock
 	}
 
@@ -70,16 +77,179 @@ func (l *FileLocker) Acquire(lockName string, opts lockgate.AcquireOptions) (boo
 
 	if opts.NonBlocking {
 		acquired, err := lock.TryLock(opts.Shared)
+		if err != nil || !acquired {
+			l.getAndRemoveLock(lockHandle)
+			return acquired, lockHandle, err
+		}
+
+		blocked, err := l.isBlockedByHandoff(lockName, lockHandle.UUID, opts.Shared)
+		if err != nil || blocked {
+			l.getAndRemoveLock(lockHandle)
+			if unlockErr := lock.Unlock(); unlockErr != nil {
+				return false, lockHandle, unlockErr
+			}
+			return false, lockHandle, err
+		}
+
+		err = l.onAcquired(&lockHandle, opts)
+		return true, lockHandle, err
+	}
+
+	startedAcquireAt := time.Now()
+	for {
+		timeout := opts.Timeout
+		if timeout != 0 {
+			timeout = opts.Timeout - time.Since(startedAcquireAt)
+			if timeout <= 0 {
+				return true, lockHandle, fmt.Errorf("lock %q timeout %s expired", lockName, opts.Timeout)
+			}
+		}
+
+		if err := lock.Lock(timeout, opts.Shared, wrappedOnWaitFunc); err != nil {
+			return true, lockHandle, err
+		}
+
+		// The lock file could be held by another process during handoff, see Export and Adopt
+		if blocked, err := l.isBlockedByHandoff(lockName, lockHandle.UUID, opts.Shared); err != nil {
+			return true, lockHandle, err
+		} else if !blocked {
+			err := l.onAcquired(&lockHandle, opts)
+			return true, lockHandle, err
+		}
+
+		if err := lock.Unlock(); err != nil {
+			return true, lockHandle, err
+		}
+		time.Sleep(LockPollPeriod)
+	}
+}
+
+// AcquireAny polls the lock files of the pool one by one until some lock is acquired.
+// There is no fairness between processes waiting for the pool with the file locker.
+func (l *FileLocker) AcquireAny(lockNames []string, opts lockgate.AcquireOptions) (bool, lockgate.LockHandle, error) {
+	if len(lockNames) == 0 {
+		return false, lockgate.LockHandle{}, fmt.Errorf("no lock names specified")
+	}
+
+	tryOpts := opts
+	tryOpts.NonBlocking = true
+	tryAcquireAny := func() (bool, lockgate.LockHandle, error) {
+		for _, lockName := range lockNames {
+			if acquired, lockHandle, err := l.Acquire(lockName, tryOpts); err != nil || acquired {
+				return acquired, lockHandle, err
+			}
+		}
+		return false, lockgate.LockHandle{}, nil
+	}
+
+	if acquired, lockHandle, err := tryAcquireAny(); err != nil || acquired || opts.NonBlocking {
 		return acquired, lockHandle, err
+	}
+
+	var acquired bool
+	var lockHandle lockgate.LockHandle
+	pollLocks := func() error {
+		startedAcquireAt := time.Now()
+		for {
+			time.Sleep(LockPollPeriod)
+
+			var err error
+			if acquired, lockHandle, err = tryAcquireAny(); err != nil || acquired {
+				return err
+			}
+
+			if opts.Timeout != 0 && time.Since(startedAcquireAt) > opts.Timeout {
+				return fmt.Errorf("locks %v timeout %s expired", lockNames, opts.Timeout)
+			}
+		}
+	}
+
+	var err error
+	if opts.OnWaitFunc != nil {
+		err = opts.OnWaitFunc(strings.Join(lockNames, ","), pollLocks)
 	} else {
-		return true, lockHandle, lock.Lock(opts.Timeout, opts.Shared, wrappedOnWaitFunc)
+		err = pollLocks()
+	}
+	return acquired, lockHandle, err
+}
+
+// AcquireAsync polls the lock file in the background, OnWaitFunc is not called by the pending acquire.
+func (l *FileLocker) AcquireAsync(lockName string, opts lockgate.AcquireOptions) *lockgate.PendingAcquire {
+	return lockgate.NewPendingAcquire(func(cancelChan <-chan struct{}) (bool, lockgate.LockHandle, error) {
+		tryOpts := opts
+		tryOpts.NonBlocking = true
+
+		var timeoutChan <-chan time.Time
+		if opts.Timeout != 0 {
+			timer := time.NewTimer(opts.Timeout)
+			defer timer.Stop()
+			timeoutChan = timer.C
+		}
+
+		for {
+			if acquired, lockHandle, err := l.Acquire(lockName, tryOpts); err != nil || acquired || opts.NonBlocking {
+				return acquired, lockHandle, err
+			}
+
+			select {
+			case <-time.After(LockPollPeriod):
+			case <-timeoutChan:
+				return false, lockgate.LockHandle{}, fmt.Errorf("lock %q timeout %s expired", lockName, opts.Timeout)
+			case <-cancelChan:
+				return false, lockgate.LockHandle{}, lockgate.ErrAcquireCanceled
+			}
+		}
+	}, l.Release)
+}
+
+// onAcquired sets the fencing token of the acquired lock into the handle.
+func (l *FileLocker) onAcquired(lockHandle *lockgate.LockHandle, opts lockgate.AcquireOptions) error {
+	fencingToken, err := l.nextFencingToken(lockHandle.LockName)
+	if err != nil {
+		return err
+	}
+	lockHandle.FencingToken = fencingToken
+
+	l.setShared(*lockHandle, opts.Shared)
+
+	if !opts.Shared {
+		if err := l.removePayload(lockHandle.LockName, ""); err != nil {
+			return err
+		}
+		if err := l.removeStaleHolders(*lockHandle); err != nil {
+			return err
+		}
 	}
+
+	return l.writeHolder(*lockHandle, opts.AcquirerId, opts.Shared)
+}
+
+func (l *FileLocker) setShared(lockHandle lockgate.LockHandle, shared bool) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.sharedLocks[lockHandle.UUID] = shared
 }
 
 func (l *FileLocker) Release(lockHandle lockgate.LockHandle) error {
 	if lock := l.getAndRemoveLock(lockHandle); lock == nil {
 		return fmt.Errorf("unknown id %q for lock %q", lockHandle.UUID, lockHandle.LockName)
 	} else {
+		if err := l.removeHolderFile(lockHandle.LockName, lockHandle.UUID); err != nil {
+			return err
+		}
+		if err := l.removePayload(lockHandle.LockName, lockHandle.UUID); err != nil {
+			return err
+		}
+		// The lock may have been exported without Detach
+		if err := l.removeHandoffMarker(lockHandle.LockName, lockHandle.UUID); err != nil {
+			return err
+		}
 		return lock.Unlock()
 	}
 }
+
+func (l *FileLocker) lockFilePath(lockName string) string {
+	lock := file_lock.FileLock{BaseLock: file_lock.BaseLock{Name: lockName}, LocksDir: l.LocksDir}
+	return lock.LockFilePath()
+}
@@ -0,0 +1,147 @@
+package file_locker
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/werf/lockgate"
+)
+
+func TestFileLocker_FencingToken(t *testing.T) {
+	locksDir := t.TempDir()
+
+	locker, err := NewFileLocker(locksDir)
+	if err != nil {
+		t.Fatalf("new file locker: %s", err)
+	}
+
+	var prevToken int64
+	for i := 0; i < 3; i++ {
+		acquired, handle, err := locker.Acquire("mylock", lockgate.AcquireOptions{NonBlocking: i%2 == 0})
+		if err != nil || !acquired {
+			t.Fatalf("acquire: acquired=%v err=%v", acquired, err)
+		}
+		if handle.FencingToken <= prevToken {
+			t.Errorf("got fencing token %d, expected greater than %d", handle.FencingToken, prevToken)
+		}
+		prevToken = handle.FencingToken
+
+		if err := locker.Release(handle); err != nil {
+			t.Fatalf("release: %s", err)
+		}
+	}
+
+	// Counter is kept next to the lock file, so that another process continues the sequence
+	otherLocker, err := NewFileLocker(locksDir)
+	if err != nil {
+		t.Fatalf("new file locker: %s", err)
+	}
+	acquired, handle, err := otherLocker.Acquire("mylock", lockgate.AcquireOptions{})
+	if err != nil || !acquired {
+		t.Fatalf("acquire: acquired=%v err=%v", acquired, err)
+	}
+	if handle.FencingToken <= prevToken {
+		t.Errorf("got fencing token %d in another locker, expected greater than %d", handle.FencingToken, prevToken)
+	}
+
+	// Token is passed with the handoff
+	token, err := otherLocker.Export(handle)
+	if err != nil {
+		t.Fatalf("export: %s", err)
+	}
+	if err := otherLocker.Detach(handle); err != nil {
+		t.Fatalf("detach: %s", err)
+	}
+	adoptedHandle, err := locker.Adopt(token, lockgate.AcquireOptions{})
+	if err != nil {
+		t.Fatalf("adopt: %s", err)
+	}
+	if adoptedHandle.FencingToken != handle.FencingToken {
+		t.Errorf("got fencing token %d of the adopted lock, expected %d", adoptedHandle.FencingToken, handle.FencingToken)
+	}
+	if err := locker.Release(adoptedHandle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+}
+
+func TestFileLocker_GetLockInfo(t *testing.T) {
+	locker, err := NewFileLocker(t.TempDir())
+	if err != nil {
+		t.Fatalf("new file locker: %s", err)
+	}
+
+	assertLockInfo := func(held, shared bool, holderId string) {
+		t.Helper()
+
+		info, err := locker.GetLockInfo("mylock")
+		if err != nil {
+			t.Fatalf("get lock info: %s", err)
+		}
+		if info.Held != held || info.Shared != shared || info.HolderId != holderId {
+			t.Errorf("got held=%v shared=%v holder %q, expected held=%v shared=%v holder %q", info.Held, info.Shared, info.HolderId, held, shared, holderId)
+		}
+	}
+
+	assertLockInfo(false, false, "")
+
+	_, handle, err := locker.Acquire("mylock", lockgate.AcquireOptions{AcquirerId: "holder-1"})
+	if err != nil {
+		t.Fatalf("acquire: %s", err)
+	}
+	assertLockInfo(true, false, "holder-1")
+
+	// Inspection does not take the lock file, so the holder can still release the lock
+	if err := locker.Release(handle); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+	assertLockInfo(false, false, "")
+
+	_, handle1, err := locker.Acquire("mylock", lockgate.AcquireOptions{Shared: true})
+	if err != nil {
+		t.Fatalf("acquire: %s", err)
+	}
+	_, handle2, err := locker.Acquire("mylock", lockgate.AcquireOptions{Shared: true})
+	if err != nil {
+		t.Fatalf("acquire: %s", err)
+	}
+	assertLockInfo(true, true, "")
+
+	if err := locker.Release(handle1); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+	assertLockInfo(true, true, "")
+	if err := locker.Release(handle2); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+	assertLockInfo(false, false, "")
+}
+
+func TestFileLocker_GetLockInfoStaleHolder(t *testing.T) {
+	locker, err := NewFileLocker(t.TempDir())
+	if err != nil {
+		t.Fatalf("new file locker: %s", err)
+	}
+
+	// Holder file left by a crashed process, the pid is above the default pid_max of Linux
+	hostname, _ := os.Hostname()
+	data, err := json.Marshal(holderRecord{UUID: "crashed", HolderId: "crashed-holder", PID: 1<<22 + 1, Hostname: hostname})
+	if err != nil {
+		t.Fatalf("marshal: %s", err)
+	}
+	path := locker.holderPath("mylock", "crashed")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("write holder file: %s", err)
+	}
+
+	info, err := locker.GetLockInfo("mylock")
+	if err != nil {
+		t.Fatalf("get lock info: %s", err)
+	}
+	if info.Held {
+		t.Errorf("got lock held by %q, expected stale holder to be ignored", info.HolderId)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("got stale holder file %s kept, expected removed", path)
+	}
+}
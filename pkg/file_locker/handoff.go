@@ -0,0 +1,207 @@
+package file_locker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/werf/lockgate"
+)
+
+const HandoffMarkerTTLSeconds = 60
+
+// Lock file is released between Detach and Adopt calls, so the handoff marker file
+// is created next to the lock file to prevent other processes from taking the lock meanwhile.
+type handoffMarker struct {
+	UUID              string `json:"uuid"`
+	Shared            bool   `json:"shared"`
+	ExpireAtTimestamp int64  `json:"expireAtTimestamp"`
+}
+
+func (l *FileLocker) BackendId() string {
+	if locksDir, err := filepath.Abs(l.LocksDir); err == nil {
+		return fmt.Sprintf("file:%s", locksDir)
+	}
+	return fmt.Sprintf("file:%s", l.LocksDir)
+}
+
+// Export serializes an acquired lock handle into a token, which can be passed to another process.
+// The lock is reserved for the token owner for HandoffMarkerTTLSeconds after the Detach call.
+func (l *FileLocker) Export(lockHandle lockgate.LockHandle) (string, error) {
+	l.mux.Lock()
+	_, hasKey := l.locks[lockHandle.UUID]
+	shared := l.sharedLocks[lockHandle.UUID]
+	l.mux.Unlock()
+
+	if !hasKey {
+		return "", fmt.Errorf("unknown id %q for lock %q", lockHandle.UUID, lockHandle.LockName)
+	}
+
+	marker := handoffMarker{
+		UUID:              lockHandle.UUID,
+		Shared:            shared,
+		ExpireAtTimestamp: time.Now().Unix() + HandoffMarkerTTLSeconds,
+	}
+	if err := l.writeHandoffMarker(lockHandle.LockName, marker); err != nil {
+		return "", err
+	}
+
+	return lockgate.EncodeLockHandleToken(lockgate.LockHandleToken{
+		Backend:      l.BackendId(),
+		LockName:     lockHandle.LockName,
+		UUID:         lockHandle.UUID,
+		Shared:       shared,
+		TTLSeconds:   HandoffMarkerTTLSeconds,
+		FencingToken: lockHandle.FencingToken,
+	})
+}
+
+// Detach releases the lock file in the current process, the lock stays reserved by the handoff marker
+// created by Export until the token is adopted by another process or the marker expires.
+func (l *FileLocker) Detach(lockHandle lockgate.LockHandle) error {
+	if marker, err := l.readHandoffMarker(lockHandle.LockName, lockHandle.UUID); err != nil {
+		return err
+	} else if marker == nil {
+		return fmt.Errorf("lock %q with id %q should be exported before detach", lockHandle.LockName, lockHandle.UUID)
+	}
+
+	if lock := l.getAndRemoveLock(lockHandle); lock == nil {
+		return fmt.Errorf("unknown id %q for lock %q", lockHandle.UUID, lockHandle.LockName)
+	} else {
+		return lock.Unlock()
+	}
+}
+
+// Adopt re-acquires the lock file and checks that the lock is still reserved for the token owner.
+func (l *FileLocker) Adopt(token string, opts lockgate.AcquireOptions) (lockgate.LockHandle, error) {
+	handleToken, err := lockgate.DecodeLockHandleToken(token)
+	if err != nil {
+		return lockgate.LockHandle{}, err
+	}
+
+	if backendId := l.BackendId(); handleToken.Backend != backendId {
+		return lockgate.LockHandle{}, fmt.Errorf("lock handle token for lock %q belongs to the backend %q, expected %q", handleToken.LockName, handleToken.Backend, backendId)
+	}
+
+	lockHandle := handleToken.LockHandle()
+	lock := l.newLock(lockHandle)
+
+	var wrappedOnWaitFunc func(doWait func() error) error
+	if opts.OnWaitFunc != nil {
+		wrappedOnWaitFunc = func(doWait func() error) error {
+			return opts.OnWaitFunc(lockHandle.LockName, doWait)
+		}
+	}
+
+	if err := lock.Lock(opts.Timeout, handleToken.Shared, wrappedOnWaitFunc); err != nil {
+		l.getAndRemoveLock(lockHandle)
+		return lockgate.LockHandle{}, err
+	}
+
+	marker, err := l.readHandoffMarker(lockHandle.LockName, lockHandle.UUID)
+	if err != nil || marker == nil {
+		l.getAndRemoveLock(lockHandle)
+		if unlockErr := lock.Unlock(); unlockErr != nil {
+			return lockgate.LockHandle{}, unlockErr
+		}
+
+		if err != nil {
+			return lockgate.LockHandle{}, err
+		}
+		return lockgate.LockHandle{}, fmt.Errorf("unable to adopt lock %q with id %q: handoff marker expired or not found", lockHandle.LockName, lockHandle.UUID)
+	}
+
+	if err := l.removeHandoffMarker(lockHandle.LockName, lockHandle.UUID); err != nil {
+		return lockgate.LockHandle{}, err
+	}
+
+	// The holder file of the detached process is taken over by the current process
+	holderId := opts.AcquirerId
+	if holder, err := l.readHolder(lockHandle.LockName, lockHandle.UUID); err != nil {
+		return lockgate.LockHandle{}, err
+	} else if holder != nil && holderId == "" {
+		holderId = holder.HolderId
+	}
+	if err := l.writeHolder(lockHandle, holderId, handleToken.Shared); err != nil {
+		return lockgate.LockHandle{}, err
+	}
+
+	l.setShared(lockHandle, handleToken.Shared)
+	return lockHandle, nil
+}
+
+func (l *FileLocker) isBlockedByHandoff(lockName, uuid string, shared bool) (bool, error) {
+	paths, err := filepath.Glob(l.handoffMarkerPath(lockName, "*"))
+	if err != nil {
+		return false, fmt.Errorf("unable to list handoff markers of lock %q: %s", lockName, err)
+	}
+
+	for _, path := range paths {
+		marker, err := readHandoffMarkerFile(path)
+		if err != nil {
+			return false, err
+		} else if marker == nil || marker.UUID == uuid {
+			continue
+		} else if shared && marker.Shared {
+			continue
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (l *FileLocker) handoffMarkerPath(lockName, uuid string) string {
+	return fmt.Sprintf("%s.handoff-%s", l.lockFilePath(lockName), uuid)
+}
+
+func (l *FileLocker) readHandoffMarker(lockName, uuid string) (*handoffMarker, error) {
+	return readHandoffMarkerFile(l.handoffMarkerPath(lockName, uuid))
+}
+
+func (l *FileLocker) writeHandoffMarker(lockName string, marker handoffMarker) error {
+	path := l.handoffMarkerPath(lockName, marker.UUID)
+
+	data, err := json.Marshal(marker)
+	if err != nil {
+		return fmt.Errorf("unable to marshal handoff marker: %s", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("unable to write handoff marker %s: %s", path, err)
+	}
+	return nil
+}
+
+func (l *FileLocker) removeHandoffMarker(lockName, uuid string) error {
+	if err := os.Remove(l.handoffMarkerPath(lockName, uuid)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove handoff marker of lock %q: %s", lockName, err)
+	}
+	return nil
+}
+
+// readHandoffMarkerFile returns nil marker when the marker does not exist, expired markers are removed.
+func readHandoffMarkerFile(path string) (*handoffMarker, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read handoff marker %s: %s", path, err)
+	}
+
+	var marker *handoffMarker
+	if err := json.Unmarshal(data, &marker); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal handoff marker %s: %s", path, err)
+	}
+
+	if time.Now().After(time.Unix(marker.ExpireAtTimestamp, 0)) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("unable to remove expired handoff marker %s: %s", path, err)
+		}
+		return nil, nil
+	}
+
+	return marker, nil
+}
@@ -0,0 +1,159 @@
+package file_locker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+
+	"github.com/werf/lockgate"
+)
+
+// The holder file is created next to the lock file by each holder of the lock and removed on release,
+// so that the state of the lock is inspected without locking the lock file. Holder files of crashed processes
+// are detected by the process id and removed on inspection and by the next exclusive holder of the lock.
+type holderRecord struct {
+	UUID     string `json:"uuid"`
+	HolderId string `json:"holderId,omitempty"`
+	Shared   bool   `json:"shared,omitempty"`
+	PID      int    `json:"pid"`
+	Hostname string `json:"hostname"`
+}
+
+// GetLockInfo reads the holder files of the lock, the lock file itself is never locked by the inspection.
+func (l *FileLocker) GetLockInfo(lockName string) (*lockgate.LockInfo, error) {
+	info := &lockgate.LockInfo{LockName: lockName}
+
+	holders, err := l.readHolders(lockName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, holder := range holders {
+		if !holder.isAlive() {
+			if err := l.removeHolderFile(lockName, holder.UUID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		info.Held = true
+		info.Shared = holder.Shared
+		if !holder.Shared {
+			info.HolderId = holder.HolderId
+		}
+	}
+
+	return info, nil
+}
+
+func (l *FileLocker) holderPath(lockName, uuid string) string {
+	return fmt.Sprintf("%s.holder-%s", l.lockFilePath(lockName), uuid)
+}
+
+func (l *FileLocker) readHolders(lockName string) ([]*holderRecord, error) {
+	paths, err := filepath.Glob(l.holderPath(lockName, "*"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list holder files of lock %q: %s", lockName, err)
+	}
+
+	var holders []*holderRecord
+	for _, path := range paths {
+		if holder, err := readHolderFile(path); err != nil {
+			return nil, err
+		} else if holder != nil {
+			holders = append(holders, holder)
+		}
+	}
+	return holders, nil
+}
+
+func (l *FileLocker) readHolder(lockName, uuid string) (*holderRecord, error) {
+	return readHolderFile(l.holderPath(lockName, uuid))
+}
+
+func readHolderFile(path string) (*holderRecord, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read holder file %s: %s", path, err)
+	}
+
+	var holder *holderRecord
+	if err := json.Unmarshal(data, &holder); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal holder file %s: %s", path, err)
+	}
+	return holder, nil
+}
+
+func (l *FileLocker) writeHolder(lockHandle lockgate.LockHandle, holderId string, shared bool) error {
+	path := l.holderPath(lockHandle.LockName, lockHandle.UUID)
+
+	hostname, _ := os.Hostname()
+	data, err := json.Marshal(holderRecord{
+		UUID:     lockHandle.UUID,
+		HolderId: holderId,
+		Shared:   shared,
+		PID:      os.Getpid(),
+		Hostname: hostname,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to marshal holder record: %s", err)
+	}
+
+	// Readers should never observe a partially written holder file
+	tmpPath := fmt.Sprintf("%s.tmp", path)
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("unable to write holder file %s: %s", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("unable to rename %s to %s: %s", tmpPath, path, err)
+	}
+	return nil
+}
+
+// removeStaleHolders removes holder files of other holders, the caller holds the lock file exclusively.
+func (l *FileLocker) removeStaleHolders(lockHandle lockgate.LockHandle) error {
+	holders, err := l.readHolders(lockHandle.LockName)
+	if err != nil {
+		return err
+	}
+
+	for _, holder := range holders {
+		if holder.UUID != lockHandle.UUID {
+			if err := l.removeHolderFile(lockHandle.LockName, holder.UUID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *FileLocker) removeHolderFile(lockName, uuid string) error {
+	if err := os.Remove(l.holderPath(lockName, uuid)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove holder file %s: %s", l.holderPath(lockName, uuid), err)
+	}
+	return nil
+}
+
+// isAlive returns false when the process of the holder is gone, holders of other hosts sharing the locks dir are always alive.
+func (holder *holderRecord) isAlive() bool {
+	if hostname, _ := os.Hostname(); holder.Hostname != hostname || holder.PID == 0 {
+		return true
+	}
+
+	process, err := os.FindProcess(holder.PID)
+	if err != nil {
+		return false
+	}
+	// The process is found only when it exists on Windows, other systems check it with the signal 0
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
@@ -0,0 +1,95 @@
+package file_locker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/werf/lockgate"
+)
+
+// The payload file is created next to the lock file by the lock holder.
+// Stale payload of the crashed holder is removed by the next exclusive holder of the lock.
+type payloadRecord struct {
+	UUID    string `json:"uuid"`
+	Payload []byte `json:"payload"`
+}
+
+// SetPayload writes the payload of the lock held by the handle into the sidecar file, readable by anyone with GetPayload.
+func (l *FileLocker) SetPayload(lockHandle lockgate.LockHandle, payload []byte) error {
+	if err := lockgate.ValidateLockPayload(payload); err != nil {
+		return err
+	}
+
+	l.mux.Lock()
+	_, hasKey := l.locks[lockHandle.UUID]
+	l.mux.Unlock()
+
+	if !hasKey {
+		return fmt.Errorf("unknown id %q for lock %q", lockHandle.UUID, lockHandle.LockName)
+	}
+
+	path := l.payloadPath(lockHandle.LockName)
+
+	data, err := json.Marshal(payloadRecord{UUID: lockHandle.UUID, Payload: payload})
+	if err != nil {
+		return fmt.Errorf("unable to marshal payload record: %s", err)
+	}
+
+	// Readers should never observe a partially written payload file
+	tmpPath := fmt.Sprintf("%s.tmp-%s", path, lockHandle.UUID)
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("unable to write payload file %s: %s", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("unable to rename %s to %s: %s", tmpPath, path, err)
+	}
+	return nil
+}
+
+func (l *FileLocker) GetPayload(lockName string) ([]byte, error) {
+	if record, err := l.readPayload(lockName); err != nil {
+		return nil, err
+	} else if record != nil {
+		return record.Payload, nil
+	}
+	return nil, nil
+}
+
+func (l *FileLocker) payloadPath(lockName string) string {
+	return fmt.Sprintf("%s.payload", l.lockFilePath(lockName))
+}
+
+func (l *FileLocker) readPayload(lockName string) (*payloadRecord, error) {
+	path := l.payloadPath(lockName)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read payload file %s: %s", path, err)
+	}
+
+	var record *payloadRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal payload file %s: %s", path, err)
+	}
+	return record, nil
+}
+
+// removePayload removes the payload file, when uuid is specified only the payload written by this holder is removed.
+func (l *FileLocker) removePayload(lockName, uuid string) error {
+	if uuid != "" {
+		if record, err := l.readPayload(lockName); err != nil {
+			return err
+		} else if record == nil || record.UUID != uuid {
+			return nil
+		}
+	}
+
+	if err := os.Remove(l.payloadPath(lockName)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove payload file %s: %s", l.payloadPath(lockName), err)
+	}
+	return nil
+}
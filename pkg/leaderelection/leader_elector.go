@@ -0,0 +1,219 @@
+package leaderelection
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/werf/lockgate"
+)
+
+const DefaultRetryPeriod = 2 * time.Second
+
+// LeaderElector elects a single active instance among the processes using the same lock.
+// The identity of the leader is stored as the holder id of the lock.
+type LeaderElector struct {
+	Locker   lockgate.Locker
+	LockName string
+	Opts     LeaderElectorOptions
+
+	mux          sync.Mutex
+	handle       *lockgate.LockHandle
+	leaderCancel context.CancelFunc
+	// lostLeaseUUID is the lease lost before the acquire of the campaign has returned the handle
+	lostLeaseUUID string
+}
+
+type LeaderElectorOptions struct {
+	// OnStartedLeading is called in a separate goroutine, the context is canceled when the leadership is lost.
+	OnStartedLeading func(ctx context.Context)
+	// OnStoppedLeading is called after Resign or when the lease of the leader is lost.
+	OnStoppedLeading func()
+	RetryPeriod      time.Duration
+}
+
+func NewLeaderElector(locker lockgate.Locker, lockName string, opts LeaderElectorOptions) *LeaderElector {
+	if opts.RetryPeriod == 0 {
+		opts.RetryPeriod = DefaultRetryPeriod
+	}
+
+	return &LeaderElector{
+		Locker:   locker,
+		LockName: lockName,
+		Opts:     opts,
+	}
+}
+
+// Campaign blocks until the identity is elected as the leader or ctx is done.
+func (elector *LeaderElector) Campaign(ctx context.Context, identity string) error {
+	if elector.IsLeader() {
+		return fmt.Errorf("already leading by the lock %q", elector.LockName)
+	}
+
+	for {
+		handle, err := elector.acquire(ctx, lockgate.AcquireOptions{
+			AcquirerId:      identity,
+			OnLostLeaseFunc: elector.onLostLease,
+		})
+		if err != nil {
+			return err
+		}
+
+		elector.mux.Lock()
+		if elector.lostLeaseUUID == handle.UUID {
+			elector.lostLeaseUUID = ""
+			elector.mux.Unlock()
+
+			debug("(campaign %q) lease uuid=%s lost before election, retrying", elector.LockName, handle.UUID)
+			continue
+		}
+		elector.lostLeaseUUID = ""
+
+		leaderCtx, leaderCancel := context.WithCancel(context.Background())
+		elector.handle = &handle
+		elector.leaderCancel = leaderCancel
+		elector.mux.Unlock()
+
+		debug("(campaign %q) %q elected as the leader", elector.LockName, identity)
+
+		if elector.Opts.OnStartedLeading != nil {
+			go elector.Opts.OnStartedLeading(leaderCtx)
+		}
+
+		return nil
+	}
+}
+
+// Resign gives up the leadership, does nothing when not leading.
+func (elector *LeaderElector) Resign() error {
+	handle := elector.stopLeading(nil)
+	if handle == nil {
+		return nil
+	}
+	debug("(resign %q) uuid=%s", elector.LockName, handle.UUID)
+
+	return elector.Locker.Release(*handle)
+}
+
+func (elector *LeaderElector) IsLeader() bool {
+	elector.mux.Lock()
+	defer elector.mux.Unlock()
+
+	return elector.handle != nil
+}
+
+// Observe streams the identity of the current leader into the channel when the leader changes,
+// empty identity means there is no leader. The channel is closed when ctx is done.
+// The locker should implement lockgate.LockInspector interface.
+func (elector *LeaderElector) Observe(ctx context.Context) (<-chan string, error) {
+	inspector, ok := elector.Locker.(lockgate.LockInspector)
+	if !ok {
+		return nil, fmt.Errorf("locker %T does not support lock inspection", elector.Locker)
+	}
+
+	leaderChan := make(chan string)
+	go func() {
+		defer close(leaderChan)
+
+		ticker := time.NewTicker(elector.Opts.RetryPeriod)
+		defer ticker.Stop()
+
+		isFirst := true
+		var lastLeader string
+
+		for {
+			if info, err := inspector.GetLockInfo(elector.LockName); err != nil {
+				debug("(observe %q) unable to get lock info: %s", elector.LockName, err)
+			} else if leader := info.HolderId; isFirst || leader != lastLeader {
+				select {
+				case leaderChan <- leader:
+					isFirst = false
+					lastLeader = leader
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return leaderChan, nil
+}
+
+func (elector *LeaderElector) acquire(ctx context.Context, opts lockgate.AcquireOptions) (lockgate.LockHandle, error) {
+	if asyncLocker, ok := elector.Locker.(lockgate.AsyncLocker); ok {
+		pending := asyncLocker.AcquireAsync(elector.LockName, opts)
+
+		select {
+		case <-pending.Done():
+			return pending.Result()
+		case <-ctx.Done():
+			pending.Cancel()
+			if handle, err := pending.Result(); err == nil {
+				if err := elector.Locker.Release(handle); err != nil {
+					return lockgate.LockHandle{}, err
+				}
+			}
+			return lockgate.LockHandle{}, ctx.Err()
+		}
+	}
+
+	opts.NonBlocking = true
+	for {
+		if acquired, handle, err := elector.Locker.Acquire(elector.LockName, opts); err != nil {
+			return lockgate.LockHandle{}, err
+		} else if acquired {
+			return handle, nil
+		}
+
+		select {
+		case <-time.After(elector.Opts.RetryPeriod):
+		case <-ctx.Done():
+			return lockgate.LockHandle{}, ctx.Err()
+		}
+	}
+}
+
+func (elector *LeaderElector) onLostLease(handle lockgate.LockHandle) error {
+	debug("(lost lease %q) uuid=%s", handle.LockName, handle.UUID)
+
+	// The lease may be lost before Campaign has stored the handle, Campaign checks the lost lease then
+	elector.mux.Lock()
+	if elector.handle == nil {
+		elector.lostLeaseUUID = handle.UUID
+		elector.mux.Unlock()
+		return nil
+	}
+	elector.mux.Unlock()
+
+	elector.stopLeading(&handle)
+	return nil
+}
+
+// stopLeading resets the leader state and returns the handle of the lock held by the leader.
+// When expectedHandle is specified the state is reset only if the leader holds the same lock.
+func (elector *LeaderElector) stopLeading(expectedHandle *lockgate.LockHandle) *lockgate.LockHandle {
+	elector.mux.Lock()
+	handle := elector.handle
+	leaderCancel := elector.leaderCancel
+	if handle == nil || (expectedHandle != nil && handle.UUID != expectedHandle.UUID) {
+		elector.mux.Unlock()
+		return nil
+	}
+	elector.handle = nil
+	elector.leaderCancel = nil
+	elector.mux.Unlock()
+
+	leaderCancel()
+	if elector.Opts.OnStoppedLeading != nil {
+		elector.Opts.OnStoppedLeading()
+	}
+
+	return handle
+}
@@ -0,0 +1,58 @@
+package leaderelection
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/werf/lockgate"
+)
+
+// lostLeaseLocker loses the lease of the first acquisitions before the acquire returns.
+type lostLeaseLocker struct {
+	acquisitions int
+	lostLeases   int
+}
+
+func (locker *lostLeaseLocker) Acquire(lockName string, opts lockgate.AcquireOptions) (bool, lockgate.LockHandle, error) {
+	locker.acquisitions++
+	handle := lockgate.LockHandle{UUID: fmt.Sprintf("uuid-%d", locker.acquisitions), LockName: lockName}
+
+	if locker.acquisitions <= locker.lostLeases {
+		if err := opts.OnLostLeaseFunc(handle); err != nil {
+			return false, lockgate.LockHandle{}, err
+		}
+	}
+	return true, handle, nil
+}
+
+func (locker *lostLeaseLocker) Release(lockgate.LockHandle) error {
+	return nil
+}
+
+func TestLeaderElector_LeaseLostBeforeCampaignReturns(t *testing.T) {
+	locker := &lostLeaseLocker{lostLeases: 2}
+	elector := NewLeaderElector(locker, "leader", LeaderElectorOptions{RetryPeriod: time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := elector.Campaign(ctx, "me"); err != nil {
+		t.Fatalf("campaign: %s", err)
+	}
+	if !elector.IsLeader() {
+		t.Fatalf("got not leading, expected leading")
+	}
+	if locker.acquisitions != 3 {
+		t.Errorf("got %d acquisitions, expected the campaign to retry after each lost lease", locker.acquisitions)
+	}
+
+	// The lease of the current leader is lost after the election
+	if err := elector.onLostLease(lockgate.LockHandle{UUID: "uuid-3", LockName: "leader"}); err != nil {
+		t.Fatalf("on lost lease: %s", err)
+	}
+	if elector.IsLeader() {
+		t.Errorf("got leading after the lease was lost, expected not leading")
+	}
+}
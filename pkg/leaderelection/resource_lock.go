@@ -0,0 +1,213 @@
+package leaderelection
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/werf/lockgate/pkg/distributed_locker"
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+)
+
+// ResourceLock implements client-go resourcelock.Interface on top of the lockgate optimistic locking store,
+// so that client-go leader electors and lockgate lockers using the same store and lock name exclude each other.
+// The LeaderElectionRecord is stored as the lock lease record of the lock: the holder identity is the holder id
+// of the lease, the lease expires after the renew time plus the lease duration, and the record itself is kept
+// in the lease payload.
+type ResourceLock struct {
+	Store      optimistic_locking_store.OptimisticLockingStore
+	LockName   string
+	LockConfig resourcelock.ResourceLockConfig
+	// EventObject is the object events are recorded about when LockConfig.EventRecorder is set.
+	EventObject runtime.Object
+
+	mux sync.Mutex
+	// Lock lease record value observed by the last Get, Create or Update
+	observed *optimistic_locking_store.Value
+}
+
+func NewResourceLock(store optimistic_locking_store.OptimisticLockingStore, lockName string, lockConfig resourcelock.ResourceLockConfig) *ResourceLock {
+	return &ResourceLock{
+		Store:      store,
+		LockName:   lockName,
+		LockConfig: lockConfig,
+	}
+}
+
+// NewLockerResourceLock creates the resource lock using the store of the locker, the locker should use
+// the OptimisticLockingStorageBasedBackend.
+func NewLockerResourceLock(locker *distributed_locker.DistributedLocker, lockName string, lockConfig resourcelock.ResourceLockConfig) (*ResourceLock, error) {
+	backend, ok := locker.Backend.(*distributed_locker.OptimisticLockingStorageBasedBackend)
+	if !ok {
+		return nil, fmt.Errorf("locker backend %T is not based on the optimistic locking store", locker.Backend)
+	}
+	return NewResourceLock(backend.Store, lockName, lockConfig), nil
+}
+
+func (lock *ResourceLock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	lock.mux.Lock()
+	defer lock.mux.Unlock()
+
+	value, lease, err := lock.getLease()
+	if err != nil {
+		return nil, nil, err
+	}
+	lock.observed = value
+
+	if lease == nil {
+		return nil, nil, errors.NewNotFound(schema.GroupResource{Group: "lockgate.io", Resource: "locks"}, lock.LockName)
+	}
+
+	record := leaseToLeaderElectionRecord(lease)
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to marshal leader election record: %s", err)
+	}
+	return record, raw, nil
+}
+
+func (lock *ResourceLock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	lock.mux.Lock()
+	defer lock.mux.Unlock()
+
+	value, lease, err := lock.getLease()
+	if err != nil {
+		return err
+	}
+	if lease != nil && lease.IsActive(time.Now()) {
+		return fmt.Errorf("lock %q is already held by %s", lock.LockName, leaseHolderIdentity(lease))
+	}
+
+	return lock.putLease(value, lease, ler)
+}
+
+func (lock *ResourceLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	lock.mux.Lock()
+	defer lock.mux.Unlock()
+
+	if lock.observed == nil {
+		return fmt.Errorf("lock %q not initialized, call get or create first", lock.LockName)
+	}
+
+	lease, err := distributed_locker.ExtractLockLeaseFromStoreValue(lock.observed)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal lock %q lease record: %s", lock.LockName, err)
+	}
+
+	return lock.putLease(lock.observed, lease, ler)
+}
+
+func (lock *ResourceLock) RecordEvent(s string) {
+	if lock.LockConfig.EventRecorder == nil || lock.EventObject == nil {
+		debug("ResourceLock %s: %s %s", lock.Describe(), lock.LockConfig.Identity, s)
+		return
+	}
+	lock.LockConfig.EventRecorder.Eventf(lock.EventObject, "Normal", "LeaderElection", "%s %s", lock.LockConfig.Identity, s)
+}
+
+func (lock *ResourceLock) Identity() string {
+	return lock.LockConfig.Identity
+}
+
+func (lock *ResourceLock) Describe() string {
+	if identifier, ok := lock.Store.(optimistic_locking_store.StoreIdentifier); ok {
+		return fmt.Sprintf("%s/%s", identifier.StoreId(), lock.LockName)
+	}
+	return lock.LockName
+}
+
+func (lock *ResourceLock) getLease() (*optimistic_locking_store.Value, *distributed_locker.LockLeaseRecord, error) {
+	key := optimistic_locking_store.LockLeaseKey(lock.LockName)
+
+	value, err := lock.Store.GetValue(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get store value by key %s: %s", key, err)
+	}
+	lease, err := distributed_locker.ExtractLockLeaseFromStoreValue(value)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to unmarshal lock %q lease record: %s", lock.LockName, err)
+	}
+	return value, lease, nil
+}
+
+// putLease writes the record into the lease observed in the value, the lease gets a new UUID when the holder changes.
+// Fails when the lease has been changed since the value was read.
+func (lock *ResourceLock) putLease(value *optimistic_locking_store.Value, lease *distributed_locker.LockLeaseRecord, ler resourcelock.LeaderElectionRecord) error {
+	key := optimistic_locking_store.LockLeaseKey(lock.LockName)
+	expireAt := ler.RenewTime.Add(time.Duration(ler.LeaseDurationSeconds) * time.Second)
+
+	if lease == nil || lease.HolderId != ler.HolderIdentity {
+		newLease := distributed_locker.NewLockLeaseRecord(lock.LockName, false)
+		if lease != nil {
+			// Keep the place of lockgate acquirers in the queue
+			newLease.QueueMembers = lease.QueueMembers
+		}
+		lease = newLease
+		lease.HolderId = ler.HolderIdentity
+	}
+
+	if ler.HolderIdentity == "" {
+		// Voluntary step down, the lease expires immediately
+		expireAt = time.Now().Add(-time.Second)
+	}
+	lease.ExpireAtTimestamp = expireAt.Unix()
+
+	payload, err := json.Marshal(ler)
+	if err != nil {
+		return fmt.Errorf("unable to marshal leader election record: %s", err)
+	}
+	lease.Payload = payload
+
+	distributed_locker.SetLockLeaseIntoStoreValue(lease, value)
+
+	if err := lock.Store.PutValue(key, value); optimistic_locking_store.IsErrRecordVersionChanged(err) {
+		return errors.NewConflict(schema.GroupResource{Group: "lockgate.io", Resource: "locks"}, lock.LockName, err)
+	} else if err != nil {
+		return fmt.Errorf("unable to put store value by key %s: %s", key, err)
+	}
+
+	// Next Update requires a fresh value
+	lock.observed = nil
+	if value, err := lock.Store.GetValue(key); err == nil {
+		lock.observed = value
+	}
+
+	return nil
+}
+
+// leaseToLeaderElectionRecord returns the record stored in the lease payload by the ResourceLock,
+// or the record built from the lease of a lockgate holder.
+func leaseToLeaderElectionRecord(lease *distributed_locker.LockLeaseRecord) *resourcelock.LeaderElectionRecord {
+	var record resourcelock.LeaderElectionRecord
+	if err := json.Unmarshal(lease.Payload, &record); err == nil && record.HolderIdentity == lease.HolderId && record.HolderIdentity != "" {
+		return &record
+	}
+
+	renewTime := metav1.NewTime(time.Unix(lease.ExpireAtTimestamp-distributed_locker.DistributedLockLeaseTTLSeconds, 0))
+	record = resourcelock.LeaderElectionRecord{
+		HolderIdentity:       leaseHolderIdentity(lease),
+		LeaseDurationSeconds: distributed_locker.DistributedLockLeaseTTLSeconds,
+		AcquireTime:          renewTime,
+		RenewTime:            renewTime,
+	}
+	if !lease.IsActive(time.Now()) {
+		// Expired lease may be taken over right away
+		record.HolderIdentity = ""
+	}
+	return &record
+}
+
+func leaseHolderIdentity(lease *distributed_locker.LockLeaseRecord) string {
+	if lease.HolderId != "" {
+		return lease.HolderId
+	}
+	return lease.UUID
+}
@@ -0,0 +1,50 @@
+package lock_controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var EventGVR = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "events"}
+
+// emitEvent creates a core/v1 Event about the Lock object, so that it is shown by "kubectl describe lock".
+// The reason is a part of the event name, because events of the same sync are emitted at the same time.
+func (controller *LockController) emitEvent(obj *unstructured.Unstructured, eventType, reason, message string, now time.Time) error {
+	timestamp := now.UTC().Format(time.RFC3339)
+
+	event := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Event",
+		"metadata": map[string]interface{}{
+			"name":      fmt.Sprintf("%s.%x.%s", obj.GetName(), now.UnixNano(), strings.ToLower(reason)),
+			"namespace": obj.GetNamespace(),
+		},
+		"involvedObject": map[string]interface{}{
+			"apiVersion":      obj.GetAPIVersion(),
+			"kind":            obj.GetKind(),
+			"name":            obj.GetName(),
+			"namespace":       obj.GetNamespace(),
+			"uid":             string(obj.GetUID()),
+			"resourceVersion": obj.GetResourceVersion(),
+		},
+		"type":               eventType,
+		"reason":             reason,
+		"message":            message,
+		"source":             map[string]interface{}{"component": controller.Component},
+		"reportingComponent": controller.Component,
+		"firstTimestamp":     timestamp,
+		"lastTimestamp":      timestamp,
+		"count":              int64(1),
+	}}
+
+	debug("(lock controller) lock %s event %s: %s", obj.GetName(), reason, message)
+
+	_, err := controller.KubernetesInterface.Resource(EventGVR).Namespace(obj.GetNamespace()).Create(context.Background(), event, metav1.CreateOptions{})
+	return err
+}
@@ -0,0 +1,319 @@
+package lock_controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/werf/lockgate/pkg/distributed_locker"
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+)
+
+const (
+	DefaultSyncPeriod = 5 * time.Second
+	DefaultComponent  = "lockgate-lock-controller"
+
+	ConditionHeld      = "Held"
+	ConditionContended = "Contended"
+
+	ReasonAcquired  = "Acquired"
+	ReasonReleased  = "Released"
+	ReasonLeaseLost = "LeaseLost"
+)
+
+// LockController watches Lock objects of the KubernetesLockStore: expires leases which have not been renewed in time,
+// updates conditions in the status of Locks and emits Kubernetes Events on acquire, release and lost lease.
+type LockController struct {
+	KubernetesInterface dynamic.Interface
+	Namespace           string
+	// Component is reported as the source of the events.
+	Component string
+}
+
+func NewLockController(kubernetesInterface dynamic.Interface, namespace string) *LockController {
+	return &LockController{
+		KubernetesInterface: kubernetesInterface,
+		Namespace:           namespace,
+		Component:           DefaultComponent,
+	}
+}
+
+// Run syncs all Locks every period until the context is done.
+// Sync errors are not fatal: the sync is retried on the next period.
+func (controller *LockController) Run(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		if err := controller.SyncOnce(); err != nil {
+			debug("(lock controller) sync failed: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyncOnce syncs all Locks in the namespace, a failed Lock does not prevent syncing other Locks.
+func (controller *LockController) SyncOnce() error {
+	list, err := controller.locks().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("cannot list locks in namespace %s: %s", controller.Namespace, err)
+	}
+
+	var lastErr error
+	for i := range list.Items {
+		obj := &list.Items[i]
+		if kind := obj.GetLabels()[optimistic_locking_store.KubernetesLockRecordKindLabel]; kind != "" && kind != "lock" {
+			continue
+		}
+
+		if err := controller.SyncLock(obj); err != nil {
+			debug("(lock controller) sync of lock %s failed: %s", obj.GetName(), err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// SyncLock expires the lease of the Lock if needed, then updates the status of the Lock and emits events
+// about changes since the previous sync.
+func (controller *LockController) SyncLock(obj *unstructured.Unstructured) error {
+	now := time.Now()
+	key := obj.GetAnnotations()[optimistic_locking_store.KubernetesLeaseKeyAnnotation]
+
+	lease, err := extractLease(obj)
+	if err != nil {
+		return err
+	}
+
+	// Lease observed as expired, the record may be removed from the store by the controller
+	var expiredLease *distributed_locker.LockLeaseRecord
+
+	if lease != nil && isLeaseExpired(obj, lease, now) && key != "" {
+		expiredLease = lease
+		if err := controller.expireLease(key, lease, now); err != nil {
+			return fmt.Errorf("unable to expire lease %s: %s", lease.UUID, err)
+		}
+
+		name := obj.GetName()
+		if obj, err = controller.locks().Get(context.Background(), name, metav1.GetOptions{}); errors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("cannot get lock %s/%s: %s", controller.Namespace, name, err)
+		}
+		if lease, err = extractLease(obj); err != nil {
+			return err
+		}
+	}
+
+	var currentUUID string
+	if lease != nil && !isLeaseExpired(obj, lease, now) {
+		currentUUID = lease.UUID
+	}
+	observedUUID, _, _ := unstructured.NestedString(obj.Object, "status", "observedLeaseUUID")
+
+	type event struct{ eventType, reason, message string }
+	var events []event
+	reason := ReasonReleased
+	if currentUUID != "" {
+		reason = ReasonAcquired
+	}
+
+	if observedUUID != currentUUID {
+		if observedUUID != "" {
+			lostLease := expiredLease
+			if lease != nil && lease.UUID == observedUUID {
+				lostLease = lease
+			}
+
+			if lostLease != nil && lostLease.UUID == observedUUID {
+				reason = ReasonLeaseLost
+				events = append(events, event{"Warning", ReasonLeaseLost, fmt.Sprintf("Lease %s of lock %q held by %s has expired", observedUUID, lostLease.LockName, holderIdentity(lostLease))})
+			} else {
+				lockName, _, _ := unstructured.NestedString(obj.Object, "status", "lockName")
+				events = append(events, event{"Normal", ReasonReleased, fmt.Sprintf("Lease %s of lock %q has been released", observedUUID, lockName)})
+			}
+		}
+		if currentUUID != "" {
+			fencingToken, _, _ := unstructured.NestedInt64(obj.Object, "status", "fencingToken")
+			events = append(events, event{"Normal", ReasonAcquired, fmt.Sprintf("Lock %q acquired by %s with fencing token %d", lease.LockName, holderIdentity(lease), fencingToken)})
+		}
+	}
+
+	heldStatus, heldMessage := metav1.ConditionFalse, "Lock is free"
+	if currentUUID != "" {
+		heldStatus, heldMessage = metav1.ConditionTrue, fmt.Sprintf("Lock is held by %s", holderIdentity(lease))
+	}
+	contendedStatus, contendedMessage := metav1.ConditionFalse, "No waiters"
+	if waiters := activeWaitersCount(lease, now); waiters > 0 {
+		contendedStatus, contendedMessage = metav1.ConditionTrue, fmt.Sprintf("%d waiters in the queue", waiters)
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	conditions = setCondition(conditions, ConditionHeld, heldStatus, reason, heldMessage, now)
+	conditions = setCondition(conditions, ConditionContended, contendedStatus, contendedReason(contendedStatus), contendedMessage, now)
+
+	if err := controller.patchStatus(obj, map[string]interface{}{
+		"observedLeaseUUID": currentUUID,
+		"conditions":        conditions,
+	}); errors.IsConflict(err) {
+		// Lock has been changed meanwhile, will be synced on the next period
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("cannot patch lock %s/%s status: %s", controller.Namespace, obj.GetName(), err)
+	}
+
+	for _, e := range events {
+		if err := controller.emitEvent(obj, e.eventType, e.reason, e.message, now); err != nil {
+			debug("(lock controller) unable to emit event %s for lock %s: %s", e.reason, obj.GetName(), err)
+		}
+	}
+
+	return nil
+}
+
+// expireLease removes the expired lease without waiters from the store, or makes the backend hand the lock over
+// to the next waiter by revoking the lease. The lease is not changed if it has been renewed meanwhile.
+func (controller *LockController) expireLease(key string, lease *distributed_locker.LockLeaseRecord, now time.Time) error {
+	store := optimistic_locking_store.NewKubernetesLockStore(controller.KubernetesInterface, controller.Namespace)
+
+	return optimistic_locking_store.ChangeValue(store, key, distributed_locker.DistributedOptimisticLockingRetryPeriodSeconds*time.Second, func(value *optimistic_locking_store.Value) (bool, error) {
+		currentLease, err := distributed_locker.ExtractLockLeaseFromStoreValue(value)
+		if err != nil {
+			return false, fmt.Errorf("unable to unmarshal lease record: %s", err)
+		} else if currentLease == nil || currentLease.UUID != lease.UUID || currentLease.ExpireAtTimestamp != lease.ExpireAtTimestamp {
+			return false, nil
+		}
+
+		if activeWaitersCount(currentLease, now) == 0 {
+			debug("(lock controller) removing expired lease %s of lock %q", lease.UUID, lease.LockName)
+			distributed_locker.UnsetLockLeaseFromStoreValue(currentLease, value)
+			return true, nil
+		}
+
+		if !currentLease.IsActive(now) {
+			// Backend will hand the lock over to the next waiter
+			return false, nil
+		}
+
+		// The revoked lease cannot be renewed, so the holder which is still alive does not take the lock back
+		debug("(lock controller) revoking lease %s of lock %q", lease.UUID, lease.LockName)
+		currentLease.ExpireAtTimestamp = now.Unix() - 1
+		currentLease.PreemptDeadlineTimestamp = now.Unix() - 1
+		distributed_locker.SetLockLeaseIntoStoreValue(currentLease, value)
+		return true, nil
+	})
+}
+
+func (controller *LockController) patchStatus(obj *unstructured.Unstructured, status map[string]interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"resourceVersion": obj.GetResourceVersion()},
+		"status":   status,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to marshal patch: %s", err)
+	}
+
+	_, err = controller.locks().Patch(context.Background(), obj.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+func (controller *LockController) locks() dynamic.ResourceInterface {
+	return controller.KubernetesInterface.Resource(optimistic_locking_store.KubernetesLockGVR).Namespace(controller.Namespace)
+}
+
+func extractLease(obj *unstructured.Unstructured) (*distributed_locker.LockLeaseRecord, error) {
+	data := obj.GetAnnotations()[optimistic_locking_store.KubernetesLeaseDataAnnotation]
+	if optimistic_locking_store.ParseKubernetesLockRecord(data) == nil {
+		return nil, nil
+	}
+
+	var lease *distributed_locker.LockLeaseRecord
+	if err := json.Unmarshal([]byte(data), &lease); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal lease record of lock %s: %s", obj.GetName(), err)
+	}
+	return lease, nil
+}
+
+// isLeaseExpired returns true if the lease has expired or has not been renewed within spec.ttlSeconds of the Lock.
+func isLeaseExpired(obj *unstructured.Unstructured, lease *distributed_locker.LockLeaseRecord, now time.Time) bool {
+	if !lease.IsActive(now) {
+		return true
+	}
+
+	ttlSeconds, _, _ := unstructured.NestedInt64(obj.Object, "spec", "ttlSeconds")
+	renewTime, _, _ := unstructured.NestedString(obj.Object, "status", "renewTime")
+	if ttlSeconds <= 0 || renewTime == "" {
+		return false
+	}
+
+	renewedAt, err := time.Parse(time.RFC3339, renewTime)
+	if err != nil {
+		return false
+	}
+	return now.After(renewedAt.Add(time.Duration(ttlSeconds) * time.Second))
+}
+
+func activeWaitersCount(lease *distributed_locker.LockLeaseRecord, now time.Time) int {
+	if lease == nil {
+		return 0
+	}
+
+	count := 0
+	for _, member := range lease.QueueMembers {
+		if member.ExpireAtTimestamp >= now.Unix() {
+			count++
+		}
+	}
+	return count
+}
+
+func holderIdentity(lease *distributed_locker.LockLeaseRecord) string {
+	if lease.HolderId != "" {
+		return lease.HolderId
+	}
+	return lease.UUID
+}
+
+func contendedReason(status metav1.ConditionStatus) string {
+	if status == metav1.ConditionTrue {
+		return "Waiters"
+	}
+	return "NoWaiters"
+}
+
+// setCondition sets the condition by type, lastTransitionTime is changed only when the status changes.
+func setCondition(conditions []interface{}, conditionType string, status metav1.ConditionStatus, reason, message string, now time.Time) []interface{} {
+	condition := map[string]interface{}{
+		"type":               conditionType,
+		"status":             string(status),
+		"reason":             reason,
+		"message":            message,
+		"lastTransitionTime": now.UTC().Format(time.RFC3339),
+	}
+
+	for i, c := range conditions {
+		existing, ok := c.(map[string]interface{})
+		if !ok || existing["type"] != conditionType {
+			continue
+		}
+		if existing["status"] == string(status) {
+			condition["lastTransitionTime"] = existing["lastTransitionTime"]
+		}
+		conditions[i] = condition
+		return conditions
+	}
+
+	return append(conditions, condition)
+}
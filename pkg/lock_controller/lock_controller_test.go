@@ -0,0 +1,375 @@
+package lock_controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+
+	"github.com/werf/lockgate/pkg/distributed_locker"
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+)
+
+type testLock struct {
+	t          *testing.T
+	client     *fake.FakeDynamicClient
+	store      *optimistic_locking_store.KubernetesLockStore
+	controller *LockController
+	key        string
+}
+
+func newTestLock(t *testing.T) *testLock {
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		optimistic_locking_store.KubernetesLockGVR: "LockList",
+		EventGVR: "EventList",
+	})
+
+	return &testLock{
+		t:          t,
+		client:     client,
+		store:      optimistic_locking_store.NewKubernetesLockStore(client, "ns"),
+		controller: NewLockController(client, "ns"),
+		key:        optimistic_locking_store.LockLeaseKey("mylock"),
+	}
+}
+
+func (l *testLock) putLease(lease *distributed_locker.LockLeaseRecord) {
+	l.t.Helper()
+
+	value, err := l.store.GetValue(l.key)
+	if err != nil {
+		l.t.Fatalf("get value: %s", err)
+	}
+	if lease == nil {
+		currentLease, err := distributed_locker.ExtractLockLeaseFromStoreValue(value)
+		if err != nil {
+			l.t.Fatalf("extract lease: %s", err)
+		}
+		distributed_locker.UnsetLockLeaseFromStoreValue(currentLease, value)
+	} else {
+		distributed_locker.SetLockLeaseIntoStoreValue(lease, value)
+	}
+	if err := l.store.PutValue(l.key, value); err != nil {
+		l.t.Fatalf("put value: %s", err)
+	}
+}
+
+func (l *testLock) getLease() *distributed_locker.LockLeaseRecord {
+	l.t.Helper()
+
+	value, err := l.store.GetValue(l.key)
+	if err != nil {
+		l.t.Fatalf("get value: %s", err)
+	}
+	lease, err := distributed_locker.ExtractLockLeaseFromStoreValue(value)
+	if err != nil {
+		l.t.Fatalf("extract lease: %s", err)
+	}
+	return lease
+}
+
+func (l *testLock) getLock() *unstructured.Unstructured {
+	l.t.Helper()
+
+	obj, err := l.controller.locks().Get(context.Background(), optimistic_locking_store.KubernetesLockObjectName(l.key), metav1.GetOptions{})
+	if err != nil {
+		l.t.Fatalf("get lock: %s", err)
+	}
+	return obj
+}
+
+func (l *testLock) sync() {
+	l.t.Helper()
+
+	if err := l.controller.SyncLock(l.getLock()); err != nil {
+		l.t.Fatalf("sync lock: %s", err)
+	}
+}
+
+func (l *testLock) checkCondition(conditionType string, expectedStatus metav1.ConditionStatus, expectedReason string) {
+	l.t.Helper()
+
+	conditions, _, _ := unstructured.NestedSlice(l.getLock().Object, "status", "conditions")
+	for _, c := range conditions {
+		condition := c.(map[string]interface{})
+		if condition["type"] != conditionType {
+			continue
+		}
+		if condition["status"] != string(expectedStatus) || condition["reason"] != expectedReason {
+			l.t.Errorf("got condition %s status %v reason %v, expected status %s reason %s", conditionType, condition["status"], condition["reason"], expectedStatus, expectedReason)
+		}
+		return
+	}
+	l.t.Errorf("condition %s not found in %v", conditionType, conditions)
+}
+
+// popEvents returns reasons of the emitted events and deletes the events.
+func (l *testLock) popEvents() []string {
+	l.t.Helper()
+
+	events := l.client.Resource(EventGVR).Namespace("ns")
+	list, err := events.List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		l.t.Fatalf("list events: %s", err)
+	}
+
+	var reasons []string
+	for _, event := range list.Items {
+		reason, _, _ := unstructured.NestedString(event.Object, "reason")
+		reasons = append(reasons, reason)
+
+		if err := events.Delete(context.Background(), event.GetName(), metav1.DeleteOptions{}); err != nil {
+			l.t.Fatalf("delete event: %s", err)
+		}
+	}
+	return reasons
+}
+
+func (l *testLock) checkEvents(expectedReasons ...string) {
+	l.t.Helper()
+
+	reasons := l.popEvents()
+	if len(reasons) != len(expectedReasons) {
+		l.t.Errorf("got events %v, expected %v", reasons, expectedReasons)
+		return
+	}
+
+	// Events of the same sync have the same emission time, so the order is not checked
+	expected := make(map[string]int)
+	for _, reason := range expectedReasons {
+		expected[reason]++
+	}
+	for _, reason := range reasons {
+		expected[reason]--
+	}
+	for reason, count := range expected {
+		if count != 0 {
+			l.t.Errorf("got events %v, expected %v: mismatch of %s", reasons, expectedReasons, reason)
+		}
+	}
+}
+
+func TestSyncLock_AcquiredAndReleased(t *testing.T) {
+	l := newTestLock(t)
+
+	lease := distributed_locker.NewLockLeaseRecord("mylock", false)
+	lease.HolderId = "holder"
+	l.putLease(lease)
+
+	l.sync()
+	if observedUUID, _, _ := unstructured.NestedString(l.getLock().Object, "status", "observedLeaseUUID"); observedUUID != lease.UUID {
+		t.Errorf("got observed lease uuid %q, expected %q", observedUUID, lease.UUID)
+	}
+	l.checkCondition(ConditionHeld, metav1.ConditionTrue, ReasonAcquired)
+	l.checkCondition(ConditionContended, metav1.ConditionFalse, "NoWaiters")
+	l.checkEvents(ReasonAcquired)
+
+	// Nothing has changed, no events
+	l.sync()
+	l.checkEvents()
+
+	l.putLease(nil)
+	l.sync()
+	l.checkCondition(ConditionHeld, metav1.ConditionFalse, ReasonReleased)
+	l.checkEvents(ReasonReleased)
+
+	// Next lease of the lock
+	l.putLease(distributed_locker.NewLockLeaseRecord("mylock", false))
+	l.sync()
+	l.checkCondition(ConditionHeld, metav1.ConditionTrue, ReasonAcquired)
+	l.checkEvents(ReasonAcquired)
+}
+
+func TestSyncLock_HandedOver(t *testing.T) {
+	l := newTestLock(t)
+
+	l.putLease(distributed_locker.NewLockLeaseRecord("mylock", false))
+	l.sync()
+	l.checkEvents(ReasonAcquired)
+
+	// Lease has been released and taken by another holder between syncs
+	l.putLease(distributed_locker.NewLockLeaseRecord("mylock", false))
+	l.sync()
+	l.checkCondition(ConditionHeld, metav1.ConditionTrue, ReasonAcquired)
+	l.checkEvents(ReasonReleased, ReasonAcquired)
+}
+
+func TestSyncLock_Contended(t *testing.T) {
+	l := newTestLock(t)
+	now := time.Now()
+
+	lease := distributed_locker.NewLockLeaseRecord("mylock", false)
+	lease.QueueMembers["waiter"] = &distributed_locker.QueueMember{
+		AcquirerId:          "waiter",
+		AcquiredAtTimestamp: now.Unix(),
+		ExpireAtTimestamp:   now.Unix() + 60,
+	}
+	lease.QueueMembers["gone-waiter"] = &distributed_locker.QueueMember{
+		AcquirerId:          "gone-waiter",
+		AcquiredAtTimestamp: now.Unix() - 120,
+		ExpireAtTimestamp:   now.Unix() - 60,
+	}
+	l.putLease(lease)
+
+	l.sync()
+	l.checkCondition(ConditionHeld, metav1.ConditionTrue, ReasonAcquired)
+	l.checkCondition(ConditionContended, metav1.ConditionTrue, "Waiters")
+
+	delete(lease.QueueMembers, "waiter")
+	l.putLease(lease)
+
+	l.sync()
+	l.checkCondition(ConditionContended, metav1.ConditionFalse, "NoWaiters")
+}
+
+func TestSyncLock_ExpiredLeaseWithoutWaiters(t *testing.T) {
+	l := newTestLock(t)
+
+	lease := distributed_locker.NewLockLeaseRecord("mylock", false)
+	l.putLease(lease)
+	l.sync()
+	l.checkEvents(ReasonAcquired)
+
+	lease.ExpireAtTimestamp = time.Now().Unix() - 10
+	l.putLease(lease)
+
+	l.sync()
+	if lease := l.getLease(); lease != nil {
+		t.Errorf("expired lease without waiters should be removed, got %#v", lease)
+	}
+	l.checkCondition(ConditionHeld, metav1.ConditionFalse, ReasonLeaseLost)
+	l.checkEvents(ReasonLeaseLost)
+
+	// Lock object is kept to keep the fencing token
+	if fencingToken, _, _ := unstructured.NestedInt64(l.getLock().Object, "status", "fencingToken"); fencingToken != 1 {
+		t.Errorf("got fencing token %d, expected 1", fencingToken)
+	}
+}
+
+func TestSyncLock_NotRenewedLeaseWithWaiters(t *testing.T) {
+	l := newTestLock(t)
+	now := time.Now()
+
+	lease := distributed_locker.NewLockLeaseRecord("mylock", false)
+	lease.QueueMembers["waiter"] = &distributed_locker.QueueMember{
+		AcquirerId:          "waiter",
+		AcquiredAtTimestamp: now.Unix(),
+		ExpireAtTimestamp:   now.Unix() + 60,
+	}
+	l.putLease(lease)
+	l.sync()
+	l.checkEvents(ReasonAcquired)
+
+	// Lease is not expired by the timestamp, but has not been renewed within spec.ttlSeconds
+	obj := l.getLock()
+	_ = unstructured.SetNestedField(obj.Object, int64(10), "spec", "ttlSeconds")
+	_ = unstructured.SetNestedField(obj.Object, now.Add(-time.Minute).UTC().Format(time.RFC3339), "status", "renewTime")
+	if _, err := l.controller.locks().Update(context.Background(), obj, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update lock: %s", err)
+	}
+
+	l.sync()
+	expiredLease := l.getLease()
+	if expiredLease == nil || expiredLease.UUID != lease.UUID {
+		t.Fatalf("lease with waiters should be kept for the hand over, got %#v", expiredLease)
+	}
+	if expiredLease.ExpireAtTimestamp >= now.Unix() {
+		t.Errorf("lease should be expired for the hand over, got expiration %d", expiredLease.ExpireAtTimestamp)
+	}
+	if len(expiredLease.QueueMembers) != 1 {
+		t.Errorf("waiters should be kept, got %v", expiredLease.QueueMembers)
+	}
+	l.checkCondition(ConditionHeld, metav1.ConditionFalse, ReasonLeaseLost)
+	l.checkCondition(ConditionContended, metav1.ConditionTrue, "Waiters")
+	l.checkEvents(ReasonLeaseLost)
+}
+
+func TestSyncOnce_SkipsAuxiliaryRecords(t *testing.T) {
+	l := newTestLock(t)
+
+	l.putLease(distributed_locker.NewLockLeaseRecord("mylock", false))
+
+	recordKey := "reservations." + l.key
+	value, err := l.store.GetValue(recordKey)
+	if err != nil {
+		t.Fatalf("get value: %s", err)
+	}
+	value.Data = `{"Reservations":[]}`
+	if err := l.store.PutValue(recordKey, value); err != nil {
+		t.Fatalf("put value: %s", err)
+	}
+
+	if err := l.controller.SyncOnce(); err != nil {
+		t.Fatalf("sync: %s", err)
+	}
+	l.checkCondition(ConditionHeld, metav1.ConditionTrue, ReasonAcquired)
+	l.checkEvents(ReasonAcquired)
+
+	record, err := l.controller.locks().Get(context.Background(), optimistic_locking_store.KubernetesLockObjectName(recordKey), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get record: %s", err)
+	}
+	if _, found, _ := unstructured.NestedSlice(record.Object, "status", "conditions"); found {
+		t.Errorf("auxiliary record should not be synced")
+	}
+}
+
+func TestSyncLock_RevokedLeaseOfRenewingHolder(t *testing.T) {
+	l := newTestLock(t)
+	backend := distributed_locker.NewOptimisticLockingStorageBasedBackend(l.store)
+
+	handle, err := backend.Acquire("mylock", distributed_locker.AcquireOptions{AcquirerId: "holder"})
+	if err != nil {
+		t.Fatalf("acquire: %s", err)
+	}
+	if fencingToken, _, _ := unstructured.NestedInt64(l.getLock().Object, "status", "fencingToken"); fencingToken != handle.FencingToken {
+		t.Errorf("got fencing token %d in the status, expected the token %d of the holder", fencingToken, handle.FencingToken)
+	}
+	if _, err := backend.Acquire("mylock", distributed_locker.AcquireOptions{AcquirerId: "waiter"}); !distributed_locker.IsErrShouldWait(err) {
+		t.Fatalf("got %v, expected the waiter to wait", err)
+	}
+	l.sync()
+	l.checkEvents(ReasonAcquired)
+
+	// The holder has not renewed the lease within spec.ttlSeconds, e.g. has been partitioned from the API server
+	obj := l.getLock()
+	_ = unstructured.SetNestedField(obj.Object, int64(10), "spec", "ttlSeconds")
+	_ = unstructured.SetNestedField(obj.Object, time.Now().Add(-time.Minute).UTC().Format(time.RFC3339), "status", "renewTime")
+	if _, err := l.controller.locks().Update(context.Background(), obj, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update lock: %s", err)
+	}
+	l.sync()
+	l.checkEvents(ReasonLeaseLost)
+
+	// The holder which is still alive cannot renew the revoked lease and take the lock back
+	for i := 0; i < 2; i++ {
+		if err := backend.RenewLease(handle); !distributed_locker.IsErrLockAlreadyLeased(err) {
+			t.Errorf("renew %d: got %v, expected %v", i, err, distributed_locker.ErrLockAlreadyLeased)
+		}
+	}
+	if lease := l.getLease(); lease.UUID != handle.UUID || lease.IsActive(time.Now()) {
+		t.Errorf("got lease %#v, expected the revoked lease of the holder", lease)
+	}
+	l.sync()
+	l.checkEvents()
+
+	// The waiter takes the lock over with the next fencing token
+	waiterHandle, err := backend.Acquire("mylock", distributed_locker.AcquireOptions{AcquirerId: "waiter"})
+	if err != nil {
+		t.Fatalf("acquire by waiter: %s", err)
+	}
+	if waiterHandle.FencingToken != handle.FencingToken+1 {
+		t.Errorf("got fencing token %d of the waiter, expected %d", waiterHandle.FencingToken, handle.FencingToken+1)
+	}
+	if fencingToken, _, _ := unstructured.NestedInt64(l.getLock().Object, "status", "fencingToken"); fencingToken != waiterHandle.FencingToken {
+		t.Errorf("got fencing token %d in the status, expected the token %d of the waiter", fencingToken, waiterHandle.FencingToken)
+	}
+	l.sync()
+	l.checkCondition(ConditionHeld, metav1.ConditionTrue, ReasonAcquired)
+	l.checkEvents(ReasonAcquired)
+}
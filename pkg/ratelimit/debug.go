@@ -0,0 +1,7 @@
+package ratelimit
+
+import "github.com/werf/lockgate/pkg/util"
+
+func debug(format string, args ...interface{}) {
+	util.Debug(format, args...)
+}
@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Limit describes a token bucket: Tokens are added to the bucket every Period up to the Burst capacity.
+type Limit struct {
+	Tokens int           `json:"tokens"`
+	Period time.Duration `json:"period"`
+	Burst  int           `json:"burst,omitempty"`
+}
+
+type TakeResult struct {
+	Granted    int           `json:"granted"`
+	RetryAfter time.Duration `json:"retryAfter,omitempty"`
+}
+
+// Backend takes from min to max tokens from the shared bucket by the key. When less than min tokens are available
+// no tokens are taken and RetryAfter is set to the period after which min tokens will be available.
+type Backend interface {
+	RateLimitTake(key string, min, max int, limit Limit) (*TakeResult, error)
+}
+
+// Limiter limits the rate of operations by the key across all processes using the same backend.
+// To reduce contention on the shared bucket record tokens are taken from the backend in batches
+// of BatchSize tokens and handed out locally. Locally cached tokens expire after the Limit.Period.
+type Limiter struct {
+	Backend   Backend
+	Limit     Limit
+	BatchSize int
+
+	// mux guards the map of batches only, the batch of the key is locked separately
+	mux     sync.Mutex
+	batches map[string]*localBatch
+}
+
+type localBatch struct {
+	mux      sync.Mutex
+	Tokens   int
+	ExpireAt time.Time
+}
+
+func NewLimiter(backend Backend, limit Limit, batchSize int) *Limiter {
+	return &Limiter{
+		Backend:   backend,
+		Limit:     limit,
+		BatchSize: batchSize,
+		batches:   make(map[string]*localBatch),
+	}
+}
+
+// Allow takes n tokens by the key if available without waiting.
+func (limiter *Limiter) Allow(key string, n int) (bool, error) {
+	retryAfter, err := limiter.take(key, n)
+	if err != nil {
+		return false, err
+	}
+	return retryAfter == 0, nil
+}
+
+// Wait blocks until n tokens by the key are available or ctx is done.
+func (limiter *Limiter) Wait(ctx context.Context, key string, n int) error {
+	for {
+		retryAfter, err := limiter.take(key, n)
+		if err != nil {
+			return err
+		} else if retryAfter == 0 {
+			return nil
+		}
+		debug("(wait %q) %d tokens not available, will retry in %s", key, n, retryAfter)
+
+		select {
+		case <-time.After(retryAfter):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// take returns zero when n tokens have been taken, otherwise the period to wait before retry.
+func (limiter *Limiter) take(key string, n int) (time.Duration, error) {
+	if err := limiter.Limit.Validate(); err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("bad tokens number %d", n)
+	}
+	if n > limiter.Limit.GetBurst() {
+		return 0, fmt.Errorf("requested %d tokens exceed the burst %d", n, limiter.Limit.GetBurst())
+	}
+
+	// The batch is locked across the backend request, so that only requests by the same key wait for each other
+	batch := limiter.getBatch(key)
+	batch.mux.Lock()
+	defer batch.mux.Unlock()
+
+	if time.Now().After(batch.ExpireAt) {
+		batch.Tokens = 0
+	}
+
+	if batch.Tokens >= n {
+		batch.Tokens -= n
+		return 0, nil
+	}
+
+	min := n - batch.Tokens
+	max := min
+	if limiter.BatchSize > max {
+		max = limiter.BatchSize
+	}
+
+	result, err := limiter.Backend.RateLimitTake(key, min, max, limiter.Limit)
+	if err != nil {
+		return 0, err
+	}
+	if result.Granted < min {
+		if result.RetryAfter <= 0 {
+			return time.Millisecond, nil
+		}
+		return result.RetryAfter, nil
+	}
+
+	batch.Tokens += result.Granted - n
+	batch.ExpireAt = time.Now().Add(limiter.Limit.Period)
+
+	return 0, nil
+}
+
+func (limiter *Limiter) getBatch(key string) *localBatch {
+	limiter.mux.Lock()
+	defer limiter.mux.Unlock()
+
+	batch, hasKey := limiter.batches[key]
+	if !hasKey {
+		batch = &localBatch{}
+		limiter.batches[key] = batch
+	}
+	return batch
+}
+
+func (limit Limit) GetBurst() int {
+	if limit.Burst == 0 {
+		return limit.Tokens
+	}
+	return limit.Burst
+}
+
+func (limit Limit) Validate() error {
+	if limit.Tokens <= 0 || limit.Period <= 0 {
+		return fmt.Errorf("bad rate limit %d tokens per %s", limit.Tokens, limit.Period)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+	"github.com/werf/lockgate/pkg/util"
+)
+
+// Retry period is short, because the bucket record is expected to be changed frequently
+const OptimisticLockingRetryPeriod = 50 * time.Millisecond
+
+// BucketRecord is a versioned token bucket state stored in the OptimisticLockingStore.
+type BucketRecord struct {
+	Tokens            float64 `json:"tokens"`
+	UpdatedAtUnixNano int64   `json:"updatedAtUnixNano"`
+}
+
+type StoreBackend struct {
+	Store optimistic_locking_store.OptimisticLockingStore
+}
+
+func NewStoreBackend(store optimistic_locking_store.OptimisticLockingStore) *StoreBackend {
+	return &StoreBackend{Store: store}
+}
+
+func (backend *StoreBackend) RateLimitTake(key string, min, max int, limit Limit) (*TakeResult, error) {
+	return TakeFromStore(backend.Store, key, min, max, limit)
+}
+
+// TakeFromStore takes tokens from the token bucket record by the key in the store.
+func TakeFromStore(store optimistic_locking_store.OptimisticLockingStore, key string, min, max int, limit Limit) (*TakeResult, error) {
+	if err := limit.Validate(); err != nil {
+		return nil, err
+	}
+	if min <= 0 || max < min {
+		return nil, fmt.Errorf("bad tokens range [%d, %d]", min, max)
+	}
+
+	result := &TakeResult{}
+	storeKeyName := fmt.Sprintf("ratelimit.lockgate.io/%s", util.Sha3_224Hash(key))
+
+	err := optimistic_locking_store.ChangeValue(store, storeKeyName, OptimisticLockingRetryPeriod, func(value *optimistic_locking_store.Value) (bool, error) {
+		now := time.Now()
+		burst := float64(limit.GetBurst())
+		tokensPerNanosecond := float64(limit.Tokens) / float64(limit.Period.Nanoseconds())
+
+		record := &BucketRecord{Tokens: burst, UpdatedAtUnixNano: now.UnixNano()}
+		if value.Data != "" {
+			if err := json.Unmarshal([]byte(value.Data), record); err != nil {
+				return false, fmt.Errorf("unable to unmarshal bucket record by key %s: %s", storeKeyName, err)
+			}
+		}
+
+		if elapsed := now.UnixNano() - record.UpdatedAtUnixNano; elapsed > 0 {
+			record.Tokens = math.Min(burst, record.Tokens+float64(elapsed)*tokensPerNanosecond)
+		}
+		record.UpdatedAtUnixNano = now.UnixNano()
+
+		if record.Tokens < float64(min) {
+			result.Granted = 0
+			result.RetryAfter = time.Duration((float64(min) - record.Tokens) / tokensPerNanosecond)
+			// Bucket state is not changed, no need to put the value
+			return false, nil
+		}
+
+		result.Granted = int(math.Min(float64(max), math.Floor(record.Tokens)))
+		result.RetryAfter = 0
+		record.Tokens -= float64(result.Granted)
+
+		if data, err := json.Marshal(record); err != nil {
+			return false, fmt.Errorf("unable to marshal bucket record: %s", err)
+		} else {
+			value.Data = string(data)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	debug("(take %q) min=%d max=%d -> %#v", key, min, max, result)
+	return result, nil
+}